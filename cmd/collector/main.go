@@ -4,17 +4,25 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	_ "net/http/pprof"
 
 	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/cache"
+	"github.com/rancher-sandbox/profiling/pkg/collector/correlation"
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
 	"github.com/rancher-sandbox/profiling/pkg/collector/ingest"
 	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 	"github.com/rancher-sandbox/profiling/pkg/collector/web"
 	"github.com/rancher-sandbox/profiling/pkg/config"
@@ -31,9 +39,16 @@ func BuildCollectorCmd() *cobra.Command {
 	var logLevel string
 	var webPort int
 	var dataDir string
+	var artifactDir string
 	var cpuProfileRate int
 	var blockProfileRate int
 	var mutexProfileFraction int
+	var shardIndex int
+	var shardIndexFromHostname bool
+	var shardCount int
+	var shardPeers []string
+	var pprofCacheBytes int64
+	var storeUsageInterval time.Duration
 	cmd := &cobra.Command{
 		Use: "collector",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -75,28 +90,105 @@ func BuildCollectorCmd() *cobra.Command {
 				logger.With("data-dir", dataDir).Error("failed to create data dir")
 				return fmt.Errorf("failed to create data dir: %w", err)
 			}
-			store = storage.NewLabelBasedFileStore(dataDir, []string{labels.NamespaceLabel, labels.NameLabel}, &storage.PprofMerger{})
+			indexBy := []string{labels.NamespaceLabel, labels.NameLabel}
+			fileStore := storage.NewLabelBasedFileStore(dataDir, indexBy, &storage.PprofMerger{})
+			metrics.Registry.MustRegister(storage.NewUsageCollector(fileStore, storeUsageInterval))
+			store = fileStore
+
+			var index *correlation.Index
+			if cfg.Correlation != nil {
+				index = correlation.NewIndex(cfg.Correlation.IndexedLabels, cfg.Correlation.MaxIndexedValues)
+			} else {
+				index = correlation.NewIndex(nil, 0)
+			}
+			go func() {
+				if err := index.Rebuild(logger, store); err != nil {
+					logger.With("err", err).Warn("failed to rebuild correlation index")
+				}
+			}()
+			store = correlation.NewIndexedStore(logger, store, indexBy, index)
+
+			logger.With("artifact-dir", artifactDir).Info("setting up artifact storage")
+			if err := os.MkdirAll(artifactDir, 0755); err != nil {
+				return fmt.Errorf("failed to create artifact dir: %w", err)
+			}
+			artifacts := storage.NewFileArtifactStore(artifactDir, indexBy, nil)
+			setRetention := func(cfg *config.CollectorConfig) {
+				artifactsCfg := cfg.Artifacts
+				if artifactsCfg == nil {
+					artifactsCfg = &config.ArtifactsConfig{}
+				}
+				for kind, retention := range map[string]*config.RetentionConfig{
+					exectrace.ArtifactKind:  artifactsCfg.Trace,
+					goroutines.ArtifactKind: artifactsCfg.GoroutineDump,
+					// captures are stored per monitor and profile type
+					monitor.CaptureKind: artifactsCfg.Capture,
+				} {
+					artifacts.SetRetention(kind, storage.Retention{
+						MaxAge:   retention.MaxAge(),
+						MaxCount: retention.MaxCount(),
+					})
+				}
+			}
+			setRetention(cfg)
 
 			logger.With("config", configFile).Info("starting collector")
 
-			c := collector.NewCollector(context.Background(), logger, cfg, store)
-			reloadF := func() error {
+			if shardIndexFromHostname {
+				hostname, err := os.Hostname()
+				if err != nil {
+					return fmt.Errorf("failed to read hostname: %w", err)
+				}
+				if shardIndex, err = collector.ShardIndexFromHostname(hostname); err != nil {
+					return err
+				}
+			}
+			shard := collector.Shard{Index: shardIndex, Count: shardCount}
+			if err := shard.Validate(); err != nil {
+				return err
+			}
+			if len(shardPeers) > 0 && len(shardPeers) != max(shardCount, 1) {
+				return fmt.Errorf("expected %d shard peers, got %d", max(shardCount, 1), len(shardPeers))
+			}
+
+			c := collector.NewCollector(context.Background(), logger, cfg, store, artifacts)
+			c.SetShard(shard)
+			reload := func() (*collector.ReloadReport, error) {
 				logger.Info("reloading collector config...")
 				data, err := os.ReadFile(configFile)
 				if err != nil {
-					return fmt.Errorf("failed to read config during reload file: %w", err)
+					return nil, fmt.Errorf("failed to read config during reload file: %w", err)
 				}
-				if err := yaml.Unmarshal(data, &cfg); err != nil {
-					return fmt.Errorf("failed to unmarshal config file during reload: %w", err)
+				// unmarshal into a new config, the collector diffs it against the current one
+				var newCfg *config.CollectorConfig
+				if err := yaml.Unmarshal(data, &newCfg); err != nil {
+					return nil, fmt.Errorf("failed to unmarshal config file during reload: %w", err)
 				}
-				if err := c.Reload(cfg); err != nil {
-					return fmt.Errorf("failed to reload config: %w", err)
+				setRetention(newCfg)
+				report, err := c.Reload(newCfg)
+				if err != nil {
+					return nil, fmt.Errorf("failed to reload config: %w", err)
 				}
-				return nil
+				return report, nil
+			}
+			reloadF := func() (*collector.ReloadReport, error) {
+				metrics.Reloads.Inc()
+				report, err := reload()
+				if err != nil {
+					metrics.ReloadFailures.Inc()
+				}
+				return report, err
 			}
 
 			// start webUI
-			webServer := web.NewWebServer(logger, webPort, store, reloadF, dataDir)
+			webServer := web.NewWebServer(logger, webPort, store, reloadF, index, c, artifacts, dataDir)
+			if len(shardPeers) > 1 {
+				logger.With("shard", shardIndex, "peers", shardPeers).Info("fanning queries out to shards")
+				webServer.SetShards(web.NewShards(shardIndex, shardPeers))
+			}
+			if pprofCacheBytes > 0 {
+				webServer.SetDriverCache(cache.NewLRU[*http.ServeMux](pprofCacheBytes))
+			}
 			errC := func() chan error {
 				errC := make(chan error)
 				go func() {
@@ -105,15 +197,20 @@ func BuildCollectorCmd() *cobra.Command {
 				return errC
 			}()
 
-			// start otlp ingestion grpc
+			ingestCfg := cfg.Ingest.WithDefaults()
 			ingester := ingest.NewOTLPIngester(logger.With("component", "ingestion"), store)
-			if err := ingester.StartGrpc(("tcp4://127.0.0.1:4318")); err != nil {
-				return err
+			// start otlp ingestion grpc
+			if ingestCfg.GRPC.IsEnabled() {
+				if err := ingester.StartGrpc(ingestCfg.GRPC); err != nil {
+					return err
+				}
 			}
 
 			// start otlp ingestion http
-			if err := ingester.StartHTTP("127.0.0.1:4317"); err != nil {
-				return err
+			if ingestCfg.HTTP.IsEnabled() {
+				if err := ingester.StartHTTP(ingestCfg.HTTP); err != nil {
+					return err
+				}
 			}
 
 			// start collector after UI
@@ -134,7 +231,7 @@ func BuildCollectorCmd() *cobra.Command {
 					}
 					return fmt.Errorf("failed to start web UI")
 				case <-reloader:
-					if err := reloadF(); err != nil {
+					if _, err := reloadF(); err != nil {
 						logger.With("err", err).Error("failed to reload config")
 					}
 				}
@@ -145,9 +242,16 @@ func BuildCollectorCmd() *cobra.Command {
 	cmd.Flags().StringVarP(&logLevel, "log-level", "l", "info", "Log level")
 	cmd.Flags().IntVarP(&webPort, "web-port", "p", 8989, "Port for web UI")
 	cmd.Flags().StringVarP(&dataDir, "data-dir", "d", "/tmp/collector", "Directory to store and query profile data")
+	cmd.Flags().StringVarP(&artifactDir, "artifact-dir", "", "/tmp/collector-artifacts", "Directory to store artifacts that can't be merged, like execution traces")
 	cmd.Flags().IntVarP(&cpuProfileRate, "pprof.cpu-profile-rate", "", 1, "CPU profile rate")
 	cmd.Flags().IntVarP(&blockProfileRate, "pprof.block-profile-rate", "", 1, "Block profile rate")
 	cmd.Flags().IntVarP(&mutexProfileFraction, "pprof.mutex-profile-fraction", "", 1, "Mutex profile rate")
+	cmd.Flags().IntVarP(&shardIndex, "shard-index", "", 0, "Index of the shard of targets scraped by this collector")
+	cmd.Flags().BoolVarP(&shardIndexFromHostname, "shard-index-from-hostname", "", false, "Read the shard index from the ordinal suffix of the hostname, like the pods of a StatefulSet, instead of --shard-index")
+	cmd.Flags().IntVarP(&shardCount, "shard-count", "", 1, "Number of collector shards, targets are spread across shards by the hashmod of their host:port address once relabeled")
+	cmd.Flags().StringSliceVarP(&shardPeers, "shard-peers", "", nil, "Base URLs of the web servers of every shard, in shard order, to fan queries out to")
+	cmd.Flags().DurationVarP(&storeUsageInterval, "store-usage-interval", "", time.Minute, "Minimum interval between walks of the data dir to report its disk usage, scrapes in between report the last usage")
+	cmd.Flags().Int64VarP(&pprofCacheBytes, "pprof-cache-bytes", "", 256<<20, "Estimated memory of the cached pprof UIs of the last viewed profiles, 0 disables the cache")
 	return cmd
 }
 
@@ -0,0 +1,317 @@
+// Package burst switches targets to burst mode, capturing detailed profiles for a bounded time,
+// when a cheap signal crosses the threshold of a rule
+package burst
+
+import (
+	"context"
+	"log/slog"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// Trigger reasons
+const (
+	ReasonThreshold = "threshold"
+	ReasonGrowth    = "growth"
+)
+
+type stateKey struct {
+	rule string
+	mon  *monitor.Monitor
+}
+
+// state of a rule for a target
+type state struct {
+	value      float64
+	observedAt time.Time
+	bursting   bool
+	// the rule doesn't trigger again before
+	cooldownUntil time.Time
+}
+
+// Engine evaluates the burst rules against the signals of the collector's monitors.
+// It observes the profiles scraped by the monitors it is set as the observer of, and polls the metrics of its targets.
+type Engine struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	rules   []*config.BurstRule
+	targets []*monitor.Monitor
+	states  map[stateKey]*state
+	// stops the metric pollers of the current rules
+	stopPollers context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+var _ monitor.Observer = (*Engine)(nil)
+
+func NewEngine(logger *slog.Logger) *Engine {
+	return &Engine{
+		logger: logger.With("component", "burst"),
+		states: map[stateKey]*state{},
+	}
+}
+
+// Start runs the engine until Stop is called or ctx is done
+func (e *Engine) Start(ctx context.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.ctx, e.cancel = context.WithCancel(ctx)
+	e.startPollers()
+}
+
+// Stop cancels the ongoing bursts and waits for them to return
+func (e *Engine) Stop() {
+	e.mu.Lock()
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.ctx, e.cancel, e.stopPollers = nil, nil, nil
+	e.states = map[stateKey]*state{}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
+
+// SetRules replaces the rules, invalid rules are skipped. Ongoing bursts run until they end.
+func (e *Engine) SetRules(rules []*config.BurstRule) {
+	valid := []*config.BurstRule{}
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			e.logger.With("err", err).Error("skipping invalid burst rule")
+			continue
+		}
+		valid = append(valid, rule)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	prev := byName(e.rules)
+	next := byName(valid)
+	for key, s := range e.states {
+		// the signal history and cooldown of a changed rule don't apply anymore
+		if !s.bursting && !reflect.DeepEqual(prev[key.rule], next[key.rule]) {
+			delete(e.states, key)
+		}
+	}
+	e.rules = valid
+	e.startPollers()
+}
+
+func byName(rules []*config.BurstRule) map[string]*config.BurstRule {
+	ret := map[string]*config.BurstRule{}
+	for _, rule := range rules {
+		ret[rule.Name] = rule
+	}
+	return ret
+}
+
+// SetTargets replaces the monitors whose signals are polled
+func (e *Engine) SetTargets(mons []*monitor.Monitor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.targets = slices.Clone(mons)
+	for key, s := range e.states {
+		if !s.bursting && !slices.Contains(mons, key.mon) {
+			delete(e.states, key)
+		}
+	}
+}
+
+// startPollers restarts the metric pollers, e.mu must be held
+func (e *Engine) startPollers() {
+	if e.stopPollers != nil {
+		e.stopPollers()
+		e.stopPollers = nil
+	}
+	if e.ctx == nil {
+		return
+	}
+	ctx, ca := context.WithCancel(e.ctx)
+	e.stopPollers = ca
+	for _, rule := range e.rules {
+		if rule.Signal != config.SignalMetric {
+			continue
+		}
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.poll(ctx, rule)
+		}()
+	}
+}
+
+func (e *Engine) poll(ctx context.Context, rule *config.BurstRule) {
+	logger := e.logger.With("rule", rule.Name)
+	ticker := time.NewTicker(rule.Metric.RefreshInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		e.mu.Lock()
+		targets := slices.Clone(e.targets)
+		e.mu.Unlock()
+		for _, mon := range targets {
+			names := selected(rule, mon)
+			if len(names) == 0 {
+				continue
+			}
+			data, err := mon.Fetch(ctx, rule.Metric.MetricsPath())
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.With("err", err, "targets", names).Warn("failed to read metrics")
+				continue
+			}
+			value, err := metricSignal(rule.Metric, data)
+			if err != nil {
+				logger.With("err", err, "targets", names).Warn("failed to read signal")
+				continue
+			}
+			e.evaluate(rule, mon, names, value, time.Now())
+		}
+	}
+}
+
+// Observe evaluates the rules whose signal is read from the profile type
+func (e *Engine) Observe(mon *monitor.Monitor, profileType string, data []byte) {
+	e.mu.Lock()
+	rules := e.rules
+	e.mu.Unlock()
+	var p *profile.Profile
+	for _, rule := range rules {
+		if rule.Signal.ProfileType() != profileType {
+			continue
+		}
+		names := selected(rule, mon)
+		if len(names) == 0 {
+			continue
+		}
+		if p == nil {
+			parsed, err := profile.ParseData(data)
+			if err != nil {
+				e.logger.With("err", err, "targets", names).Warn("failed to parse profile")
+				return
+			}
+			p = parsed
+		}
+		value, err := profileSignal(rule.Signal, p)
+		if err != nil {
+			e.logger.With("rule", rule.Name, "err", err, "targets", names).Warn("failed to read signal")
+			continue
+		}
+		e.evaluate(rule, mon, names, value, time.Now())
+	}
+}
+
+// selected returns the names of the monitors of the target selected by the rule
+func selected(rule *config.BurstRule, mon *monitor.Monitor) []string {
+	names := []string{}
+	for _, status := range mon.Status() {
+		if hasLabels(status.Labels, rule.Selector) {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// triggered returns why a new observation of the signal triggers the rule, or an empty string
+func triggered(rule *config.BurstRule, prev *state, value float64, now time.Time) string {
+	if rule.Threshold > 0 && value >= rule.Threshold {
+		return ReasonThreshold
+	}
+	if rule.GrowthPerMinute > 0 && prev != nil && now.After(prev.observedAt) {
+		growth := (value - prev.value) / now.Sub(prev.observedAt).Minutes()
+		if growth >= rule.GrowthPerMinute {
+			return ReasonGrowth
+		}
+	}
+	return ""
+}
+
+func (e *Engine) evaluate(rule *config.BurstRule, mon *monitor.Monitor, names []string, value float64, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ctx == nil {
+		return
+	}
+	key := stateKey{rule: rule.Name, mon: mon}
+	s, ok := e.states[key]
+	if !ok {
+		s = &state{}
+		e.states[key] = s
+	}
+	var prev *state
+	if ok {
+		prev = &state{value: s.value, observedAt: s.observedAt}
+	}
+	s.value, s.observedAt = value, now
+	reason := triggered(rule, prev, value, now)
+	if reason == "" || s.bursting || now.Before(s.cooldownUntil) {
+		return
+	}
+	s.bursting = true
+	metrics.Bursts.WithLabelValues(rule.Name).Inc()
+	e.logger.With(
+		"rule", rule.Name,
+		"targets", names,
+		"reason", reason,
+		"value", value,
+		"duration", rule.Burst.Duration(),
+	).Info("switching targets to burst mode")
+	ctx := e.ctx
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.burst(ctx, rule, mon, names, reason)
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		s.bursting = false
+		s.cooldownUntil = time.Now().Add(rule.Cooldown())
+	}()
+}
+
+// burst captures the rule's profiles from the target in rounds, until the burst duration elapsed
+func (e *Engine) burst(ctx context.Context, rule *config.BurstRule, mon *monitor.Monitor, names []string, reason string) {
+	logger := e.logger.With("rule", rule.Name, "targets", names)
+	defer logger.Info("burst mode ended")
+	// captures started before the end of the burst are completed
+	end := time.NewTimer(rule.Burst.Duration())
+	defer end.Stop()
+	sampleLabels := map[string]string{
+		labels.BurstRuleLabel:   rule.Name,
+		labels.BurstReasonLabel: reason,
+	}
+	ticker := time.NewTicker(rule.Burst.Interval())
+	defer ticker.Stop()
+	for {
+		for _, profileType := range rule.Burst.ProfileTypes() {
+			_, err := mon.Capture(ctx, names, profileType, rule.Burst.CaptureSeconds(), sampleLabels)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				logger.With("err", err, "profile-type", profileType).Warn("burst capture failed")
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-end.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package burst_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/burst"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const NoLogsLevel = 100
+
+type target struct {
+	server    *httptest.Server
+	sched     *scheduler.Scheduler
+	artifacts *storage.FileArtifactStore
+	engine    *burst.Engine
+	mon       *monitor.Monitor
+	captures  atomic.Int32
+}
+
+func (tg *target) close() {
+	tg.engine.Stop()
+	tg.mon.Shutdown()
+	tg.sched.Stop()
+	tg.server.Close()
+}
+
+func newTarget(t *testing.T, metrics http.HandlerFunc, sampling config.GlobalSamplingConfig, rules ...*config.BurstRule) *target {
+	tg := &target{}
+	mux := http.NewServeMux()
+	// the goroutines of the test
+	mux.HandleFunc("/debug/pprof/goroutine", func(w http.ResponseWriter, r *http.Request) {
+		pprof.Lookup("goroutine").WriteTo(w, 0)
+	})
+	mux.HandleFunc("/debug/pprof/heap", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("seconds") != "" {
+			tg.captures.Add(1)
+		}
+		w.Write(testdata.TestData("heap1.pb"))
+	})
+	if metrics != nil {
+		mux.HandleFunc("/metrics", metrics)
+	}
+	tg.server = httptest.NewServer(mux)
+	tg.sched = scheduler.NewScheduler(slog.Default())
+	tg.artifacts = storage.NewFileArtifactStore(t.TempDir(), []string{labels.NamespaceLabel}, nil)
+	tg.engine = burst.NewEngine(slog.Default())
+	tg.mon = monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:           "test",
+		Endpoint:       tg.server.URL,
+		Labels:         map[string]string{labels.NamespaceLabel: "default", "team": "a"},
+		GlobalSampling: sampling,
+	}, storage.NewNoopStore(), tg.artifacts, tg.sched)
+	tg.mon.SetObserver(tg.engine)
+	tg.engine.Start(context.Background())
+	tg.engine.SetRules(rules)
+	tg.engine.SetTargets([]*monitor.Monitor{tg.mon})
+	require.NoError(t, tg.mon.Start(context.Background()))
+	return tg
+}
+
+func TestGoroutineThreshold(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	tg := newTarget(t, nil, config.GlobalSamplingConfig{
+		Goroutine: &config.SamplerConfig{IntervalSeconds: 1},
+	}, &config.BurstRule{
+		Name:      "goroutine-leak",
+		Selector:  map[string]string{"team": "a"},
+		Signal:    config.SignalGoroutines,
+		Threshold: 1,
+		Burst: config.BurstConfig{
+			DurationSeconds: 1,
+			IntervalSeconds: 1,
+			Seconds:         1,
+			Profiles:        []string{"heap"},
+		},
+	}, &config.BurstRule{
+		Name:      "other-team",
+		Selector:  map[string]string{"team": "b"},
+		Signal:    config.SignalGoroutines,
+		Threshold: 1,
+	})
+	defer tg.close()
+
+	var captures []storage.Artifact
+	assert.Eventually(t, func() bool {
+		var err error
+		captures, err = tg.artifacts.ListArtifacts(monitor.CaptureKind)
+		return err == nil && len(captures) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NotEmpty(t, captures)
+	assert.Equal(t, "default/test/heap", captures[0].Key)
+
+	path, err := tg.artifacts.GetArtifact(monitor.CaptureKind, captures[0].Key, captures[0].ID)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	p, err := profile.ParseData(data)
+	require.NoError(t, err)
+	require.NotEmpty(t, p.Sample)
+	for _, s := range p.Sample {
+		assert.Equal(t, []string{"goroutine-leak"}, s.Label[labels.BurstRuleLabel])
+		assert.Equal(t, []string{burst.ReasonThreshold}, s.Label[labels.BurstReasonLabel])
+	}
+
+	// the burst is bounded, and the rule cools down before triggering again
+	time.Sleep(2 * time.Second)
+	count := tg.captures.Load()
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, count, tg.captures.Load())
+}
+
+func TestMetricGrowth(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	var requests atomic.Int32
+	metrics := func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		fmt.Fprintf(w, "# TYPE queue_size gauge\nqueue_size{queue=\"jobs\"} %d\nqueue_size{queue=\"other\"} 1000\n", n*100)
+	}
+	tg := newTarget(t, metrics, config.GlobalSamplingConfig{}, &config.BurstRule{
+		Name:   "queue-growth",
+		Signal: config.SignalMetric,
+		Metric: &config.MetricSignalConfig{
+			Name:                   "queue_size",
+			Labels:                 map[string]string{"queue": "jobs"},
+			RefreshIntervalSeconds: 1,
+		},
+		// the gauge grows by 100 every second
+		GrowthPerMinute: 1000,
+		Burst: config.BurstConfig{
+			DurationSeconds: 1,
+			Seconds:         1,
+			Profiles:        []string{"heap"},
+		},
+	})
+	defer tg.close()
+
+	assert.Eventually(t, func() bool {
+		return tg.captures.Load() > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	// growth is measured between two reads
+	assert.GreaterOrEqual(t, requests.Load(), int32(2))
+}
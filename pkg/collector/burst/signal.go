@@ -0,0 +1,81 @@
+package burst
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/google/pprof/profile"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// profileSignal returns the value of a signal observed from a profile
+func profileSignal(signal config.BurstSignal, p *profile.Profile) (float64, error) {
+	var sampleType string
+	switch signal {
+	case config.SignalGoroutines:
+		sampleType = "goroutine"
+	case config.SignalHeapInuse:
+		sampleType = "inuse_space"
+	default:
+		return 0, fmt.Errorf("signal %s is not observed from profiles", signal)
+	}
+	idx := -1
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return 0, fmt.Errorf("profile has no %s samples", sampleType)
+	}
+	var total int64
+	for _, s := range p.Sample {
+		total += s.Value[idx]
+	}
+	return float64(total), nil
+}
+
+// metricSignal sums the series of a metric in the Prometheus text format that have all the given labels
+func metricSignal(cfg *config.MetricSignalConfig, data []byte) (float64, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+	family, ok := families[cfg.Name]
+	if !ok {
+		return 0, fmt.Errorf("metric %s not found", cfg.Name)
+	}
+	var total float64
+	for _, m := range family.GetMetric() {
+		labels := map[string]string{}
+		for _, l := range m.GetLabel() {
+			labels[l.GetName()] = l.GetValue()
+		}
+		if !hasLabels(labels, cfg.Labels) {
+			continue
+		}
+		switch {
+		case m.Gauge != nil:
+			total += m.GetGauge().GetValue()
+		case m.Counter != nil:
+			total += m.GetCounter().GetValue()
+		case m.Untyped != nil:
+			total += m.GetUntyped().GetValue()
+		default:
+			return 0, fmt.Errorf("metric %s is not a gauge or counter", cfg.Name)
+		}
+	}
+	return total, nil
+}
+
+func hasLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+// Package cache holds values that are expensive to build, like the parsed profiles behind the embedded pprof UI.
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU is a least recently used cache bounded by the estimated size of its values.
+//
+// Entries belong to a group, e.g. a series, and a group holds a single entry : getting a new key of a group
+// replaces its previous entry, so that new data invalidates the values built from the old one.
+type LRU[V any] struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	// most recently used first
+	order   *list.List
+	entries map[string]*list.Element
+	groups  map[string]string
+}
+
+type entry[V any] struct {
+	key   string
+	group string
+	// set once built
+	size int64
+	// closed once value and err are set
+	ready chan struct{}
+	value V
+	err   error
+}
+
+// NewLRU returns a cache holding up to maxBytes, values larger than maxBytes are built but not kept
+func NewLRU[V any](maxBytes int64) *LRU[V] {
+	return &LRU[V]{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  map[string]*list.Element{},
+		groups:   map[string]string{},
+	}
+}
+
+// Get returns the value of key, built once by build, which also returns the estimated memory used by the value.
+// Concurrent gets of a key wait for the same build, failed builds aren't cached
+func (l *LRU[V]) Get(group, key string, build func() (V, int64, error)) (V, error) {
+	l.mu.Lock()
+	if elem, ok := l.entries[key]; ok {
+		l.order.MoveToFront(elem)
+		l.mu.Unlock()
+		e := elem.Value.(*entry[V])
+		<-e.ready
+		return e.value, e.err
+	}
+	if old, ok := l.groups[group]; ok {
+		l.remove(l.entries[old])
+	}
+	e := &entry[V]{key: key, group: group, ready: make(chan struct{})}
+	elem := l.order.PushFront(e)
+	l.entries[key] = elem
+	l.groups[group] = key
+	l.mu.Unlock()
+
+	value, size, err := build()
+	e.value, e.err = value, err
+	close(e.ready)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.entries[key] != elem {
+		// evicted or replaced while building
+		return e.value, e.err
+	}
+	// values larger than the cache aren't kept
+	if e.err != nil || size > l.maxBytes {
+		l.remove(elem)
+		return e.value, e.err
+	}
+	e.size = size
+	l.size += size
+	for l.size > l.maxBytes {
+		l.remove(l.order.Back())
+	}
+	return e.value, e.err
+}
+
+// Invalidate drops the entry of a group
+func (l *LRU[V]) Invalidate(group string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if key, ok := l.groups[group]; ok {
+		l.remove(l.entries[key])
+	}
+}
+
+// Len returns the number of entries
+func (l *LRU[V]) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Size returns the estimated size of the entries
+func (l *LRU[V]) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// remove drops an entry, the callers waiting for it still get its value
+func (l *LRU[V]) remove(elem *list.Element) {
+	e := elem.Value.(*entry[V])
+	l.order.Remove(elem)
+	delete(l.entries, e.key)
+	if l.groups[e.group] == e.key {
+		delete(l.groups, e.group)
+	}
+	l.size -= e.size
+}
@@ -0,0 +1,95 @@
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLRU(t *testing.T) {
+	l := cache.NewLRU[string](100)
+	builds := map[string]int{}
+	get := func(group, key string, size int64) string {
+		v, err := l.Get(group, key, func() (string, int64, error) {
+			builds[key]++
+			return "value-" + key, size, nil
+		})
+		require.NoError(t, err)
+		return v
+	}
+
+	assert.Equal(t, "value-a", get("a", "a", 40))
+	assert.Equal(t, "value-a", get("a", "a", 40))
+	assert.Equal(t, 1, builds["a"])
+
+	// b is evicted, as the least recently used
+	get("b", "b", 40)
+	get("a", "a", 40)
+	get("c", "c", 40)
+	assert.Equal(t, 2, l.Len())
+	assert.Equal(t, int64(80), l.Size())
+	get("a", "a", 40)
+	get("b", "b", 40)
+	assert.Equal(t, 1, builds["a"])
+	assert.Equal(t, 2, builds["b"])
+
+	// a new key replaces the entry of its group
+	get("a", "a2", 10)
+	assert.Equal(t, 2, l.Len())
+	get("a", "a", 40)
+	assert.Equal(t, 2, builds["a"])
+
+	l.Invalidate("a")
+	assert.Equal(t, 1, l.Len())
+	assert.Equal(t, int64(40), l.Size())
+
+	// values larger than the cache aren't cached
+	assert.Equal(t, "value-d", get("d", "d", 200))
+	get("d", "d", 200)
+	assert.Equal(t, 2, builds["d"])
+	assert.Equal(t, 1, l.Len())
+}
+
+func TestLRUErrors(t *testing.T) {
+	l := cache.NewLRU[int](100)
+	_, err := l.Get("a", "a", func() (int, int64, error) {
+		return 0, 10, errors.New("failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, l.Len())
+	assert.Equal(t, int64(0), l.Size())
+
+	v, err := l.Get("a", "a", func() (int, int64, error) {
+		return 1, 10, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, v)
+}
+
+func TestLRUConcurrentBuild(t *testing.T) {
+	l := cache.NewLRU[int](100)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := l.Get("a", "a", func() (int, int64, error) {
+				builds.Add(1)
+				<-release
+				return 1, 10, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, 1, v)
+		}()
+	}
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), builds.Load())
+}
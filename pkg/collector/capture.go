@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+// CaptureResult is the outcome of an on-demand capture for one monitor
+type CaptureResult struct {
+	Target   string            `json:"target"`
+	Labels   map[string]string `json:"labels"`
+	Artifact *storage.Artifact `json:"artifact,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Capture collects a profile of the given type and duration from every monitor whose labels match,
+// targets shared by several monitors are scraped once. Failures are reported per monitor.
+func (c *Collector) Capture(ctx context.Context, matchers []*labels.Matcher, profileType string, seconds int) ([]CaptureResult, error) {
+	c.lifecycleMu.Lock()
+	selected := map[*monitor.Monitor][]monitor.TargetStatus{}
+	for _, mon := range c.Monitors {
+		for _, status := range mon.Status() {
+			if labels.MatchesAll(matchers, status.Labels) {
+				selected[mon] = append(selected[mon], status)
+			}
+		}
+	}
+	c.lifecycleMu.Unlock()
+	if len(selected) == 0 {
+		return nil, ErrTargetNotFound
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	ret := []CaptureResult{}
+	for mon, statuses := range selected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			names := make([]string, 0, len(statuses))
+			for _, s := range statuses {
+				names = append(names, s.Name)
+			}
+			artifacts, err := mon.Capture(ctx, names, profileType, seconds, nil)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, s := range statuses {
+				res := CaptureResult{Target: s.Name, Labels: s.Labels}
+				if err != nil {
+					res.Error = err.Error()
+				} else if artifact, ok := artifacts[s.Name]; ok {
+					res.Artifact = &artifact
+				}
+				ret = append(ret, res)
+			}
+		}()
+	}
+	wg.Wait()
+	slices.SortFunc(ret, func(a, b CaptureResult) int {
+		return strings.Compare(a.Target, b.Target)
+	})
+	return ret, nil
+}
@@ -0,0 +1,67 @@
+package collector_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	heap := testdata.TestData("heap1.pb")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(heap)
+	}))
+	defer server.Close()
+
+	artifacts := storage.NewFileArtifactStore(t.TempDir(), []string{labels.NamespaceLabel}, nil)
+	c := collector.NewCollector(ctx, slog.Default(), &config.CollectorConfig{
+		Monitors: []*config.MonitorConfig{
+			monitorConfig("a", server.URL, "default", 60),
+			monitorConfig("b", server.URL+"/other", "kube-system", 60),
+			monitorConfig("c", server.URL+"/c", "default", 60),
+		},
+	}, storage.NewNoopStore(), artifacts)
+	require.NoError(t, c.Start(ctx))
+	defer c.Shutdown()
+
+	matcher, err := labels.NewMatcher(labels.MatchEqual, labels.NamespaceLabel, "default")
+	require.NoError(t, err)
+	results, err := c.Capture(ctx, []*labels.Matcher{matcher}, "heap", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for i, name := range []string{"a", "c"} {
+		assert.Equal(t, name, results[i].Target)
+		assert.Empty(t, results[i].Error)
+		require.NotNil(t, results[i].Artifact)
+		assert.Equal(t, "default/"+name+"/heap", results[i].Artifact.Key)
+	}
+	list, err := artifacts.ListArtifacts(monitor.CaptureKind)
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// failures are reported per target
+	results, err = c.Capture(ctx, []*labels.Matcher{matcher}, "unknown", 0)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.NotEmpty(t, results[0].Error)
+	assert.Nil(t, results[0].Artifact)
+
+	matcher, err = labels.NewMatcher(labels.MatchRegexp, labels.NamespaceLabel, "prod-.*")
+	require.NoError(t, err)
+	_, err = c.Capture(ctx, []*labels.Matcher{matcher}, "heap", 0)
+	assert.ErrorIs(t, err, collector.ErrTargetNotFound)
+}
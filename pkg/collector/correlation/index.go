@@ -0,0 +1,150 @@
+package correlation
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+const DefaultMaxIndexedValues = 100000
+
+var DefaultIndexedLabels = []string{
+	labels.TraceIDLabel,
+	labels.SpanIDLabel,
+	labels.SpanNameLabel,
+}
+
+// SeriesRef identifies a stored series, as accepted by storage.Store.Get
+type SeriesRef struct {
+	ProfileType string `json:"profileType"`
+	Key         string `json:"key"`
+}
+
+type labelValue struct {
+	label string
+	value string
+}
+
+// Index maps sample label values, like trace and span IDs, to the series containing samples with them
+type Index struct {
+	mu        sync.RWMutex
+	labels    []string
+	maxValues int
+	entries   map[labelValue]map[SeriesRef]struct{}
+	// insertion order of entries, used to evict the oldest values once maxValues is reached
+	order []labelValue
+}
+
+func NewIndex(indexedLabels []string, maxValues int) *Index {
+	if len(indexedLabels) == 0 {
+		indexedLabels = DefaultIndexedLabels
+	}
+	if maxValues <= 0 {
+		maxValues = DefaultMaxIndexedValues
+	}
+	return &Index{
+		labels:    indexedLabels,
+		maxValues: maxValues,
+		entries:   map[labelValue]map[SeriesRef]struct{}{},
+		order:     []labelValue{},
+	}
+}
+
+func (i *Index) Labels() []string {
+	return slices.Clone(i.labels)
+}
+
+func (i *Index) Add(ref SeriesRef, p *profile.Profile) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, s := range p.Sample {
+		for _, label := range i.labels {
+			for _, value := range s.Label[label] {
+				i.add(labelValue{label: label, value: value}, ref)
+			}
+		}
+	}
+}
+
+func (i *Index) add(lv labelValue, ref SeriesRef) {
+	refs, ok := i.entries[lv]
+	if !ok {
+		if len(i.order) >= i.maxValues {
+			oldest := i.order[0]
+			i.order = i.order[1:]
+			delete(i.entries, oldest)
+		}
+		refs = map[SeriesRef]struct{}{}
+		i.entries[lv] = refs
+		i.order = append(i.order, lv)
+	}
+	refs[ref] = struct{}{}
+}
+
+// Lookup returns the series containing samples with the given label value, sorted by profile type and key
+func (i *Index) Lookup(label, value string) []SeriesRef {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	ret := []SeriesRef{}
+	for ref := range i.entries[labelValue{label: label, value: value}] {
+		ret = append(ret, ref)
+	}
+	slices.SortFunc(ret, func(a, b SeriesRef) int {
+		if c := strings.Compare(a.ProfileType, b.ProfileType); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return ret
+}
+
+// Rebuild indexes every series already persisted in the store
+func (i *Index) Rebuild(logger *slog.Logger, store storage.Store) error {
+	keys, err := store.ListKeys()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, string(os.PathSeparator))
+		profileType, seriesKey, found := strings.Cut(key, string(os.PathSeparator))
+		if !found {
+			continue
+		}
+		filepaths, err := store.Get(profileType, seriesKey)
+		if err != nil {
+			return err
+		}
+		for _, fp := range filepaths {
+			data, err := os.ReadFile(fp)
+			if err != nil {
+				return err
+			}
+			p, err := profile.Parse(bytes.NewReader(data))
+			if err != nil {
+				logger.With("file", fp, "err", err).Debug("skipping unparseable profile")
+				continue
+			}
+			i.Add(SeriesRef{ProfileType: profileType, Key: seriesKey}, p)
+		}
+	}
+	logger.With("series", len(keys), "elapsed", time.Since(start)).Info("rebuilt correlation index")
+	return nil
+}
+
+// Filter returns a copy of the profile, only keeping samples with the given label value
+func Filter(p *profile.Profile, label, value string) *profile.Profile {
+	ret := p.Copy()
+	ret.FilterSamplesByTag(func(s *profile.Sample) bool {
+		return s.HasLabel(label, value)
+	}, nil)
+	return ret
+}
@@ -0,0 +1,54 @@
+package correlation_test
+
+import (
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/correlation"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/stretchr/testify/assert"
+)
+
+func testProfile(traceIDs ...string) *profile.Profile {
+	fn := &profile.Function{ID: 1, Name: "main"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Function:   []*profile.Function{fn},
+		Location:   []*profile.Location{loc},
+	}
+	for _, traceID := range traceIDs {
+		p.Sample = append(p.Sample, &profile.Sample{
+			Value:    []int64{1},
+			Location: []*profile.Location{loc},
+			Label:    map[string][]string{labels.TraceIDLabel: {traceID}},
+		})
+	}
+	return p
+}
+
+func TestIndex(t *testing.T) {
+	index := correlation.NewIndex(nil, 2)
+	a := correlation.SeriesRef{ProfileType: "profile", Key: "default/a/pod-a"}
+	b := correlation.SeriesRef{ProfileType: "profile", Key: "default/b/pod-b"}
+
+	index.Add(a, testProfile("t1", "t2"))
+	index.Add(b, testProfile("t1"))
+
+	assert.Equal(t, []correlation.SeriesRef{a, b}, index.Lookup(labels.TraceIDLabel, "t1"))
+	assert.Equal(t, []correlation.SeriesRef{a}, index.Lookup(labels.TraceIDLabel, "t2"))
+	assert.Empty(t, index.Lookup(labels.SpanIDLabel, "t1"))
+
+	// oldest values are evicted once the index is full
+	index.Add(b, testProfile("t3"))
+	assert.Empty(t, index.Lookup(labels.TraceIDLabel, "t1"))
+	assert.Equal(t, []correlation.SeriesRef{b}, index.Lookup(labels.TraceIDLabel, "t3"))
+}
+
+func TestFilter(t *testing.T) {
+	p := testProfile("t1", "t2", "t1")
+	filtered := correlation.Filter(p, labels.TraceIDLabel, "t1")
+	assert.Len(t, filtered.Sample, 2)
+	assert.Len(t, p.Sample, 3)
+	assert.NoError(t, filtered.CheckValid())
+}
@@ -0,0 +1,46 @@
+package correlation
+
+import (
+	"bytes"
+	"log/slog"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+// IndexedStore indexes the sample labels of every profile written to the underlying store
+type IndexedStore struct {
+	storage.Store
+	logger  *slog.Logger
+	indexBy []string
+	index   *Index
+}
+
+var _ storage.Store = (*IndexedStore)(nil)
+
+func NewIndexedStore(logger *slog.Logger, store storage.Store, indexBy []string, index *Index) *IndexedStore {
+	return &IndexedStore{
+		Store:   store,
+		logger:  logger,
+		indexBy: indexBy,
+		index:   index,
+	}
+}
+
+func (s *IndexedStore) Put(startTime, endTime time.Time, profileType string, key string, labels map[string]string, value []byte) error {
+	if err := s.Store.Put(startTime, endTime, profileType, key, labels, value); err != nil {
+		return err
+	}
+	seriesKey, err := storage.SeriesKey(s.indexBy, labels, key)
+	if err != nil {
+		return err
+	}
+	p, err := profile.Parse(bytes.NewReader(value))
+	if err != nil {
+		s.logger.With("profileType", profileType, "key", seriesKey, "err", err).Debug("not indexing unparseable profile")
+		return nil
+	}
+	s.index.Add(SeriesRef{ProfileType: profileType, Key: seriesKey}, p)
+	return nil
+}
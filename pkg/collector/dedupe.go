@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// targetKey identifies what a monitor scrapes and how : monitors with the same key only differ in where
+// their profiles are stored, and can share a single scraper
+func targetKey(cfg *config.MonitorConfig) string {
+	settings := *cfg
+	settings.Name = ""
+	settings.Labels = nil
+	settings.Endpoint = ""
+	data, err := json.Marshal(settings)
+	if err != nil {
+		// not expected for configs loaded from yaml, don't share the target
+		return cfg.Name + "|" + cfg.Endpoint
+	}
+	return strings.TrimSuffix(cfg.Endpoint, "/") + "|" + string(data)
+}
+
+// groupByTarget groups monitors that can share a single scraper, preserving the order of the configs.
+// Monitors of the same endpoint with different settings stay separate, their exclusive requests
+// are still coordinated through the scheduler.
+func groupByTarget(cfgs []*config.MonitorConfig) [][]*config.MonitorConfig {
+	groups := [][]*config.MonitorConfig{}
+	byKey := map[string]int{}
+	for _, cfg := range cfgs {
+		key := targetKey(cfg)
+		if i, ok := byKey[key]; ok {
+			groups[i] = append(groups[i], cfg)
+			continue
+		}
+		byKey[key] = len(groups)
+		groups = append(groups, []*config.MonitorConfig{cfg})
+	}
+	return groups
+}
@@ -0,0 +1,100 @@
+package collector_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type keyStore struct {
+	storage.NoopStore
+	mu   sync.Mutex
+	puts map[string]int
+}
+
+func (k *keyStore) Put(_, _ time.Time, _, key string, _ map[string]string, _ []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.puts[key]++
+	return nil
+}
+
+func (k *keyStore) get(key string) int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.puts[key]
+}
+
+func TestSharedTargets(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	heap := testdata.TestData("heap1.pb")
+	var heapRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debug/pprof/heap" {
+			heapRequests.Add(1)
+		}
+		w.Write(heap)
+	}))
+	defer server.Close()
+
+	sampling := config.GlobalSamplingConfig{
+		Heap: &config.SamplerConfig{IntervalSeconds: 1},
+	}
+	store := &keyStore{puts: map[string]int{}}
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	c := collector.NewCollector(ctx, slog.Default(), &config.CollectorConfig{
+		Monitors: []*config.MonitorConfig{
+			{
+				Name:           "a",
+				Endpoint:       server.URL,
+				Labels:         map[string]string{"__k8s_namespace": "ns-a"},
+				GlobalSampling: sampling,
+			},
+			{
+				Name:           "b",
+				Endpoint:       server.URL + "/",
+				Labels:         map[string]string{"__k8s_namespace": "ns-b"},
+				GlobalSampling: sampling,
+			},
+			{
+				Name:     "c",
+				Endpoint: server.URL,
+				GlobalSampling: config.GlobalSamplingConfig{
+					Goroutine: &config.SamplerConfig{IntervalSeconds: 1},
+				},
+			},
+		},
+	}, store, storage.NewNoopArtifactStore())
+	require.NoError(t, c.Start(ctx))
+
+	// a and b share a scraper, c has different settings
+	assert.Len(t, c.Monitors, 2)
+	targets := c.Targets()
+	require.Len(t, targets, 3)
+	assert.Equal(t, "a", targets[0].Name)
+	assert.Equal(t, "ns-a", targets[0].Labels["__k8s_namespace"])
+	assert.Equal(t, "b", targets[1].Name)
+	assert.Equal(t, "ns-b", targets[1].Labels["__k8s_namespace"])
+	assert.Equal(t, "c", targets[2].Name)
+
+	// every scrape of the shared target is stored for both monitors
+	assert.Eventually(t, func() bool {
+		return store.get("a") > 0 && store.get("c") > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, c.Shutdown())
+	assert.Equal(t, store.get("a"), store.get("b"))
+	assert.Equal(t, int32(store.get("a")), heapRequests.Load())
+}
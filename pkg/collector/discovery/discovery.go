@@ -0,0 +1,100 @@
+// Package discovery finds targets outside of Kubernetes and turns them into monitors
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// Meta labels set on discovered targets, only available during relabeling
+const (
+	DiscoveryNameLabel = relabel.MetaPrefix + "discovery_name"
+	FilePathLabel      = relabel.MetaPrefix + "filepath"
+	DNSNameLabel       = relabel.MetaPrefix + "dns_name"
+	DNSSrvTargetLabel  = relabel.MetaPrefix + "dns_srv_record_target"
+	DNSSrvPortLabel    = relabel.MetaPrefix + "dns_srv_record_port"
+)
+
+// Discoverer returns the current target groups of a source
+type Discoverer interface {
+	Discover(ctx context.Context) ([]config.TargetGroup, error)
+}
+
+type staticDiscoverer struct {
+	groups []config.TargetGroup
+}
+
+func NewStatic(groups []config.TargetGroup) Discoverer {
+	return &staticDiscoverer{groups: groups}
+}
+
+func (s *staticDiscoverer) Discover(_ context.Context) ([]config.TargetGroup, error) {
+	return s.groups, nil
+}
+
+// Discoverers returns the discoverers configured in cfg
+func Discoverers(cfg *config.DiscoveryConfig) []Discoverer {
+	ret := []Discoverer{}
+	if len(cfg.Static) > 0 {
+		ret = append(ret, NewStatic(cfg.Static))
+	}
+	if len(cfg.Files) > 0 {
+		ret = append(ret, NewFile(cfg.Files))
+	}
+	if cfg.DNS != nil {
+		ret = append(ret, NewDNS(*cfg.DNS, net.DefaultResolver))
+	}
+	return ret
+}
+
+// Monitors builds a monitor for each target of groups from the discovery's monitor template.
+// Targets default to the discovery's name as namespace and their host as name
+func Monitors(cfg *config.DiscoveryConfig, groups []config.TargetGroup) []*config.MonitorConfig {
+	scheme := cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	ret := []*config.MonitorConfig{}
+	seen := map[string]struct{}{}
+	for _, group := range groups {
+		for _, target := range group.Targets {
+			if target == "" {
+				continue
+			}
+			if _, ok := seen[target]; ok {
+				continue
+			}
+			seen[target] = struct{}{}
+			// targets must not share the slices and pointers of the template
+			mon := cfg.Monitor.DeepCopy()
+			// names are storage keys, they can't hold a path separator
+			mon.Name = fmt.Sprintf("%s-%s", cfg.Name, strings.ReplaceAll(target, "/", "_"))
+			mon.Endpoint = fmt.Sprintf("%s://%s", scheme, target)
+			lbls := map[string]string{
+				labels.NamespaceLabel: cfg.Name,
+				labels.NameLabel:      host(target),
+			}
+			maps.Copy(lbls, cfg.Monitor.Labels)
+			maps.Copy(lbls, group.Labels)
+			lbls[DiscoveryNameLabel] = cfg.Name
+			mon.Labels = lbls
+			ret = append(ret, mon)
+		}
+	}
+	return ret
+}
+
+func host(target string) string {
+	h, _, err := net.SplitHostPort(target)
+	if err != nil {
+		return target
+	}
+	return strings.TrimSuffix(h, ".")
+}
@@ -0,0 +1,244 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/discovery"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "a.json")
+	yamlFile := filepath.Join(dir, "b.yaml")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`[{"targets": ["10.0.0.1:6060"], "labels": {"env": "prod"}}]`), 0o644))
+	require.NoError(t, os.WriteFile(yamlFile, []byte("- targets: [\"10.0.0.2:6060\", \"10.0.0.3:6060\"]\n"), 0o644))
+
+	d := discovery.NewFile([]string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yaml")})
+	groups, err := d.Discover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{"10.0.0.1:6060"}, groups[0].Targets)
+	assert.Equal(t, "prod", groups[0].Labels["env"])
+	assert.Equal(t, jsonFile, groups[0].Labels[discovery.FilePathLabel])
+	assert.Equal(t, []string{"10.0.0.2:6060", "10.0.0.3:6060"}, groups[1].Targets)
+
+	// modified files are read again
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`[{"targets": ["10.0.0.4:6060", "10.0.0.5:6060"]}]`), 0o644))
+	groups, err = d.Discover(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.4:6060", "10.0.0.5:6060"}, groups[0].Targets)
+
+	// removed files remove their targets
+	require.NoError(t, os.Remove(yamlFile))
+	groups, err = d.Discover(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, groups, 1)
+
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{not valid`), 0o644))
+	_, err = d.Discover(context.Background())
+	assert.Error(t, err)
+}
+
+type fakeResolver struct {
+	srv map[string][]*net.SRV
+	ips map[string][]net.IP
+}
+
+func (f *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	records, ok := f.srv[name]
+	if !ok {
+		return "", nil, errors.New("no such host")
+	}
+	return name, records, nil
+}
+
+func (f *fakeResolver) LookupIP(_ context.Context, _, host string) ([]net.IP, error) {
+	ips, ok := f.ips[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return ips, nil
+}
+
+func TestDNS(t *testing.T) {
+	resolver := &fakeResolver{
+		srv: map[string][]*net.SRV{
+			"_pprof._tcp.example.com": {
+				{Target: "a.example.com.", Port: 6060},
+				{Target: "b.example.com.", Port: 6061},
+			},
+		},
+		ips: map[string][]net.IP{
+			"api.example.com": {net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")},
+		},
+	}
+
+	groups, err := discovery.NewDNS(config.DNSDiscoveryConfig{
+		Names: []string{"_pprof._tcp.example.com"},
+	}, resolver).Discover(context.Background())
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []string{"a.example.com:6060"}, groups[0].Targets)
+	assert.Equal(t, "a.example.com", groups[0].Labels[discovery.DNSSrvTargetLabel])
+	assert.Equal(t, "6061", groups[1].Labels[discovery.DNSSrvPortLabel])
+	assert.Equal(t, "_pprof._tcp.example.com", groups[1].Labels[discovery.DNSNameLabel])
+
+	groups, err = discovery.NewDNS(config.DNSDiscoveryConfig{
+		Names: []string{"api.example.com", "missing.example.com"},
+		Type:  config.DNSTypeA,
+		Port:  6060,
+	}, resolver).Discover(context.Background())
+	assert.ErrorContains(t, err, "missing.example.com")
+	require.Len(t, groups, 1)
+	assert.Equal(t, []string{"10.0.0.1:6060", "10.0.0.2:6060"}, groups[0].Targets)
+}
+
+func TestMonitors(t *testing.T) {
+	cfg := &config.DiscoveryConfig{
+		Name:   "vms",
+		Scheme: "https",
+		Monitor: config.MonitorConfig{
+			Labels: map[string]string{"team": "a"},
+			GlobalSampling: config.GlobalSamplingConfig{
+				Heap: &config.SamplerConfig{IntervalSeconds: 60},
+			},
+		},
+	}
+	mons := discovery.Monitors(cfg, []config.TargetGroup{
+		{Targets: []string{"host-1:6060", "host-2:6060"}},
+		{Targets: []string{"host-1:6060", "host-3:6060"}, Labels: map[string]string{"__k8s_name": "billing"}},
+	})
+	require.Len(t, mons, 3)
+	assert.Equal(t, "vms-host-1:6060", mons[0].Name)
+	assert.Equal(t, "https://host-1:6060", mons[0].Endpoint)
+	assert.Equal(t, map[string]string{
+		"__k8s_namespace":            "vms",
+		"__k8s_name":                 "host-1",
+		"team":                       "a",
+		discovery.DiscoveryNameLabel: "vms",
+	}, mons[0].Labels)
+	assert.NotNil(t, mons[0].GlobalSampling.Heap)
+	assert.Equal(t, "billing", mons[2].Labels["__k8s_name"])
+	// the template is not modified
+	assert.Equal(t, map[string]string{"team": "a"}, cfg.Monitor.Labels)
+}
+
+func TestMonitorsDeepCopy(t *testing.T) {
+	cfg := &config.DiscoveryConfig{
+		Name: "vms",
+		Monitor: config.MonitorConfig{
+			GlobalSampling: config.GlobalSamplingConfig{
+				Heap: &config.SamplerConfig{IntervalSeconds: 60},
+			},
+			Profiles: []config.ProfileSpec{{Name: "fgprof", Params: map[string]string{"format": "pprof"}}},
+			HTTPClient: config.HTTPClientConfig{
+				TLS: &config.TLSClientConfig{ServerName: "vms"},
+			},
+			Relabelings: []config.RelabelConfig{{SourceLabels: []string{"__address__"}, TargetLabel: "instance"}},
+		},
+	}
+	mons := discovery.Monitors(cfg, []config.TargetGroup{{Targets: []string{"host-1:6060", "host-2:6060"}}})
+	require.Len(t, mons, 2)
+	mons[0].GlobalSampling.Heap.IntervalSeconds = 10
+	mons[0].Profiles[0].Params["format"] = "text"
+	mons[0].HTTPClient.TLS.ServerName = "host-1"
+	mons[0].Relabelings[0].SourceLabels[0] = "__name__"
+
+	for _, mon := range []*config.MonitorConfig{&cfg.Monitor, mons[1]} {
+		assert.Equal(t, 60, mon.GlobalSampling.Heap.IntervalSeconds)
+		assert.Equal(t, "pprof", mon.Profiles[0].Params["format"])
+		assert.Equal(t, "vms", mon.HTTPClient.TLS.ServerName)
+		assert.Equal(t, "__address__", mon.Relabelings[0].SourceLabels[0])
+	}
+}
+
+func TestManager(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "targets.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[{"targets": ["host-1:6060"]}]`), 0o644))
+	ctx, ca := context.WithCancel(context.Background())
+	mgr := discovery.NewManager(slog.Default(), []*config.DiscoveryConfig{
+		{
+			Name:                   "static",
+			RefreshIntervalSeconds: 1,
+			Static:                 []config.TargetGroup{{Targets: []string{"host-0:6060"}}},
+		},
+		{
+			Name:                   "file",
+			RefreshIntervalSeconds: 1,
+			Files:                  []string{file},
+		},
+	})
+	mgr.Start(ctx)
+	defer func() {
+		ca()
+		mgr.Wait()
+	}()
+
+	names := func() []string {
+		ret := []string{}
+		for _, mon := range mgr.Monitors() {
+			ret = append(ret, mon.Name)
+		}
+		return ret
+	}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"static-host-0:6060", "file-host-1:6060"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+	<-mgr.Updates()
+
+	require.NoError(t, os.WriteFile(file, []byte(`[{"targets": ["host-2:6060"]}]`), 0o644))
+	select {
+	case <-mgr.Updates():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no update after the target file changed")
+	}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"static-host-0:6060", "file-host-2:6060"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFileWatch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "targets.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[{"targets": ["host-1:6060"]}]`), 0o644))
+	ctx, ca := context.WithCancel(context.Background())
+	mgr := discovery.NewManager(slog.Default(), []*config.DiscoveryConfig{
+		{
+			Name:                   "file",
+			RefreshIntervalSeconds: 3600,
+			Files:                  []string{filepath.Join(dir, "*.json")},
+		},
+	})
+	mgr.Start(ctx)
+	defer func() {
+		ca()
+		mgr.Wait()
+	}()
+	select {
+	case <-mgr.Updates():
+	case <-time.After(5 * time.Second):
+		t.Fatal("no initial update")
+	}
+
+	// edits and new files are picked up without waiting for the refresh
+	require.NoError(t, os.WriteFile(file, []byte(`[{"targets": ["host-2:6060", "host-3:6060"]}]`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "more.json"), []byte(`[{"targets": ["host-4:6060"]}]`), 0o644))
+	assert.Eventually(t, func() bool {
+		names := []string{}
+		for _, mon := range mgr.Monitors() {
+			names = append(names, mon.Name)
+		}
+		return assert.ObjectsAreEqual([]string{"file-host-4:6060", "file-host-2:6060", "file-host-3:6060"}, names)
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// Resolver is the subset of net.Resolver used by DNS discovery
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+	LookupIP(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+type dnsDiscoverer struct {
+	cfg      config.DNSDiscoveryConfig
+	resolver Resolver
+}
+
+func NewDNS(cfg config.DNSDiscoveryConfig, resolver Resolver) Discoverer {
+	return &dnsDiscoverer{
+		cfg:      cfg,
+		resolver: resolver,
+	}
+}
+
+// Discover looks up every name, names that fail to resolve are reported once all names were looked up
+func (d *dnsDiscoverer) Discover(ctx context.Context) ([]config.TargetGroup, error) {
+	ret := []config.TargetGroup{}
+	var errs []error
+	for _, name := range d.cfg.Names {
+		var (
+			groups []config.TargetGroup
+			err    error
+		)
+		switch d.cfg.RecordType() {
+		case config.DNSTypeSRV:
+			groups, err = d.srv(ctx, name)
+		case config.DNSTypeA:
+			groups, err = d.ip(ctx, "ip4", name)
+		case config.DNSTypeAAAA:
+			groups, err = d.ip(ctx, "ip6", name)
+		default:
+			err = fmt.Errorf("unsupported DNS record type %s", d.cfg.Type)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("resolving %s: %w", name, err))
+			continue
+		}
+		ret = append(ret, groups...)
+	}
+	return ret, errors.Join(errs...)
+}
+
+// srv returns a group per record, so that every target keeps its record's labels
+func (d *dnsDiscoverer) srv(ctx context.Context, name string) ([]config.TargetGroup, error) {
+	_, records, err := d.resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]config.TargetGroup, 0, len(records))
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		port := strconv.Itoa(int(record.Port))
+		ret = append(ret, config.TargetGroup{
+			Targets: []string{net.JoinHostPort(target, port)},
+			Labels: map[string]string{
+				DNSNameLabel:      name,
+				DNSSrvTargetLabel: target,
+				DNSSrvPortLabel:   port,
+			},
+		})
+	}
+	return ret, nil
+}
+
+func (d *dnsDiscoverer) ip(ctx context.Context, network, name string) ([]config.TargetGroup, error) {
+	ips, err := d.resolver.LookupIP(ctx, network, name)
+	if err != nil {
+		return nil, err
+	}
+	group := config.TargetGroup{
+		Labels: map[string]string{
+			DNSNameLabel: name,
+		},
+	}
+	for _, ip := range ips {
+		group.Targets = append(group.Targets, net.JoinHostPort(ip.String(), strconv.Itoa(d.cfg.Port)))
+	}
+	return []config.TargetGroup{group}, nil
+}
@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+type fileEntry struct {
+	modTime time.Time
+	size    int64
+	groups  []config.TargetGroup
+}
+
+// fileDiscoverer reads target groups from JSON or YAML files, files are only parsed again when they change.
+// It watches the directories of the files to pick up changes between refreshes
+type fileDiscoverer struct {
+	globs []string
+
+	mu    sync.Mutex
+	cache map[string]fileEntry
+
+	// set in Start
+	watcher *fsnotify.Watcher
+	done    chan struct{}
+}
+
+func NewFile(globs []string) Discoverer {
+	return &fileDiscoverer{
+		globs: globs,
+		cache: map[string]fileEntry{},
+	}
+}
+
+// Start watches the directories of the file globs until Stop, notify is called on every change in them.
+// Files are still read on every refresh, which catches up with directories created after Start
+func (f *fileDiscoverer) Start(ctx context.Context, notify func()) error {
+	dirs := map[string]struct{}{}
+	for _, glob := range f.globs {
+		// directories can be globs too
+		matches, err := filepath.Glob(filepath.Dir(glob))
+		if err != nil {
+			return fmt.Errorf("invalid file glob %s: %w", glob, err)
+		}
+		for _, dir := range matches {
+			dirs[dir] = struct{}{}
+		}
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("watching %s: %w", dir, err)
+		}
+	}
+	f.watcher = watcher
+	f.done = make(chan struct{})
+	go func() {
+		defer close(f.done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			// any change counts, mounted ConfigMaps are updated by swapping a symlink next to the files
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				notify()
+			// missed events are caught up on the next refresh
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop stops watching the directories
+func (f *fileDiscoverer) Stop() {
+	if f.watcher == nil {
+		return
+	}
+	f.watcher.Close()
+	<-f.done
+}
+
+func (f *fileDiscoverer) Discover(_ context.Context) ([]config.TargetGroup, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	paths := []string{}
+	for _, glob := range f.globs {
+		matches, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file glob %s: %w", glob, err)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	next := map[string]fileEntry{}
+	ret := []config.TargetGroup{}
+	for _, path := range paths {
+		if _, ok := next[path]; ok {
+			continue
+		}
+		entry, err := f.read(path)
+		if err != nil {
+			return nil, err
+		}
+		next[path] = entry
+		ret = append(ret, entry.groups...)
+	}
+	f.cache = next
+	return ret, nil
+}
+
+func (f *fileDiscoverer) read(path string) (fileEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileEntry{}, err
+	}
+	if cached, ok := f.cache[path]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileEntry{}, err
+	}
+	groups := []config.TargetGroup{}
+	// handles both JSON and YAML
+	if err := yaml.Unmarshal(data, &groups); err != nil {
+		return fileEntry{}, fmt.Errorf("parsing target file %s: %w", path, err)
+	}
+	for i := range groups {
+		lbls := map[string]string{}
+		for k, v := range groups[i].Labels {
+			lbls[k] = v
+		}
+		lbls[FilePathLabel] = path
+		groups[i].Labels = lbls
+	}
+	return fileEntry{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		groups:  groups,
+	}, nil
+}
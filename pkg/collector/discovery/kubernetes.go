@@ -0,0 +1,341 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8slabels "k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Pod annotations read by Kubernetes discovery
+const (
+	AnnotationPrefix = "profiling.cattle.io/"
+	// AnnotationScrape must be "true" for a pod to be profiled
+	AnnotationScrape = AnnotationPrefix + "scrape"
+	// AnnotationPort is a port number or container port name, it defaults to the pod's only container port
+	AnnotationPort = AnnotationPrefix + "port"
+	// AnnotationPath is prepended to the pprof paths, like /debug/pprof/heap
+	AnnotationPath   = AnnotationPrefix + "path"
+	AnnotationScheme = AnnotationPrefix + "scheme"
+	// AnnotationProfiles is a comma separated list of profile types, each optionally followed by its interval,
+	// like "heap=60s,profile,goroutine=30s". Types other than the built-in ones are scraped from /debug/pprof/<type>
+	AnnotationProfiles = AnnotationPrefix + "profiles"
+	// AnnotationInterval is the interval of the profiles listed without one
+	AnnotationInterval = AnnotationPrefix + "interval"
+	// AnnotationSeconds is the duration of CPU profiles and execution traces
+	AnnotationSeconds = AnnotationPrefix + "seconds"
+)
+
+// DefaultPodProfiles are collected from annotated pods when neither the pod nor the discovery's monitor template
+// enable any profile
+const DefaultPodProfiles = "profile,heap,goroutine"
+
+const DefaultPodProfileSeconds = 10
+
+// Meta labels set on discovered pods, only available during relabeling
+const (
+	metaKubernetesNamespace      = relabel.MetaPrefix + "kubernetes_namespace"
+	metaKubernetesPodName        = relabel.MetaPrefix + "kubernetes_pod_name"
+	metaKubernetesPodIP          = relabel.MetaPrefix + "kubernetes_pod_ip"
+	metaKubernetesPodNodeName    = relabel.MetaPrefix + "kubernetes_pod_node_name"
+	metaKubernetesPodLabel       = relabel.MetaPrefix + "kubernetes_pod_label_"
+	metaKubernetesPodAnnotation  = relabel.MetaPrefix + "kubernetes_pod_annotation_"
+	metaKubernetesControllerKind = relabel.MetaPrefix + "kubernetes_pod_controller_kind"
+	metaKubernetesControllerName = relabel.MetaPrefix + "kubernetes_pod_controller_name"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Kubernetes discovers the annotated pods of a cluster, watching pods so that changes are picked up
+// without waiting for the next refresh
+type Kubernetes struct {
+	cfg    *config.DiscoveryConfig
+	client kubernetes.Interface
+
+	factories []informers.SharedInformerFactory
+	listers   []corelisters.PodLister
+	synced    []cache.InformerSynced
+}
+
+func NewKubernetes(cfg *config.DiscoveryConfig, client kubernetes.Interface) *Kubernetes {
+	return &Kubernetes{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// NewKubernetesClient uses the in-cluster config, unless a kubeconfig is set
+func NewKubernetesClient(cfg *config.KubernetesDiscoveryConfig) (kubernetes.Interface, error) {
+	var (
+		restCfg *rest.Config
+		err     error
+	)
+	if cfg.Kubeconfig != "" {
+		restCfg, err = clientcmd.BuildConfigFromFlags("", cfg.Kubeconfig)
+	} else {
+		restCfg, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return kubernetes.NewForConfig(restCfg)
+}
+
+// Start watches pods until Stop, notify is called on every pod change
+func (k *Kubernetes) Start(ctx context.Context, notify func()) error {
+	selector, err := k8slabels.Parse(k.cfg.Kubernetes.Selector)
+	if err != nil {
+		return fmt.Errorf("invalid pod selector: %w", err)
+	}
+	namespaces := k.cfg.Kubernetes.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(_ interface{}) { notify() },
+		UpdateFunc: func(_, _ interface{}) { notify() },
+		DeleteFunc: func(_ interface{}) { notify() },
+	}
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(k.client, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = selector.String()
+			}),
+		)
+		pods := factory.Core().V1().Pods()
+		if _, err := pods.Informer().AddEventHandler(handler); err != nil {
+			return err
+		}
+		k.factories = append(k.factories, factory)
+		k.listers = append(k.listers, pods.Lister())
+		k.synced = append(k.synced, pods.Informer().HasSynced)
+		factory.Start(ctx.Done())
+	}
+	return nil
+}
+
+// Stop waits for the pod watches to stop, once the context passed to Start is done
+func (k *Kubernetes) Stop() {
+	for _, factory := range k.factories {
+		factory.Shutdown()
+	}
+}
+
+// Discover returns a monitor for every annotated pod, once the pods are synced
+func (k *Kubernetes) Discover(ctx context.Context) ([]*config.MonitorConfig, error) {
+	if len(k.listers) == 0 {
+		return nil, errors.New("pods are not watched")
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), k.synced...) {
+		return nil, errors.New("pods were not synced")
+	}
+	pods := []*corev1.Pod{}
+	for _, lister := range k.listers {
+		list, err := lister.List(k8slabels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		pods = append(pods, list...)
+	}
+	sort.Slice(pods, func(i, j int) bool {
+		if pods[i].Namespace != pods[j].Namespace {
+			return pods[i].Namespace < pods[j].Namespace
+		}
+		return pods[i].Name < pods[j].Name
+	})
+	ret := []*config.MonitorConfig{}
+	var errs []error
+	for _, pod := range pods {
+		if pod.Annotations[AnnotationScrape] != "true" {
+			continue
+		}
+		if pod.Status.PodIP == "" || pod.Status.Phase != corev1.PodRunning || pod.DeletionTimestamp != nil {
+			continue
+		}
+		mon, err := PodMonitor(k.cfg, pod)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("pod %s/%s: %w", pod.Namespace, pod.Name, err))
+			continue
+		}
+		ret = append(ret, mon)
+	}
+	// pods with invalid annotations are reported, without removing the other pods
+	if len(errs) > 0 {
+		return ret, errors.Join(errs...)
+	}
+	return ret, nil
+}
+
+// PodMonitor builds the monitor of an annotated pod from the discovery's monitor template, named
+// `<namespace>-<pod>`. Pods default to their namespace as namespace and their controller's name as name
+func PodMonitor(cfg *config.DiscoveryConfig, pod *corev1.Pod) (*config.MonitorConfig, error) {
+	port, err := podPort(pod)
+	if err != nil {
+		return nil, err
+	}
+	scheme := pod.Annotations[AnnotationScheme]
+	if scheme == "" {
+		scheme = cfg.Scheme
+	}
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := strings.TrimSuffix(pod.Annotations[AnnotationPath], "/")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	// podSampling edits the sampling configs, which must not be shared with the template
+	mon := cfg.Monitor.DeepCopy()
+	// pod names are only unique within their namespace
+	mon.Name = fmt.Sprintf("%s-%s", pod.Namespace, pod.Name)
+	mon.Endpoint = fmt.Sprintf("%s://%s%s", scheme, net.JoinHostPort(pod.Status.PodIP, strconv.Itoa(port)), path)
+	if err := podSampling(mon, pod.Annotations); err != nil {
+		return nil, err
+	}
+
+	controllerKind, controllerName := podController(pod)
+	lbls := map[string]string{
+		labels.NamespaceLabel: pod.Namespace,
+		labels.NameLabel:      controllerName,
+	}
+	maps.Copy(lbls, cfg.Monitor.Labels)
+	lbls[DiscoveryNameLabel] = cfg.Name
+	lbls[metaKubernetesNamespace] = pod.Namespace
+	lbls[metaKubernetesPodName] = pod.Name
+	lbls[metaKubernetesPodIP] = pod.Status.PodIP
+	lbls[metaKubernetesPodNodeName] = pod.Spec.NodeName
+	lbls[metaKubernetesControllerKind] = controllerKind
+	lbls[metaKubernetesControllerName] = controllerName
+	for k, v := range pod.Labels {
+		lbls[metaKubernetesPodLabel+invalidLabelChars.ReplaceAllString(k, "_")] = v
+	}
+	for k, v := range pod.Annotations {
+		lbls[metaKubernetesPodAnnotation+invalidLabelChars.ReplaceAllString(k, "_")] = v
+	}
+	mon.Labels = lbls
+	return mon, nil
+}
+
+func podPort(pod *corev1.Pod) (int, error) {
+	annotation := pod.Annotations[AnnotationPort]
+	if port, err := strconv.Atoi(annotation); err == nil {
+		return port, nil
+	}
+	ports := []corev1.ContainerPort{}
+	for _, container := range pod.Spec.Containers {
+		ports = append(ports, container.Ports...)
+	}
+	if annotation == "" {
+		if len(ports) != 1 {
+			return 0, fmt.Errorf("%s is required for pods with %d container ports", AnnotationPort, len(ports))
+		}
+		return int(ports[0].ContainerPort), nil
+	}
+	for _, port := range ports {
+		if port.Name == annotation {
+			return int(port.ContainerPort), nil
+		}
+	}
+	return 0, fmt.Errorf("no container port named %s", annotation)
+}
+
+// podSampling replaces the template's profiles with the pod's annotated profiles, when set
+func podSampling(mon *config.MonitorConfig, annotations map[string]string) error {
+	profiles, ok := annotations[AnnotationProfiles]
+	if !ok {
+		if mon.GlobalSampling != (config.GlobalSamplingConfig{}) || len(mon.Profiles) > 0 {
+			return nil
+		}
+		profiles = DefaultPodProfiles
+	}
+	interval, err := annotationSeconds(annotations[AnnotationInterval])
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", AnnotationInterval, err)
+	}
+	seconds := DefaultPodProfileSeconds
+	if s, ok := annotations[AnnotationSeconds]; ok {
+		seconds, err = annotationSeconds(s)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", AnnotationSeconds, err)
+		}
+	}
+
+	mon.GlobalSampling = config.GlobalSamplingConfig{}
+	mon.Profiles = nil
+	for _, entry := range strings.Split(profiles, ",") {
+		name, value, hasInterval := strings.Cut(strings.TrimSpace(entry), "=")
+		if name == "" {
+			continue
+		}
+		sampler := config.SamplerConfig{IntervalSeconds: interval}
+		if hasInterval {
+			sampler.IntervalSeconds, err = annotationSeconds(value)
+			if err != nil {
+				return fmt.Errorf("invalid interval for profile %s: %w", name, err)
+			}
+		}
+		if name == "profile" || name == "trace" {
+			sampler.Seconds = seconds
+		}
+		if mon.GlobalSampling.SetSampler(name, &sampler) {
+			continue
+		}
+		spec := config.ProfileSpec{Name: name, SamplerConfig: sampler}
+		if err := spec.Validate(); err != nil {
+			return err
+		}
+		mon.Profiles = append(mon.Profiles, spec)
+	}
+	return nil
+}
+
+// annotationSeconds parses a duration, like 30s, or a number of seconds
+func annotationSeconds(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	return int(d.Seconds()), nil
+}
+
+// podController returns the kind and name of the workload owning the pod, the deployment of pods owned by a
+// replica set, or the pod itself
+func podController(pod *corev1.Pod) (string, string) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "Pod", pod.Name
+	}
+	if hash, ok := pod.Labels["pod-template-hash"]; ok && owner.Kind == "ReplicaSet" {
+		if name, ok := strings.CutSuffix(owner.Name, "-"+hash); ok {
+			return "Deployment", name
+		}
+	}
+	return owner.Kind, owner.Name
+}
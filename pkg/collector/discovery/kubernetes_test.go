@@ -0,0 +1,168 @@
+package discovery_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/discovery"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func pod(name string, annotations map[string]string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Labels:      map[string]string{"app": "api", "pod-template-hash": "5d8f9"},
+			Annotations: annotations,
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "api-5d8f9", Controller: lo.ToPtr(true)},
+			},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node-1",
+			Containers: []corev1.Container{
+				{Name: "api", Ports: []corev1.ContainerPort{{Name: "pprof", ContainerPort: 6060}}},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+			PodIP: "10.42.0.12",
+		},
+	}
+}
+
+func TestPodMonitor(t *testing.T) {
+	cfg := &config.DiscoveryConfig{
+		Name: "pods",
+		Monitor: config.MonitorConfig{
+			Labels: map[string]string{"cluster": "a"},
+		},
+	}
+
+	mon, err := discovery.PodMonitor(cfg, pod("api-5d8f9-abcde", map[string]string{
+		discovery.AnnotationScrape: "true",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "default-api-5d8f9-abcde", mon.Name)
+	assert.Equal(t, "http://10.42.0.12:6060", mon.Endpoint)
+	assert.Equal(t, "default", mon.Labels["__k8s_namespace"])
+	assert.Equal(t, "api", mon.Labels["__k8s_name"])
+	assert.Equal(t, "a", mon.Labels["cluster"])
+	assert.Equal(t, "Deployment", mon.Labels["__meta_kubernetes_pod_controller_kind"])
+	assert.Equal(t, "api", mon.Labels["__meta_kubernetes_pod_label_app"])
+	assert.Equal(t, "node-1", mon.Labels["__meta_kubernetes_pod_node_name"])
+	assert.Equal(t, "true", mon.Labels["__meta_kubernetes_pod_annotation_profiling_cattle_io_scrape"])
+	// default profiles
+	require.NotNil(t, mon.GlobalSampling.Profile)
+	assert.Equal(t, discovery.DefaultPodProfileSeconds, mon.GlobalSampling.Profile.Seconds)
+	assert.NotNil(t, mon.GlobalSampling.Heap)
+	assert.NotNil(t, mon.GlobalSampling.Goroutine)
+	assert.Nil(t, mon.GlobalSampling.Allocs)
+
+	mon, err = discovery.PodMonitor(cfg, pod("api-5d8f9-abcde", map[string]string{
+		discovery.AnnotationScrape:   "true",
+		discovery.AnnotationPort:     "pprof",
+		discovery.AnnotationPath:     "admin",
+		discovery.AnnotationScheme:   "https",
+		discovery.AnnotationProfiles: "heap=2m, profile, fgprof=30",
+		discovery.AnnotationInterval: "60",
+		discovery.AnnotationSeconds:  "20s",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.42.0.12:6060/admin", mon.Endpoint)
+	assert.Equal(t, &config.SamplerConfig{IntervalSeconds: 120}, mon.GlobalSampling.Heap)
+	assert.Equal(t, &config.SamplerConfig{Seconds: 20, IntervalSeconds: 60}, mon.GlobalSampling.Profile)
+	assert.Nil(t, mon.GlobalSampling.Goroutine)
+	require.Len(t, mon.Profiles, 1)
+	assert.Equal(t, "fgprof", mon.Profiles[0].Name)
+	assert.Equal(t, 30, mon.Profiles[0].IntervalSeconds)
+
+	_, err = discovery.PodMonitor(cfg, pod("api-5d8f9-abcde", map[string]string{
+		discovery.AnnotationScrape: "true",
+		discovery.AnnotationPort:   "metrics",
+	}))
+	assert.ErrorContains(t, err, "no container port named metrics")
+
+	_, err = discovery.PodMonitor(cfg, pod("api-5d8f9-abcde", map[string]string{
+		discovery.AnnotationScrape:   "true",
+		discovery.AnnotationProfiles: "heap=soon",
+	}))
+	assert.Error(t, err)
+}
+
+func TestKubernetes(t *testing.T) {
+	ctx, ca := context.WithCancel(context.Background())
+	unannotated := pod("other", nil)
+	unannotated.Namespace = "other"
+	client := fake.NewSimpleClientset(
+		pod("api-1", map[string]string{discovery.AnnotationScrape: "true"}),
+		unannotated,
+	)
+	k := discovery.NewKubernetes(&config.DiscoveryConfig{
+		Name:       "pods",
+		Kubernetes: &config.KubernetesDiscoveryConfig{},
+	}, client)
+	changes := make(chan struct{}, 10)
+	require.NoError(t, k.Start(ctx, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}))
+	defer func() {
+		ca()
+		k.Stop()
+	}()
+
+	names := func() []string {
+		mons, err := k.Discover(ctx)
+		require.NoError(t, err)
+		return lo.Map(mons, func(mon *config.MonitorConfig, _ int) string { return mon.Name })
+	}
+	assert.Equal(t, []string{"default-api-1"}, names())
+
+	_, err := client.CoreV1().Pods("default").Create(ctx, pod("api-2", map[string]string{discovery.AnnotationScrape: "true"}), metav1.CreateOptions{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"default-api-1", "default-api-2"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NotEmpty(t, changes)
+
+	require.NoError(t, client.CoreV1().Pods("default").Delete(ctx, "api-1", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"default-api-2"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestKubernetesNamespaces(t *testing.T) {
+	ctx, ca := context.WithCancel(context.Background())
+	// the pods of StatefulSets share their names across namespaces
+	other := pod("db-0", map[string]string{discovery.AnnotationScrape: "true"})
+	other.Namespace = "other"
+	client := fake.NewSimpleClientset(
+		pod("db-0", map[string]string{discovery.AnnotationScrape: "true"}),
+		other,
+	)
+	k := discovery.NewKubernetes(&config.DiscoveryConfig{
+		Name:       "pods",
+		Kubernetes: &config.KubernetesDiscoveryConfig{},
+	}, client)
+	require.NoError(t, k.Start(ctx, func() {}))
+	defer func() {
+		ca()
+		k.Stop()
+	}()
+
+	mons, err := k.Discover(ctx)
+	require.NoError(t, err)
+	names := lo.Map(mons, func(mon *config.MonitorConfig, _ int) string { return mon.Name })
+	assert.ElementsMatch(t, []string{"default-db-0", "other-db-0"}, names)
+}
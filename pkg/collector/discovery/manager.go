@@ -0,0 +1,201 @@
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// Manager periodically runs the discoverers of every discovery config, and signals on Updates
+// whenever the discovered monitors change
+type Manager struct {
+	logger *slog.Logger
+	cfgs   []*config.DiscoveryConfig
+
+	mu       sync.Mutex
+	monitors [][]*config.MonitorConfig
+	updates  chan struct{}
+	wg       sync.WaitGroup
+}
+
+func NewManager(logger *slog.Logger, cfgs []*config.DiscoveryConfig) *Manager {
+	return &Manager{
+		logger:   logger.With("component", "discovery"),
+		cfgs:     cfgs,
+		monitors: make([][]*config.MonitorConfig, len(cfgs)),
+		updates:  make(chan struct{}, 1),
+	}
+}
+
+// Start runs every discovery until ctx is done
+func (m *Manager) Start(ctx context.Context) {
+	for i, cfg := range m.cfgs {
+		if err := cfg.Validate(); err != nil {
+			m.logger.With("err", err).Error("skipping invalid discovery")
+			continue
+		}
+		srcs, err := sources(cfg)
+		if err != nil {
+			m.logger.With("discovery", cfg.Name, "err", err).Error("skipping discovery")
+			continue
+		}
+		m.wg.Add(1)
+		go func() {
+			defer m.wg.Done()
+			m.run(ctx, i, cfg, srcs)
+		}()
+	}
+}
+
+// Wait returns once every discovery stopped
+func (m *Manager) Wait() {
+	m.wg.Wait()
+}
+
+// Updates receives a value when Monitors changed, updates are coalesced
+func (m *Manager) Updates() <-chan struct{} {
+	return m.updates
+}
+
+// Monitors returns the monitors of every discovered target
+func (m *Manager) Monitors() []*config.MonitorConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := []*config.MonitorConfig{}
+	for _, mons := range m.monitors {
+		ret = append(ret, mons...)
+	}
+	return ret
+}
+
+// source discovers monitors, sources that watch their targets also implement watcher
+type source interface {
+	Discover(ctx context.Context) ([]*config.MonitorConfig, error)
+}
+
+type watcher interface {
+	Start(ctx context.Context, notify func()) error
+	Stop()
+}
+
+// groupSource turns the target groups of a Discoverer into monitors
+type groupSource struct {
+	cfg        *config.DiscoveryConfig
+	discoverer Discoverer
+}
+
+func (g *groupSource) Discover(ctx context.Context) ([]*config.MonitorConfig, error) {
+	groups, err := g.discoverer.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Monitors(g.cfg, groups), nil
+}
+
+// watchedGroupSource is a groupSource whose Discoverer watches its targets
+type watchedGroupSource struct {
+	*groupSource
+	watcher
+}
+
+func sources(cfg *config.DiscoveryConfig) ([]source, error) {
+	ret := []source{}
+	for _, d := range Discoverers(cfg) {
+		src := &groupSource{cfg: cfg, discoverer: d}
+		if w, ok := d.(watcher); ok {
+			ret = append(ret, &watchedGroupSource{groupSource: src, watcher: w})
+			continue
+		}
+		ret = append(ret, src)
+	}
+	if cfg.Kubernetes != nil {
+		client, err := NewKubernetesClient(cfg.Kubernetes)
+		if err != nil {
+			return nil, fmt.Errorf("creating kubernetes client: %w", err)
+		}
+		ret = append(ret, NewKubernetes(cfg, client))
+	}
+	return ret, nil
+}
+
+func (m *Manager) run(ctx context.Context, idx int, cfg *config.DiscoveryConfig, srcs []source) {
+	logger := m.logger.With("discovery", cfg.Name)
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	for _, src := range srcs {
+		if w, ok := src.(watcher); ok {
+			if err := w.Start(ctx, notify); err != nil {
+				logger.With("err", err).Error("failed to start watching targets")
+				continue
+			}
+			defer w.Stop()
+		}
+	}
+	// last successful result of each source, kept when a refresh fails
+	results := make([][]*config.MonitorConfig, len(srcs))
+	ticker := time.NewTicker(cfg.RefreshInterval())
+	defer ticker.Stop()
+	for {
+		for i, src := range srcs {
+			mons, err := src.Discover(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			// sources can return the targets they could discover along with an error
+			if err != nil && mons == nil {
+				logger.With("err", err).Warn("discovery failed, keeping previous targets")
+				continue
+			}
+			if err != nil {
+				logger.With("err", err).Warn("skipping invalid targets")
+			}
+			results[i] = mons
+		}
+		all := []*config.MonitorConfig{}
+		seen := map[string]struct{}{}
+		for _, mons := range results {
+			for _, mon := range mons {
+				if _, ok := seen[mon.Name]; ok {
+					continue
+				}
+				seen[mon.Name] = struct{}{}
+				all = append(all, mon)
+			}
+		}
+		m.set(logger, idx, all)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-changed:
+		}
+	}
+}
+
+func (m *Manager) set(logger *slog.Logger, idx int, mons []*config.MonitorConfig) {
+	m.mu.Lock()
+	changed := !reflect.DeepEqual(m.monitors[idx], mons)
+	if changed {
+		m.monitors[idx] = mons
+	}
+	m.mu.Unlock()
+	if !changed {
+		return
+	}
+	logger.With("targets", len(mons)).Info("discovered targets changed")
+	select {
+	case m.updates <- struct{}{}:
+	default:
+	}
+}
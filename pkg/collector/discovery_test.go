@@ -0,0 +1,72 @@
+package collector_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveredTargets(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	discoveryCfg := func(targets ...string) []*config.DiscoveryConfig {
+		return []*config.DiscoveryConfig{
+			{
+				Name:                   "vms",
+				RefreshIntervalSeconds: 1,
+				Static:                 []config.TargetGroup{{Targets: targets, Labels: map[string]string{"env": "prod"}}},
+				Monitor: config.MonitorConfig{
+					GlobalSampling: config.GlobalSamplingConfig{
+						Heap: &config.SamplerConfig{IntervalSeconds: 60},
+					},
+				},
+			},
+		}
+	}
+	c := collector.NewCollector(ctx, slog.Default(), &config.CollectorConfig{
+		Monitors:  []*config.MonitorConfig{monitorConfig("static", "http://localhost:6081", "default", 60)},
+		Discovery: discoveryCfg("localhost:6082"),
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore())
+	require.NoError(t, c.Start(ctx))
+	defer c.Shutdown()
+
+	names := func() []string {
+		ret := []string{}
+		for _, target := range c.Targets() {
+			ret = append(ret, target.Name)
+		}
+		return ret
+	}
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"static", "vms-localhost:6082"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+	targets := c.Targets()
+	assert.Equal(t, "vms", targets[1].Labels["__k8s_namespace"])
+	assert.Equal(t, "localhost", targets[1].Labels["__k8s_name"])
+	assert.Equal(t, "prod", targets[1].Labels["env"])
+	// meta labels are only available during relabeling
+	assert.NotContains(t, targets[1].Labels, "__meta_discovery_name")
+
+	_, err := c.Reload(&config.CollectorConfig{
+		Monitors:  []*config.MonitorConfig{monitorConfig("static", "http://localhost:6081", "default", 60)},
+		Discovery: discoveryCfg("localhost:6083"),
+	})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"static", "vms-localhost:6083"}, names())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = c.Reload(&config.CollectorConfig{
+		Monitors: []*config.MonitorConfig{monitorConfig("static", "http://localhost:6081", "default", 60)},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"static"}, names())
+}
@@ -0,0 +1,198 @@
+// Package exectrace summarizes Go execution traces, as produced by runtime/trace
+package exectrace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"time"
+
+	"golang.org/x/exp/trace"
+)
+
+// ArtifactKind is the kind execution traces are stored under in the artifact store
+const ArtifactKind = "trace"
+
+var headerRegex = regexp.MustCompile(`^go 1\.\d+ trace\x00\x00\x00`)
+
+// Validate checks that data starts with an execution trace header, without parsing the trace itself.
+// Traces from Go versions the parser doesn't support yet are valid, they can still be opened with `go tool trace`.
+func Validate(data []byte) error {
+	if !headerRegex.Match(data) {
+		return fmt.Errorf("invalid execution trace header")
+	}
+	return nil
+}
+
+type GoroutineSummary struct {
+	ID int64 `json:"id"`
+	// StartFunc is the outermost function of the goroutine's stack
+	StartFunc string        `json:"start_func"`
+	Running   time.Duration `json:"running"`
+	Runnable  time.Duration `json:"runnable"`
+	Waiting   time.Duration `json:"waiting"`
+	Syscall   time.Duration `json:"syscall"`
+}
+
+type RegionSummary struct {
+	Name  string        `json:"name"`
+	Count int           `json:"count"`
+	Total time.Duration `json:"total"`
+}
+
+type Summary struct {
+	Duration    time.Duration  `json:"duration"`
+	Events      int            `json:"events"`
+	EventCounts map[string]int `json:"event_counts"`
+	GCs         int            `json:"gcs"`
+	Goroutines  int            `json:"goroutines"`
+	Tasks       int            `json:"tasks"`
+	Logs        int            `json:"logs"`
+	// TopGoroutines are the goroutines that ran the longest
+	TopGoroutines []GoroutineSummary `json:"top_goroutines"`
+	Regions       []RegionSummary    `json:"regions"`
+}
+
+type goroutineState struct {
+	summary GoroutineSummary
+	state   trace.GoState
+	since   trace.Time
+}
+
+func (g *goroutineState) advance(to trace.GoState, now trace.Time) {
+	elapsed := now.Sub(g.since)
+	switch g.state {
+	case trace.GoRunning:
+		g.summary.Running += elapsed
+	case trace.GoRunnable:
+		g.summary.Runnable += elapsed
+	case trace.GoWaiting:
+		g.summary.Waiting += elapsed
+	case trace.GoSyscall:
+		g.summary.Syscall += elapsed
+	}
+	g.state = to
+	g.since = now
+}
+
+type openRegion struct {
+	name  string
+	start trace.Time
+}
+
+// Summarize reads a whole execution trace, keeping the topN goroutines that ran the longest
+func Summarize(r io.Reader, topN int) (*Summary, error) {
+	reader, err := trace.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid execution trace: %w", err)
+	}
+	summary := &Summary{
+		EventCounts: map[string]int{},
+	}
+	goroutines := map[trace.GoID]*goroutineState{}
+	regions := map[string]*RegionSummary{}
+	openRegions := map[trace.GoID][]openRegion{}
+	var first, last trace.Time
+	for {
+		ev, err := reader.ReadEvent()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if summary.Events == 0 {
+			first = ev.Time()
+		}
+		last = ev.Time()
+		summary.Events++
+		summary.EventCounts[ev.Kind().String()]++
+
+		switch ev.Kind() {
+		case trace.EventStateTransition:
+			st := ev.StateTransition()
+			if st.Resource.Kind != trace.ResourceGoroutine {
+				continue
+			}
+			id := st.Resource.Goroutine()
+			from, to := st.Goroutine()
+			g, ok := goroutines[id]
+			if !ok {
+				g = &goroutineState{
+					summary: GoroutineSummary{ID: int64(id)},
+					state:   from,
+					since:   ev.Time(),
+				}
+				goroutines[id] = g
+			}
+			if g.summary.StartFunc == "" {
+				st.Stack.Frames(func(f trace.StackFrame) bool {
+					g.summary.StartFunc = f.Func
+					return true
+				})
+			}
+			g.advance(to, ev.Time())
+		case trace.EventRangeBegin:
+			if ev.Range().Name == "GC concurrent mark phase" {
+				summary.GCs++
+			}
+		case trace.EventTaskBegin:
+			summary.Tasks++
+		case trace.EventLog:
+			summary.Logs++
+		case trace.EventRegionBegin:
+			openRegions[ev.Goroutine()] = append(openRegions[ev.Goroutine()], openRegion{
+				name:  ev.Region().Type,
+				start: ev.Time(),
+			})
+		case trace.EventRegionEnd:
+			open := openRegions[ev.Goroutine()]
+			if len(open) == 0 {
+				// region started before the trace
+				continue
+			}
+			region := open[len(open)-1]
+			openRegions[ev.Goroutine()] = open[:len(open)-1]
+			rs, ok := regions[region.name]
+			if !ok {
+				rs = &RegionSummary{Name: region.name}
+				regions[region.name] = rs
+			}
+			rs.Count++
+			rs.Total += ev.Time().Sub(region.start)
+		}
+	}
+	summary.Duration = last.Sub(first)
+	summary.Goroutines = len(goroutines)
+
+	all := make([]GoroutineSummary, 0, len(goroutines))
+	for _, g := range goroutines {
+		g.advance(g.state, last)
+		all = append(all, g.summary)
+	}
+	slices.SortFunc(all, func(a, b GoroutineSummary) int {
+		if a.Running != b.Running {
+			return int(b.Running - a.Running)
+		}
+		return int(a.ID - b.ID)
+	})
+	if topN > 0 && len(all) > topN {
+		all = all[:topN]
+	}
+	summary.TopGoroutines = all
+
+	summary.Regions = []RegionSummary{}
+	for _, rs := range regions {
+		summary.Regions = append(summary.Regions, *rs)
+	}
+	slices.SortFunc(summary.Regions, func(a, b RegionSummary) int {
+		if a.Total != b.Total {
+			return int(b.Total - a.Total)
+		}
+		return bytes.Compare([]byte(a.Name), []byte(b.Name))
+	})
+	return summary, nil
+}
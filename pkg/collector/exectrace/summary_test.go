@@ -0,0 +1,36 @@
+package exectrace_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	data := testdata.TestData("go122.trace")
+	require.NoError(t, exectrace.Validate(data))
+	summary, err := exectrace.Summarize(bytes.NewReader(data), 3)
+	require.NoError(t, err)
+	assert.Greater(t, summary.Duration, time.Duration(0))
+	assert.Equal(t, 89, summary.Events)
+	assert.Equal(t, 9, summary.Goroutines)
+	assert.Equal(t, 1, summary.Tasks)
+	assert.Equal(t, 1, summary.Logs)
+	require.Len(t, summary.TopGoroutines, 3)
+	assert.Equal(t, "main.main", summary.TopGoroutines[0].StartFunc)
+	assert.GreaterOrEqual(t, summary.TopGoroutines[0].Running, summary.TopGoroutines[1].Running)
+	require.Len(t, summary.Regions, 2)
+	assert.Equal(t, "region0", summary.Regions[0].Name)
+	assert.Equal(t, 1, summary.Regions[0].Count)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, exectrace.Validate([]byte("go 1.26 trace\x00\x00\x00\x01")))
+	assert.Error(t, exectrace.Validate([]byte("<html>not a trace</html>")))
+	assert.Error(t, exectrace.Validate(nil))
+}
@@ -0,0 +1,138 @@
+// Package folded converts between pprof profiles and Brendan Gregg's folded (collapsed) stack format:
+//
+//	root;caller;leaf 42
+//
+// with one stack per line, frames ordered from the root and the sample value last.
+package folded
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Parse builds a profile with a single sample type from folded stacks.
+// Blank lines and lines starting with '#' are ignored.
+func Parse(r io.Reader, sampleType profile.ValueType) (*profile.Profile, error) {
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{&sampleType},
+		PeriodType: &profile.ValueType{Type: sampleType.Type, Unit: sampleType.Unit},
+		Period:     1,
+		TimeNanos:  time.Now().UnixNano(),
+	}
+	locations := map[string]*profile.Location{}
+	location := func(name string) *profile.Location {
+		if loc, ok := locations[name]; ok {
+			return loc
+		}
+		fn := &profile.Function{
+			ID:         uint64(len(p.Function) + 1),
+			Name:       name,
+			SystemName: name,
+		}
+		p.Function = append(p.Function, fn)
+		loc := &profile.Location{
+			ID:   uint64(len(p.Location) + 1),
+			Line: []profile.Line{{Function: fn}},
+		}
+		locations[name] = loc
+		p.Location = append(p.Location, loc)
+		return loc
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sep := strings.LastIndexAny(line, " \t")
+		if sep < 0 {
+			return nil, fmt.Errorf("line %d: missing sample value", lineNo)
+		}
+		value, err := strconv.ParseInt(line[sep+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid sample value: %w", lineNo, err)
+		}
+		stack := strings.TrimSpace(line[:sep])
+		if stack == "" {
+			return nil, fmt.Errorf("line %d: empty stack", lineNo)
+		}
+		frames := strings.Split(stack, ";")
+		sample := &profile.Sample{
+			Value:    []int64{value},
+			Location: make([]*profile.Location, 0, len(frames)),
+		}
+		// pprof locations are ordered from the leaf
+		for i := len(frames) - 1; i >= 0; i-- {
+			sample.Location = append(sample.Location, location(frames[i]))
+		}
+		p.Sample = append(p.Sample, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.CheckValid(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Write outputs the given sample index of the profile as folded stacks, aggregating identical stacks
+// and sorting them lexicographically.
+func Write(w io.Writer, p *profile.Profile, sampleIndex int) error {
+	if sampleIndex < 0 || sampleIndex >= len(p.SampleType) {
+		return fmt.Errorf("sample index %d out of range", sampleIndex)
+	}
+	totals := map[string]int64{}
+	for _, s := range p.Sample {
+		frames := []string{}
+		for _, loc := range s.Location {
+			// lines of a location are ordered from the innermost inlined frame
+			for _, line := range loc.Line {
+				frames = append(frames, frameName(loc, line))
+			}
+			if len(loc.Line) == 0 {
+				frames = append(frames, fmt.Sprintf("0x%x", loc.Address))
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		slices.Reverse(frames)
+		totals[strings.Join(frames, ";")] += s.Value[sampleIndex]
+	}
+
+	stacks := make([]string, 0, len(totals))
+	for stack, total := range totals {
+		if total == 0 {
+			continue
+		}
+		stacks = append(stacks, stack)
+	}
+	slices.Sort(stacks)
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", stack, totals[stack]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func frameName(loc *profile.Location, line profile.Line) string {
+	if line.Function == nil || line.Function.Name == "" {
+		return fmt.Sprintf("0x%x", loc.Address)
+	}
+	// ';' separates frames
+	return strings.ReplaceAll(line.Function.Name, ";", ":")
+}
@@ -0,0 +1,69 @@
+package folded_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/folded"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		"main;handler;json.Marshal 30",
+		"main;handler 10",
+		"",
+		"main;handler;json.Marshal 12",
+		"java.lang.Thread.run;com.example.Worker.process(Worker.java:42) 5",
+	}, "\n")
+
+	p, err := folded.Parse(strings.NewReader(input), profile.ValueType{Type: "cpu", Unit: "nanoseconds"})
+	assert.NoError(t, err)
+	assert.NoError(t, p.CheckValid())
+	assert.Len(t, p.Sample, 4)
+	assert.Equal(t, "json.Marshal", p.Sample[0].Location[0].Line[0].Function.Name)
+
+	b := bytes.NewBuffer([]byte{})
+	assert.NoError(t, folded.Write(b, p, 0))
+	assert.Equal(t, strings.Join([]string{
+		"java.lang.Thread.run;com.example.Worker.process(Worker.java:42) 5",
+		"main;handler 10",
+		"main;handler;json.Marshal 42",
+		"",
+	}, "\n"), b.String())
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"main;handler",
+		"main;handler abc",
+		" 10",
+	} {
+		_, err := folded.Parse(strings.NewReader(input), profile.ValueType{Type: "samples", Unit: "count"})
+		assert.Error(t, err, input)
+	}
+}
+
+func TestWriteGoProfile(t *testing.T) {
+	p, err := profile.Parse(bytes.NewReader(testdata.TestData("profile1.pb")))
+	assert.NoError(t, err)
+	b := bytes.NewBuffer([]byte{})
+	assert.NoError(t, folded.Write(b, p, len(p.SampleType)-1))
+	assert.NotEmpty(t, b.String())
+
+	// the exported stacks parse back into an equivalent total
+	parsed, err := folded.Parse(b, *p.SampleType[len(p.SampleType)-1])
+	assert.NoError(t, err)
+	var expected, actual int64
+	for _, s := range p.Sample {
+		expected += s.Value[len(p.SampleType)-1]
+	}
+	for _, s := range parsed.Sample {
+		actual += s.Value[0]
+	}
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,149 @@
+// Package goroutines parses the goroutine dumps served by net/http/pprof with `debug=2`,
+// which keep the goroutine states, wait durations and creators that goroutine profiles lose
+package goroutines
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ArtifactKind is the kind goroutine dumps are stored under in the artifact store
+const ArtifactKind = "goroutine_dump"
+
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+type Goroutine struct {
+	ID    int64  `json:"id"`
+	State string `json:"state"`
+	// WaitMinutes is only reported by the runtime for goroutines blocked for at least a minute
+	WaitMinutes    int     `json:"wait_minutes,omitempty"`
+	LockedToThread bool    `json:"locked_to_thread,omitempty"`
+	Stack          []Frame `json:"stack"`
+	// FramesElided is set when the runtime truncated the stack
+	FramesElided bool   `json:"frames_elided,omitempty"`
+	CreatedBy    *Frame `json:"created_by,omitempty"`
+	// CreatorID is only reported since go 1.21
+	CreatorID int64 `json:"creator_id,omitempty"`
+}
+
+// `goroutine 18 [chan receive, 5 minutes, locked to thread]:`, newer runtimes can add fields before the state
+var headerRegex = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)? \[(.*)\]:$`)
+
+// `created by main.main in goroutine 1`
+var createdByRegex = regexp.MustCompile(`^created by (.+?)(?: in goroutine (\d+))?$`)
+
+// `	/src/main.go:20 +0x35`, followed by frame pointers with GOTRACEBACK=system
+var locationRegex = regexp.MustCompile(`^\t(.+?):(\d+)(?: .*)?$`)
+
+// Validate checks that data starts like a goroutine dump, without parsing it
+func Validate(data []byte) error {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	if !headerRegex.Match(bytes.TrimSpace(line)) {
+		return fmt.Errorf("invalid goroutine dump header")
+	}
+	return nil
+}
+
+// Parse reads the goroutines of a dump, in dump order
+func Parse(r io.Reader) ([]Goroutine, error) {
+	ret := []Goroutine{}
+	var cur *Goroutine
+	// the frame waiting for its location line
+	var frame *Frame
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			if cur != nil {
+				ret = append(ret, *cur)
+			}
+			cur, frame = nil, nil
+			continue
+		}
+		if cur == nil {
+			g, err := parseHeader(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNum, err)
+			}
+			cur = g
+			continue
+		}
+		if frame != nil {
+			m := locationRegex.FindStringSubmatch(line)
+			if m == nil {
+				return nil, fmt.Errorf("line %d: expected a file location, got %q", lineNum, line)
+			}
+			frame.File = m[1]
+			frame.Line, _ = strconv.Atoi(m[2])
+			frame = nil
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "...") && strings.HasSuffix(line, "frames elided..."):
+			cur.FramesElided = true
+		case strings.HasPrefix(line, "created by "):
+			m := createdByRegex.FindStringSubmatch(line)
+			cur.CreatedBy = &Frame{Function: m[1]}
+			if m[2] != "" {
+				cur.CreatorID, _ = strconv.ParseInt(m[2], 10, 64)
+			}
+			frame = cur.CreatedBy
+		default:
+			cur.Stack = append(cur.Stack, Frame{Function: functionName(line)})
+			frame = &cur.Stack[len(cur.Stack)-1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if cur != nil {
+		ret = append(ret, *cur)
+	}
+	return ret, nil
+}
+
+func parseHeader(line string) (*Goroutine, error) {
+	m := headerRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("expected a goroutine header, got %q", line)
+	}
+	id, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	g := &Goroutine{ID: id}
+	parts := strings.Split(m[2], ", ")
+	g.State = parts[0]
+	for _, part := range parts[1:] {
+		switch {
+		case part == "locked to thread":
+			g.LockedToThread = true
+		case strings.HasSuffix(part, " minutes"):
+			g.WaitMinutes, _ = strconv.Atoi(strings.TrimSuffix(part, " minutes"))
+		}
+	}
+	return g, nil
+}
+
+// functionName strips the arguments of a frame's function line, `main.worker(0xc000010000, {0x1, 0x2})`
+func functionName(line string) string {
+	if !strings.HasSuffix(line, ")") {
+		return line
+	}
+	if idx := strings.LastIndex(line, "("); idx > 0 {
+		return line[:idx]
+	}
+	return line
+}
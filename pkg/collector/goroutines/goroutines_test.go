@@ -0,0 +1,139 @@
+package goroutines_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime/pprof"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const dump = `goroutine 1 [running]:
+main.main()
+	/src/main.go:10 +0x1d
+
+goroutine 18 [chan receive, 12 minutes]:
+main.worker(0xc000010000, {0x1, 0x2})
+	/src/worker.go:20 +0x35
+created by main.main in goroutine 1
+	/src/main.go:15 +0x4f
+
+goroutine 19 [chan receive, 3 minutes]:
+main.worker(0xc000010008, {0x1, 0x2})
+	/src/worker.go:20 +0x35
+created by main.main in goroutine 1
+	/src/main.go:15 +0x4f
+
+goroutine 7 gp=0xc000007c00 m=nil [select, locked to thread]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:424 +0xce
+...additional frames elided...
+created by runtime.init.7
+	/usr/local/go/src/runtime/proc.go:337 +0x1a
+`
+
+func TestParse(t *testing.T) {
+	require.NoError(t, goroutines.Validate([]byte(dump)))
+	gs, err := goroutines.Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	require.Len(t, gs, 4)
+
+	assert.Equal(t, goroutines.Goroutine{
+		ID:          18,
+		State:       "chan receive",
+		WaitMinutes: 12,
+		Stack:       []goroutines.Frame{{Function: "main.worker", File: "/src/worker.go", Line: 20}},
+		CreatedBy:   &goroutines.Frame{Function: "main.main", File: "/src/main.go", Line: 15},
+		CreatorID:   1,
+	}, gs[1])
+	assert.Equal(t, int64(7), gs[3].ID)
+	assert.Equal(t, "select", gs[3].State)
+	assert.True(t, gs[3].LockedToThread)
+	assert.True(t, gs[3].FramesElided)
+	assert.Equal(t, "runtime.init.7", gs[3].CreatedBy.Function)
+	assert.Zero(t, gs[3].CreatorID)
+
+	assert.Error(t, goroutines.Validate([]byte("404 page not found")))
+	_, err = goroutines.Parse(strings.NewReader("goroutine 1 [running]:\nmain.main()\nnot a location\n"))
+	assert.Error(t, err)
+}
+
+func TestParseRuntimeDump(t *testing.T) {
+	block := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-block
+	}()
+	defer func() {
+		close(block)
+		<-done
+	}()
+	var blocked []goroutines.Goroutine
+	// until the goroutine is scheduled and blocks
+	require.Eventually(t, func() bool {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			return false
+		}
+		gs, err := goroutines.Parse(&buf)
+		if err != nil {
+			return false
+		}
+		blocked = goroutines.Filter{Query: "TestParseRuntimeDump", State: "chan receive"}.Apply(gs)
+		return len(blocked) == 1
+	}, 5*time.Second, time.Millisecond)
+	assert.Contains(t, blocked[0].CreatedBy.Function, "TestParseRuntimeDump")
+	assert.NotZero(t, blocked[0].CreatorID)
+}
+
+func TestGroup(t *testing.T) {
+	gs, err := goroutines.Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	grouper := goroutines.NewGrouper()
+	grouper.Add("a", gs)
+	grouper.Add("b", goroutines.Filter{Query: "worker.go"}.Apply(gs))
+	groups := grouper.Groups()
+	require.Len(t, groups, 3)
+
+	assert.Equal(t, 4, groups[0].Count)
+	assert.Equal(t, map[string]int{"chan receive": 4}, groups[0].States)
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, groups[0].Sources)
+	assert.Equal(t, 12, groups[0].MaxWaitMinutes)
+	assert.Equal(t, []int64{18, 19, 18, 19}, groups[0].IDs)
+	assert.Equal(t, "main.worker", groups[0].Stack[0].Function)
+
+	assert.Len(t, goroutines.Filter{MinWaitMinutes: 5}.Apply(gs), 1)
+	assert.Len(t, goroutines.Filter{Query: "runtime.init"}.Apply(gs), 1)
+}
+
+func TestAddGroup(t *testing.T) {
+	gs, err := goroutines.Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	local := goroutines.NewGrouper()
+	local.Add("a", gs)
+	remote := goroutines.NewGrouper()
+	remote.Add("b", goroutines.Filter{Query: "worker.go"}.Apply(gs))
+
+	// groups from another collector go through JSON, which drops their keys
+	data, err := json.Marshal(remote.Groups())
+	require.NoError(t, err)
+	var decoded []goroutines.Group
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	for _, group := range decoded {
+		local.AddGroup(group)
+	}
+
+	groups := local.Groups()
+	require.Len(t, groups, 3)
+	assert.Equal(t, 4, groups[0].Count)
+	assert.Equal(t, map[string]int{"chan receive": 4}, groups[0].States)
+	assert.Equal(t, map[string]int{"a": 2, "b": 2}, groups[0].Sources)
+	assert.Equal(t, 12, groups[0].MaxWaitMinutes)
+	assert.Equal(t, []int64{18, 19, 18, 19}, groups[0].IDs)
+}
@@ -0,0 +1,160 @@
+package goroutines
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Filter selects goroutines, empty fields match every goroutine
+type Filter struct {
+	// Query is a substring of a function or file of the stack or of the creator
+	Query string
+	State string
+	// MinWaitMinutes selects goroutines blocked for at least this long
+	MinWaitMinutes int
+}
+
+func (f Filter) Matches(g Goroutine) bool {
+	if f.State != "" && g.State != f.State {
+		return false
+	}
+	if g.WaitMinutes < f.MinWaitMinutes {
+		return false
+	}
+	if f.Query == "" {
+		return true
+	}
+	frames := g.Stack
+	if g.CreatedBy != nil {
+		frames = append(slices.Clip(frames), *g.CreatedBy)
+	}
+	for _, frame := range frames {
+		if strings.Contains(frame.Function, f.Query) || strings.Contains(frame.File, f.Query) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Filter) Apply(gs []Goroutine) []Goroutine {
+	ret := []Goroutine{}
+	for _, g := range gs {
+		if f.Matches(g) {
+			ret = append(ret, g)
+		}
+	}
+	return ret
+}
+
+// maxGroupIDs bounds the goroutine IDs listed in a group
+const maxGroupIDs = 20
+
+// Group is a set of goroutines with identical stacks and creators, possibly from several dumps
+type Group struct {
+	Count          int            `json:"count"`
+	States         map[string]int `json:"states"`
+	MaxWaitMinutes int            `json:"max_wait_minutes"`
+	Stack          []Frame        `json:"stack"`
+	CreatedBy      *Frame         `json:"created_by,omitempty"`
+	// Sources counts the goroutines of the group in each dump
+	Sources map[string]int `json:"sources"`
+	// IDs of the first goroutines of the group
+	IDs []int64 `json:"ids"`
+
+	key string
+}
+
+// Grouper groups the goroutines of one or more dumps by stack
+type Grouper struct {
+	groups map[string]*Group
+}
+
+func NewGrouper() *Grouper {
+	return &Grouper{groups: map[string]*Group{}}
+}
+
+func stackKey(g Goroutine) string {
+	var sb strings.Builder
+	for _, f := range g.Stack {
+		fmt.Fprintf(&sb, "%s %s:%d\n", f.Function, f.File, f.Line)
+	}
+	if g.CreatedBy != nil {
+		fmt.Fprintf(&sb, "created by %s %s:%d\n", g.CreatedBy.Function, g.CreatedBy.File, g.CreatedBy.Line)
+	}
+	return sb.String()
+}
+
+// Add groups the goroutines of the dump identified by source
+func (gr *Grouper) Add(source string, gs []Goroutine) {
+	for _, g := range gs {
+		key := stackKey(g)
+		group, ok := gr.groups[key]
+		if !ok {
+			group = &Group{
+				key:       key,
+				States:    map[string]int{},
+				Stack:     g.Stack,
+				CreatedBy: g.CreatedBy,
+				Sources:   map[string]int{},
+			}
+			gr.groups[key] = group
+		}
+		group.Count++
+		group.States[g.State]++
+		group.Sources[source]++
+		group.MaxWaitMinutes = max(group.MaxWaitMinutes, g.WaitMinutes)
+		if len(group.IDs) < maxGroupIDs {
+			group.IDs = append(group.IDs, g.ID)
+		}
+	}
+}
+
+// AddGroup merges a group built by another grouper, e.g. from the dumps of another collector
+func (gr *Grouper) AddGroup(g Group) {
+	key := stackKey(Goroutine{Stack: g.Stack, CreatedBy: g.CreatedBy})
+	group, ok := gr.groups[key]
+	if !ok {
+		group = &Group{
+			key:       key,
+			States:    map[string]int{},
+			Stack:     g.Stack,
+			CreatedBy: g.CreatedBy,
+			Sources:   map[string]int{},
+		}
+		gr.groups[key] = group
+	}
+	group.Count += g.Count
+	for state, count := range g.States {
+		group.States[state] += count
+	}
+	for source, count := range g.Sources {
+		group.Sources[source] += count
+	}
+	group.MaxWaitMinutes = max(group.MaxWaitMinutes, g.MaxWaitMinutes)
+	for _, id := range g.IDs {
+		if len(group.IDs) >= maxGroupIDs {
+			break
+		}
+		group.IDs = append(group.IDs, id)
+	}
+}
+
+// Groups returns the groups, largest first
+func (gr *Grouper) Groups() []Group {
+	ret := make([]Group, 0, len(gr.groups))
+	for _, group := range gr.groups {
+		ret = append(ret, *group)
+	}
+	slices.SortFunc(ret, func(a, b Group) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(b.MaxWaitMinutes, a.MaxWaitMinutes); c != 0 {
+			return c
+		}
+		return strings.Compare(a.key, b.key)
+	})
+	return ret
+}
@@ -0,0 +1,69 @@
+package ingest
+
+import (
+	"encoding/hex"
+	"strconv"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	profilespb "go.opentelemetry.io/proto/otlp/profiles/v1development"
+)
+
+// sampleLabels converts the OTLP attributes and span link of a sample into pprof sample labels,
+// integer attributes become numeric labels and everything else is kept as a string label
+func sampleLabels(p *profilespb.Profile, s *profilespb.Sample, out *profile.Sample) {
+	units := attributeUnits(p)
+	for _, attrIdx := range s.GetAttributeIndices() {
+		if int(attrIdx) >= len(p.GetAttributeTable()) {
+			continue
+		}
+		attr := p.GetAttributeTable()[attrIdx]
+		key := attr.GetKey()
+		switch v := attr.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_IntValue:
+			out.NumLabel[key] = append(out.NumLabel[key], v.IntValue)
+			if unit, ok := units[key]; ok {
+				out.NumUnit[key] = append(out.NumUnit[key], unit)
+			}
+		case *commonpb.AnyValue_StringValue:
+			out.Label[key] = append(out.Label[key], v.StringValue)
+		case *commonpb.AnyValue_BoolValue:
+			out.Label[key] = append(out.Label[key], strconv.FormatBool(v.BoolValue))
+		case *commonpb.AnyValue_DoubleValue:
+			out.Label[key] = append(out.Label[key], strconv.FormatFloat(v.DoubleValue, 'g', -1, 64))
+		case *commonpb.AnyValue_BytesValue:
+			out.Label[key] = append(out.Label[key], hex.EncodeToString(v.BytesValue))
+		}
+	}
+	// numeric labels with units must have a unit for every value
+	for key := range out.NumUnit {
+		if len(out.NumUnit[key]) != len(out.NumLabel[key]) {
+			delete(out.NumUnit, key)
+		}
+	}
+
+	if s.LinkIndex == nil || int(s.GetLinkIndex()) >= len(p.GetLinkTable()) {
+		return
+	}
+	link := p.GetLinkTable()[s.GetLinkIndex()]
+	if len(link.GetTraceId()) > 0 {
+		out.Label[labels.TraceIDLabel] = []string{hex.EncodeToString(link.GetTraceId())}
+	}
+	if len(link.GetSpanId()) > 0 {
+		out.Label[labels.SpanIDLabel] = []string{hex.EncodeToString(link.GetSpanId())}
+	}
+}
+
+func attributeUnits(p *profilespb.Profile) map[string]string {
+	ret := map[string]string{}
+	strs := p.GetStringTable()
+	for _, u := range p.GetAttributeUnits() {
+		keyIdx, unitIdx := int(u.GetAttributeKeyStrindex()), int(u.GetUnitStrindex())
+		if keyIdx >= len(strs) || unitIdx >= len(strs) || strs[unitIdx] == "" {
+			continue
+		}
+		ret[strs[keyIdx]] = strs[unitIdx]
+	}
+	return ret
+}
@@ -0,0 +1,88 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/folded"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+// handleFoldedPost ingests folded stacks, configured through query parameters:
+//   - profile_type : profile type to store the series under, defaults to `profile`
+//   - key : name of the series
+//   - sample_type, sample_unit : sample type of the values, defaults to `samples` and `count`
+//   - period : optional sampling period, in sample units
+//   - label : repeated `name=value` series labels, must include the storage index labels
+func (o *OTLPIngester) handleFoldedPost(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" || strings.Contains(key, "/") {
+		c.String(http.StatusBadRequest, "key query parameter is required and must not contain '/'")
+		return
+	}
+	profileType := c.DefaultQuery("profile_type", "profile")
+	if strings.Contains(profileType, "/") {
+		c.String(http.StatusBadRequest, "profile_type must not contain '/'")
+		return
+	}
+	labels := map[string]string{}
+	for _, l := range c.QueryArray("label") {
+		name, value, ok := strings.Cut(l, "=")
+		if !ok || name == "" {
+			c.String(http.StatusBadRequest, "invalid label %q, expected name=value", l)
+			return
+		}
+		labels[name] = value
+	}
+
+	body, err := readBody(c)
+	if err != nil {
+		rejectBody(metrics.FormatFolded, err)
+		c.String(bodyErrStatus(err), err.Error())
+		return
+	}
+	p, err := folded.Parse(bytes.NewReader(body), profile.ValueType{
+		Type: c.DefaultQuery("sample_type", "samples"),
+		Unit: c.DefaultQuery("sample_unit", "count"),
+	})
+	if err != nil {
+		metrics.IngestRejected.WithLabelValues(metrics.FormatFolded, metrics.RejectDecode).Inc()
+		c.String(http.StatusBadRequest, "failed to parse folded stacks: %s", err)
+		return
+	}
+	if period := c.Query("period"); period != "" {
+		p.Period, err = strconv.ParseInt(period, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, "invalid period: %s", err)
+			return
+		}
+	}
+
+	b := bytes.NewBuffer([]byte{})
+	if err := p.Write(b); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	metrics.IngestProfiles.WithLabelValues(metrics.FormatFolded).Inc()
+	metrics.IngestSamples.WithLabelValues(metrics.FormatFolded).Add(float64(len(p.Sample)))
+	now := time.Now()
+	if err := o.store.Put(now, now, profileType, key, labels, b.Bytes()); err != nil {
+		if errors.Is(err, storage.ErrInvalidSeries) {
+			metrics.IngestRejected.WithLabelValues(metrics.FormatFolded, metrics.RejectInvalid).Inc()
+			c.String(http.StatusBadRequest, "failed to store profile: %s", err)
+			return
+		}
+		metrics.IngestRejected.WithLabelValues(metrics.FormatFolded, metrics.RejectStore).Inc()
+		o.logger.With("error", err, "key", key).Error("failed to store folded profile")
+		c.String(http.StatusInternalServerError, "failed to store profile: %s", err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -19,10 +20,13 @@ import (
 	"github.com/gin-gonic/gin/render"
 	"github.com/google/pprof/profile"
 	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/samber/lo"
 	"github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
@@ -35,6 +39,8 @@ import (
 const (
 	pbContentType   = "application/x-protobuf"
 	jsonContentType = "application/json"
+
+	maxMessageSizeKey = "maxMessageSize"
 )
 
 type OTLPIngester struct {
@@ -51,16 +57,56 @@ func NewOTLPIngester(logger *slog.Logger, store storage.Store) *OTLPIngester {
 	}
 }
 
-func (o *OTLPIngester) StartHTTP(addr string) error {
-	logger := o.logger.With("http-addr", addr)
+// HTTPHandler builds the otlphttp router, with authentication and request size limits
+// configured from the listener config
+func (o *OTLPIngester) HTTPHandler(cfg config.IngestListenerConfig) (http.Handler, error) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
-	logger.Info("Configuring otlphttp routers")
+	if cfg.Auth != nil {
+		token, err := bearerToken(cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		router.Use(httpAuthMiddleware(token))
+	}
+	maxSize := cfg.MaxMessageSize()
+	router.Use(func(c *gin.Context) {
+		c.Set(maxMessageSizeKey, maxSize)
+		c.Next()
+	})
 	o.ConfigureRoutes(router)
+	return router, nil
+}
+
+func (o *OTLPIngester) StartHTTP(cfg config.IngestListenerConfig) error {
+	logger := o.logger.With("http-addr", cfg.Addr, "tls", cfg.TLS != nil, "auth", cfg.Auth != nil)
+	logger.Info("Configuring otlphttp routers")
+	handler, err := o.HTTPHandler(cfg)
+	if err != nil {
+		logger.With("error", err).Error("failed to configure otlphttp routers")
+		return err
+	}
+	tlsCfg, err := serverTLSConfig(cfg.TLS)
+	if err != nil {
+		logger.With("error", err).Error("failed to configure tls")
+		return err
+	}
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		logger.With("error", err).Error("failed to listen")
+		return err
+	}
+	if tlsCfg != nil {
+		listener = tls.NewListener(listener, tlsCfg)
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 
 	go func() {
 		logger.Info("Starting otlphttp ingestion server...")
-		if err := router.Run(addr); err != nil {
+		if err := server.Serve(listener); err != nil {
 			logger.With("error", err).Error("failed to run router")
 			return
 		}
@@ -69,21 +115,19 @@ func (o *OTLPIngester) StartHTTP(addr string) error {
 	return nil
 }
 
-func (o *OTLPIngester) StartGrpc(addr string) error {
-	url, err := url.Parse(addr)
-	if err != nil {
-		o.logger.With("error", err).Error("failed to parse address")
-		return err
-	}
-
-	o.logger.With("grpc-addr", addr).Info("Starting OTLP ingestion server")
-	listener, err := net.Listen(url.Scheme, url.Host)
-	if err != nil {
-		o.logger.With("error", err).Error("failed to listen")
-		return err
+func (o *OTLPIngester) StartGrpc(cfg config.IngestListenerConfig) error {
+	logger := o.logger.With("grpc-addr", cfg.Addr, "tls", cfg.TLS != nil, "auth", cfg.Auth != nil)
+	network, addr := "tcp", cfg.Addr
+	if strings.Contains(cfg.Addr, "://") {
+		url, err := url.Parse(cfg.Addr)
+		if err != nil {
+			logger.With("error", err).Error("failed to parse address")
+			return err
+		}
+		network, addr = url.Scheme, url.Host
 	}
 
-	server := grpc.NewServer(
+	opts := []grpc.ServerOption{
 		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
 			MinTime:             15 * time.Second,
 			PermitWithoutStream: true,
@@ -92,12 +136,38 @@ func (o *OTLPIngester) StartGrpc(addr string) error {
 			Time:    15 * time.Second,
 			Timeout: 5 * time.Second,
 		}),
-	)
+		grpc.MaxRecvMsgSize(cfg.MaxMessageSize()),
+	}
+	tlsCfg, err := serverTLSConfig(cfg.TLS)
+	if err != nil {
+		logger.With("error", err).Error("failed to configure tls")
+		return err
+	}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	if cfg.Auth != nil {
+		token, err := bearerToken(cfg.Auth)
+		if err != nil {
+			logger.With("error", err).Error("failed to configure auth")
+			return err
+		}
+		opts = append(opts, grpc.UnaryInterceptor(grpcAuthInterceptor(token)))
+	}
+
+	logger.Info("Starting OTLP ingestion server")
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		logger.With("error", err).Error("failed to listen")
+		return err
+	}
+
+	server := grpc.NewServer(opts...)
 
 	server.RegisterService(&colprofilespb.ProfilesService_ServiceDesc, o)
 	go func() {
 		if err := server.Serve(listener); err != nil {
-			o.logger.With("error", err).Error("failed to serve")
+			logger.With("error", err).Error("failed to serve")
 			return
 		}
 	}()
@@ -108,6 +178,7 @@ var _ colprofilespb.ProfilesServiceServer = (*OTLPIngester)(nil)
 
 func (o *OTLPIngester) ConfigureRoutes(router *gin.Engine) {
 	router.POST("/v1/development/profiles", o.handleProfilesPost)
+	router.POST("/v1/folded", o.handleFoldedPost)
 }
 
 func (o *OTLPIngester) handleProfilesPost(c *gin.Context) {
@@ -178,6 +249,8 @@ func (o *OTLPIngester) handleEbpfCollectorProfile(rscs []*profilespb.ResourcePro
 
 		for _, scope := range rsc.GetScopeProfiles() {
 			for _, prof := range scope.GetProfiles() {
+				metrics.IngestProfiles.WithLabelValues(metrics.FormatOTLP).Inc()
+				metrics.IngestSamples.WithLabelValues(metrics.FormatOTLP).Add(float64(len(prof.GetSample())))
 				// split by PID
 				profileMap := splitByPid(prof)
 				for pid, profiles := range profileMap {
@@ -221,7 +294,8 @@ func (o *OTLPIngester) handleEbpfCollectorProfile(rscs []*profilespb.ResourcePro
 					if err := baseProfile.Write(b); err != nil {
 						panic(err)
 					}
-					threadSuffix := strings.Join(lo.Uniq(threadNames), "-")
+					// thread names like kworker/0:1 can't be used in the series key
+					threadSuffix := strings.ReplaceAll(strings.Join(lo.Uniq(threadNames), "-"), "/", "_")
 					if err := o.store.Put(time.Now(), time.Now(), "profile", fmt.Sprintf("pid-%d-%s", pid, threadSuffix), map[string]string{
 						labels.NamespaceLabel: "ebpf-local",
 						labels.NameLabel:      "host",
@@ -233,6 +307,7 @@ func (o *OTLPIngester) handleEbpfCollectorProfile(rscs []*profilespb.ResourcePro
 				p := Convert(prof)
 				if err := p.CheckValid(); err != nil {
 					failedCount += 1
+					metrics.IngestRejected.WithLabelValues(metrics.FormatOTLP, metrics.RejectInvalid).Inc()
 					o.logger.With("error", err).Error("cannot convert to pprof profile")
 					errs = append(errs, fmt.Errorf("failed to convert to pprof profile : %w", err))
 					continue
@@ -240,6 +315,7 @@ func (o *OTLPIngester) handleEbpfCollectorProfile(rscs []*profilespb.ResourcePro
 				b := bytes.NewBuffer([]byte{})
 				if err := p.Write(b); err != nil {
 					failedCount += 1
+					metrics.IngestRejected.WithLabelValues(metrics.FormatOTLP, metrics.RejectInvalid).Inc()
 					o.logger.With("error", err).Error("failed to write profile to buffer")
 					errs = append(errs, fmt.Errorf("failed to write profile to buffer: %w", err))
 					continue
@@ -250,6 +326,7 @@ func (o *OTLPIngester) handleEbpfCollectorProfile(rscs []*profilespb.ResourcePro
 					labels.NameLabel:      "host",
 				}, b.Bytes()); err != nil {
 					failedCount += 1
+					metrics.IngestRejected.WithLabelValues(metrics.FormatOTLP, metrics.RejectStore).Inc()
 					o.logger.With("error", err).Error("failed to store profile")
 					errs = append(errs, fmt.Errorf("failed to store profile: %w", err))
 					continue
@@ -414,6 +491,7 @@ func Convert(p *profilespb.Profile) *profile.Profile {
 			NumLabel: map[string][]int64{},
 			NumUnit:  map[string][]string{},
 		}
+		sampleLabels(p, s, ps)
 
 		// first location to group by process/thread, purely "cosmetic"
 
@@ -491,13 +569,15 @@ func Convert(p *profilespb.Profile) *profile.Profile {
 func (o *OTLPIngester) renderProto(c *gin.Context) {
 	body, err := readBody(c)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		rejectBody(metrics.FormatOTLP, err)
+		c.String(bodyErrStatus(err), err.Error())
 		return
 	}
 
 	req := &colprofilespb.ExportProfilesServiceRequest{}
 	err = proto.Unmarshal(body, req)
 	if err != nil {
+		metrics.IngestRejected.WithLabelValues(metrics.FormatOTLP, metrics.RejectDecode).Inc()
 		c.Status(http.StatusBadRequest)
 		return
 	}
@@ -515,13 +595,15 @@ func (o *OTLPIngester) renderProto(c *gin.Context) {
 func (o *OTLPIngester) renderProtoJSON(c *gin.Context) {
 	body, err := readBody(c)
 	if err != nil {
-		c.Status(http.StatusBadRequest)
+		rejectBody(metrics.FormatOTLP, err)
+		c.String(bodyErrStatus(err), err.Error())
 		return
 	}
 
 	req := &colprofilespb.ExportProfilesServiceRequest{}
 	err = protojson.Unmarshal(body, req)
 	if err != nil {
+		metrics.IngestRejected.WithLabelValues(metrics.FormatOTLP, metrics.RejectDecode).Inc()
 		c.Status(http.StatusBadRequest)
 		return
 	}
@@ -537,16 +619,50 @@ func (o *OTLPIngester) renderProtoJSON(c *gin.Context) {
 }
 
 func readBody(c *gin.Context) ([]byte, error) {
-	bodyReader := c.Request.Body
+	maxSize := c.GetInt(maxMessageSizeKey)
+	if maxSize <= 0 {
+		maxSize = config.DefaultIngestMaxMessageSizeBytes
+	}
+	var bodyReader io.Reader = http.MaxBytesReader(c.Writer, c.Request.Body, int64(maxSize))
 	if c.GetHeader("Content-Encoding") == "gzip" {
-		gr, err := gzip.NewReader(c.Request.Body)
+		gr, err := gzip.NewReader(bodyReader)
 		if err != nil {
 			return []byte{}, err
 		}
 		defer gr.Close()
 		bodyReader = gr
 	}
-	return io.ReadAll(bodyReader)
+	// guard against compressed payloads expanding past the limit
+	data, err := io.ReadAll(io.LimitReader(bodyReader, int64(maxSize)+1))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return []byte{}, errMessageTooLarge
+		}
+		return []byte{}, err
+	}
+	if len(data) > maxSize {
+		return []byte{}, errMessageTooLarge
+	}
+	return data, nil
+}
+
+var errMessageTooLarge = errors.New("request exceeds max message size")
+
+// rejectBody counts requests whose body couldn't be read as a single rejected profile
+func rejectBody(format string, err error) {
+	reason := metrics.RejectDecode
+	if errors.Is(err, errMessageTooLarge) {
+		reason = metrics.RejectTooLarge
+	}
+	metrics.IngestRejected.WithLabelValues(format, reason).Inc()
+}
+
+func bodyErrStatus(err error) int {
+	if errors.Is(err, errMessageTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
 }
 
 type protoJSON struct {
@@ -1,13 +1,28 @@
 package ingest_test
 
 import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/rancher-sandbox/profiling/pkg/collector/ingest"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colprofilespb "go.opentelemetry.io/proto/otlp/collector/profiles/v1development"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
 	profilespb "go.opentelemetry.io/proto/otlp/profiles/v1development"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestConvert(t *testing.T) {
@@ -18,3 +33,118 @@ func TestConvert(t *testing.T) {
 	prof := ingest.Convert(&a)
 	assert.NoError(t, prof.CheckValid())
 }
+
+func TestHTTPHandlerAuthAndSize(t *testing.T) {
+	ingester := ingest.NewOTLPIngester(slog.Default(), storage.NewNoopStore())
+	handler, err := ingester.HTTPHandler(config.IngestListenerConfig{
+		Auth: &config.BearerAuthConfig{
+			Token: "secret",
+		},
+		MaxMessageSizeBytes: 1024,
+	})
+	assert.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	body, err := proto.Marshal(&colprofilespb.ExportProfilesServiceRequest{})
+	assert.NoError(t, err)
+
+	post := func(token string, data []byte) int {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/development/profiles", bytes.NewReader(data))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("", body))
+	assert.Equal(t, http.StatusUnauthorized, post("wrong", body))
+	assert.Equal(t, http.StatusOK, post("secret", body))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, post("secret", make([]byte, 2048)))
+}
+
+func TestConvertSampleLabels(t *testing.T) {
+	p := &profilespb.Profile{
+		StringTable: []string{"", "cpu", "nanoseconds", "main", "main.go"},
+		SampleType: []*profilespb.ValueType{
+			{TypeStrindex: 1, UnitStrindex: 2},
+		},
+		FunctionTable: []*profilespb.Function{
+			{NameStrindex: 3, FilenameStrindex: 4},
+		},
+		MappingTable: []*profilespb.Mapping{
+			{MemoryStart: 0x1000, MemoryLimit: 0x2000, FilenameStrindex: 4},
+		},
+		LocationTable: []*profilespb.Location{
+			{MappingIndex: proto.Int32(0), Line: []*profilespb.Line{{FunctionIndex: 0, Line: 1}}},
+		},
+		LocationIndices: []int32{0},
+		AttributeTable: []*commonpb.KeyValue{
+			{Key: "span_name", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "GET /"}}},
+			{Key: "process.pid", Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: 42}}},
+		},
+		LinkTable: []*profilespb.Link{
+			{TraceId: []byte{0x01, 0x02}, SpanId: []byte{0x03}},
+		},
+		Sample: []*profilespb.Sample{
+			{
+				LocationsStartIndex: 0,
+				LocationsLength:     1,
+				Value:               []int64{10},
+				AttributeIndices:    []int32{0, 1},
+				LinkIndex:           proto.Int32(0),
+			},
+		},
+	}
+
+	prof := ingest.Convert(p)
+	assert.NoError(t, prof.CheckValid())
+	assert.Len(t, prof.Sample, 1)
+	s := prof.Sample[0]
+	assert.True(t, s.HasLabel(labels.TraceIDLabel, "0102"))
+	assert.True(t, s.HasLabel(labels.SpanIDLabel, "03"))
+	assert.True(t, s.HasLabel(labels.SpanNameLabel, "GET /"))
+	assert.Equal(t, []int64{42}, s.NumLabel["process.pid"])
+}
+
+func TestFoldedInvalidSeries(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	store := storage.NewLabelBasedFileStore(dataDir, []string{labels.NamespaceLabel, labels.NameLabel}, &storage.PprofMerger{})
+	handler, err := ingest.NewOTLPIngester(slog.Default(), store).HTTPHandler(config.IngestListenerConfig{})
+	require.NoError(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	post := func(query url.Values) int {
+		resp, err := http.Post(server.URL+"/v1/folded?"+query.Encode(), "text/plain", strings.NewReader("main;work 10\n"))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	series := func(namespace, name, key, profileType string) url.Values {
+		return url.Values{
+			"key":          {key},
+			"profile_type": {profileType},
+			"label":        {labels.NamespaceLabel + "=" + namespace, labels.NameLabel + "=" + name},
+		}
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post(series("../../..", "api", "api-0", "profile")))
+	assert.Equal(t, http.StatusBadRequest, post(series("default", "", "api-0", "profile")))
+	assert.Equal(t, http.StatusBadRequest, post(series("default", "api", "..", "profile")))
+	assert.Equal(t, http.StatusBadRequest, post(series("default", "api", "api-0", "..")))
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Equal(t, http.StatusAccepted, post(series("default", "api", "api-0", "profile")))
+	keys, err := store.GroupKeys()
+	require.NoError(t, err)
+	assert.Contains(t, keys, "default")
+}
@@ -4,3 +4,22 @@ const (
 	NamespaceLabel = "__k8s_namespace"
 	NameLabel      = "__k8s_name"
 )
+
+// ReservedPrefix labels are internal, only labels with K8sPrefix are kept after relabeling
+const (
+	ReservedPrefix = "__"
+	K8sPrefix      = "__k8s_"
+)
+
+// Sample labels used to correlate profiles with traces
+const (
+	TraceIDLabel  = "trace_id"
+	SpanIDLabel   = "span_id"
+	SpanNameLabel = "span_name"
+)
+
+// Sample labels of the profiles captured in burst mode, naming the rule that triggered it and why
+const (
+	BurstRuleLabel   = "burst_rule"
+	BurstReasonLabel = "burst_reason"
+)
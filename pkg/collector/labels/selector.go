@@ -0,0 +1,71 @@
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var labelNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseSelector parses matchers in the Prometheus style, e.g. `{__k8s_namespace="default",pod=~"api-.*"}`.
+// An empty selector matches every label set
+func ParseSelector(s string) ([]*Matcher, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("selector %q must be enclosed in braces", s)
+	}
+	rest := strings.TrimSpace(s[1 : len(s)-1])
+	ret := []*Matcher{}
+	for rest != "" {
+		i := strings.IndexAny(rest, "=!")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid selector %q : missing match operator", s)
+		}
+		name := strings.TrimSpace(rest[:i])
+		if !labelNameRe.MatchString(name) {
+			return nil, fmt.Errorf("invalid selector %q : invalid label name %q", s, name)
+		}
+		rest = rest[i:]
+		var t MatchType
+		switch {
+		case strings.HasPrefix(rest, string(MatchRegexp)):
+			t = MatchRegexp
+		case strings.HasPrefix(rest, string(MatchNotRegexp)):
+			t = MatchNotRegexp
+		case strings.HasPrefix(rest, string(MatchNotEqual)):
+			t = MatchNotEqual
+		case strings.HasPrefix(rest, string(MatchEqual)):
+			t = MatchEqual
+		default:
+			return nil, fmt.Errorf("invalid selector %q : invalid match operator for %s", s, name)
+		}
+		rest = strings.TrimSpace(rest[len(t):])
+		quoted, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q : the value of %s must be quoted", s, name)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q : %w", s, err)
+		}
+		m, err := NewMatcher(t, name, value)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+		rest = strings.TrimSpace(rest[len(quoted):])
+		if rest == "" {
+			break
+		}
+		if rest[0] != ',' {
+			return nil, fmt.Errorf("invalid selector %q : matchers must be separated by commas", s)
+		}
+		rest = strings.TrimSpace(rest[1:])
+	}
+	return ret, nil
+}
@@ -0,0 +1,52 @@
+package labels_test
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelector(t *testing.T) {
+	matchers, err := labels.ParseSelector(`{__k8s_namespace="default", pod=~"api-.*",container!="sidecar" , zone!~"us-.*"}`)
+	require.NoError(t, err)
+	require.Len(t, matchers, 4)
+	assert.Equal(t, `__k8s_namespace="default"`, matchers[0].String())
+	assert.Equal(t, `pod=~"api-.*"`, matchers[1].String())
+	assert.Equal(t, `container!="sidecar"`, matchers[2].String())
+	assert.Equal(t, `zone!~"us-.*"`, matchers[3].String())
+
+	assert.True(t, labels.MatchesAll(matchers, map[string]string{
+		"__k8s_namespace": "default",
+		"pod":             "api-0",
+		"zone":            "eu-west",
+	}))
+	assert.False(t, labels.MatchesAll(matchers, map[string]string{
+		"__k8s_namespace": "default",
+		"pod":             "web-0",
+	}))
+
+	for _, selector := range []string{"", "{}", " { } "} {
+		matchers, err := labels.ParseSelector(selector)
+		assert.NoError(t, err)
+		assert.Empty(t, matchers)
+	}
+	value, err := labels.ParseSelector(`{msg="a \"quoted\" value"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `a "quoted" value`, value[0].Value)
+
+	for _, selector := range []string{
+		`pod="a"`,
+		`{pod}`,
+		`{pod="a"`,
+		`{pod=a}`,
+		`{pod=="a"}`,
+		`{pod="a" container="b"}`,
+		`{1pod="a"}`,
+		`{pod=~"("}`,
+	} {
+		_, err := labels.ParseSelector(selector)
+		assert.Error(t, err, selector)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -152,9 +153,42 @@ func TestLifecycle(t *testing.T) {
 	}
 
 	for _, tc := range tcs {
-		c := collector.NewCollector(ctx, slog.Default(), tc.baseConfig, storage.NewNoopStore())
+		c := collector.NewCollector(ctx, slog.Default(), tc.baseConfig, storage.NewNoopStore(), storage.NewNoopArtifactStore())
 		assert.NoError(t, c.Start(ctx))
-		assert.NoError(t, c.Reload(tc.incomingConfig))
+		_, err := c.Reload(tc.incomingConfig)
+		assert.NoError(t, err)
 		assert.NoError(t, c.Shutdown())
 	}
 }
+
+func TestTargets(t *testing.T) {
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	c := collector.NewCollector(ctx, slog.Default(), &config.CollectorConfig{
+		Monitors: []*config.MonitorConfig{
+			{
+				Name:     "test",
+				Endpoint: "http://localhost:6061",
+				Labels: map[string]string{
+					"__k8s_namespace": "default",
+				},
+				GlobalSampling: config.GlobalSamplingConfig{
+					Heap:      &config.SamplerConfig{IntervalSeconds: 60},
+					Goroutine: &config.SamplerConfig{IntervalSeconds: 60},
+				},
+			},
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore())
+	assert.NoError(t, c.Start(ctx))
+	_, err := c.CaptureTrace(ctx, "unknown", 1)
+	assert.ErrorIs(t, err, collector.ErrTargetNotFound)
+	targets := c.Targets()
+	assert.Len(t, targets, 1)
+	assert.Equal(t, "test", targets[0].Name)
+	assert.Equal(t, "default", targets[0].Labels["__k8s_namespace"])
+	assert.Equal(t, monitor.HealthUnknown, targets[0].Health)
+	assert.Len(t, targets[0].ProfileTypes, 2)
+
+	assert.NoError(t, c.Shutdown())
+	assert.Empty(t, c.Targets())
+}
@@ -0,0 +1,116 @@
+// Package metrics holds the collector's own Prometheus metrics
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "pprof_collector"
+
+// Ingest formats
+const (
+	FormatOTLP   = "otlp"
+	FormatFolded = "folded"
+)
+
+// Ingest rejection reasons
+const (
+	RejectTooLarge = "too_large"
+	RejectDecode   = "decode"
+	RejectInvalid  = "invalid"
+	RejectStore    = "store"
+)
+
+// Registry holds every collector metric, it is served by Handler
+var Registry = prometheus.NewRegistry()
+
+var (
+	ScrapeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_duration_seconds",
+		Help:      "Duration of successful scrapes, including the requested profile duration.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 120},
+	}, []string{"profile_type"})
+	ScrapeSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "scrape_size_bytes",
+		Help:      "Size of successfully scraped profiles.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 10),
+	}, []string{"profile_type"})
+	ScrapeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "scrape_failures_total",
+		Help:      "Failed scrapes, by failure reason.",
+	}, []string{"profile_type", "reason"})
+
+	IngestProfiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_profiles_received_total",
+		Help:      "Profiles received through ingestion.",
+	}, []string{"format"})
+	IngestSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_samples_received_total",
+		Help:      "Samples received through ingestion.",
+	}, []string{"format"})
+	IngestRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ingest_profiles_rejected_total",
+		Help:      "Profiles rejected by ingestion, requests that can't be decoded count as a single profile.",
+	}, []string{"format", "reason"})
+
+	StorePutDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "store_put_duration_seconds",
+		Help:      "Duration of profile writes, including merging with the stored profile.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"profile_type"})
+	MergeFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "merge_failures_total",
+		Help:      "Profiles that couldn't be merged with the stored profile.",
+	}, []string{"profile_type"})
+
+	Bursts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bursts_total",
+		Help:      "Targets switched to burst mode, by rule.",
+	}, []string{"rule"})
+
+	Reloads = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reloads_total",
+		Help:      "Config reloads.",
+	})
+	ReloadFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reload_failures_total",
+		Help:      "Failed config reloads.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ScrapeDuration,
+		ScrapeSize,
+		ScrapeFailures,
+		IngestProfiles,
+		IngestSamples,
+		IngestRejected,
+		StorePutDuration,
+		MergeFailures,
+		Bursts,
+		Reloads,
+		ReloadFailures,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,42 @@
+package monitor
+
+import (
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// artifactKind is a profile type stored as is in the artifact store, its kind is the profile type
+type artifactKind struct {
+	spec     config.ProfileSpec
+	validate func(data []byte) error
+	reason   FailureReason
+	// text responses are expected, they are rejected for other profile types
+	text bool
+}
+
+var artifactKinds = map[string]artifactKind{
+	exectrace.ArtifactKind: {
+		spec:     config.ProfileSpec{Name: exectrace.ArtifactKind, Exclusive: true},
+		validate: exectrace.Validate,
+		reason:   ReasonInvalidTrace,
+	},
+	goroutines.ArtifactKind: {
+		spec: config.ProfileSpec{
+			Name:   goroutines.ArtifactKind,
+			Path:   "/debug/pprof/goroutine",
+			Params: map[string]string{"debug": "2"},
+		},
+		validate: goroutines.Validate,
+		reason:   ReasonInvalidGoroutineDump,
+		text:     true,
+	},
+}
+
+func artifactSpec(kind string, sampler config.SamplerConfig) config.ProfileSpec {
+	var spec config.ProfileSpec
+	k := artifactKinds[kind]
+	k.spec.DeepCopyInto(&spec)
+	spec.SamplerConfig = sampler
+	return spec
+}
@@ -0,0 +1,125 @@
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// CaptureKind is the artifact kind of on-demand profiles, they are stored under `<series key>/<profile type>`
+// so that they are never merged with the continuously collected profiles
+const CaptureKind = "capture"
+
+// DefaultCaptureSeconds is the duration of on-demand CPU profiles when none is requested
+const DefaultCaptureSeconds = 10
+
+var builtinProfileTypes = []string{"allocs", "block", "goroutine", "heap", "mutex", "profile", "threadcreate"}
+
+// CaptureKey returns the artifact key of on-demand profiles of a type, for the monitor with the given name
+func CaptureKey(name, profileType string) string {
+	return path.Join(name, profileType)
+}
+
+// captureSpec returns the spec of a built-in or custom profile type of the target, collected for the given duration
+func (c *Monitor) captureSpec(profileType string, seconds int) (config.ProfileSpec, error) {
+	var spec config.ProfileSpec
+	if slices.Contains(builtinProfileTypes, profileType) {
+		spec = config.ProfileSpec{
+			Name:      profileType,
+			Exclusive: profileType == "profile",
+		}
+	} else {
+		idx := slices.IndexFunc(c.config.Profiles, func(p config.ProfileSpec) bool {
+			return p.Name == profileType
+		})
+		if idx < 0 {
+			return config.ProfileSpec{}, fmt.Errorf("unknown profile type %q", profileType)
+		}
+		c.config.Profiles[idx].DeepCopyInto(&spec)
+	}
+	if seconds > 0 {
+		spec.Seconds = seconds
+	}
+	if spec.Name == "profile" && spec.Seconds == 0 {
+		spec.Seconds = DefaultCaptureSeconds
+	}
+	return spec, nil
+}
+
+// Capture collects a profile of the given type and duration from the target, outside of its schedule,
+// and stores it as an artifact for each of the named monitors, returned by monitor name. It shares the
+// scheduler's exclusive locks so that it waits for an ongoing CPU profile of the target instead of failing.
+// sampleLabels are added to every sample of the profile.
+func (c *Monitor) Capture(
+	ctx context.Context,
+	names []string,
+	profileType string,
+	seconds int,
+	sampleLabels map[string]string,
+) (map[string]storage.Artifact, error) {
+	c.lifecycleMu.Lock()
+	client := c.client
+	c.lifecycleMu.Unlock()
+	if client == nil {
+		return nil, fmt.Errorf("monitor %s is not running", c.config.Name)
+	}
+	spec, err := c.captureSpec(profileType, seconds)
+	if err != nil {
+		return nil, err
+	}
+	req, err := c.constructRequest(spec)
+	if err != nil {
+		return nil, err
+	}
+	startTime := time.Now()
+	data, err := c.scrape(ctx, client, req)
+	if err != nil {
+		return nil, err
+	}
+	endTime := time.Now()
+	if len(sampleLabels) > 0 {
+		data, err = labelSamples(data, sampleLabels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret := map[string]storage.Artifact{}
+	for _, sink := range c.getSinks() {
+		if !slices.Contains(names, sink.Name) {
+			continue
+		}
+		artifact, err := c.artifacts.PutArtifact(startTime, endTime, CaptureKind, CaptureKey(sink.Name, profileType), sink.Labels, data)
+		if err != nil {
+			return nil, err
+		}
+		ret[sink.Name] = artifact
+	}
+	return ret, nil
+}
+
+func labelSamples(data []byte, sampleLabels map[string]string) ([]byte, error) {
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, sample := range p.Sample {
+		if sample.Label == nil {
+			sample.Label = map[string][]string{}
+		}
+		for k, v := range sampleLabels {
+			sample.Label[k] = []string{v}
+		}
+	}
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
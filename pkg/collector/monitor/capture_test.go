@@ -0,0 +1,108 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	cpu := testdata.TestData("heap1.pb")
+	var running atomic.Int32
+	var overlapped atomic.Bool
+	var seconds atomic.Value
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/profile", func(w http.ResponseWriter, r *http.Request) {
+		if running.Add(1) > 1 {
+			overlapped.Store(true)
+			running.Add(-1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// scheduled profiles don't set a duration
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			seconds.Store(s)
+		}
+		time.Sleep(300 * time.Millisecond)
+		running.Add(-1)
+		w.Write(cpu)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	artifacts := storage.NewFileArtifactStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, nil)
+	store := &countingStore{}
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		Labels: map[string]string{
+			labels.NamespaceLabel: "default",
+			labels.NameLabel:      "example",
+		},
+		GlobalSampling: config.GlobalSamplingConfig{
+			Profile: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+	}, store, artifacts, sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return running.Load() == 1
+	}, 5*time.Second, time.Millisecond)
+	// waits for the scheduled CPU profile instead of colliding with it
+	captured, err := mon.Capture(context.Background(), []string{"test"}, "profile", 2, nil)
+	require.NoError(t, err)
+	assert.False(t, overlapped.Load())
+	assert.Equal(t, "2", seconds.Load())
+	require.Contains(t, captured, "test")
+	assert.Equal(t, "default/example/test/profile", captured["test"].Key)
+	assert.Equal(t, int64(len(cpu)), captured["test"].Size)
+
+	list, err := artifacts.ListArtifacts(monitor.CaptureKind)
+	require.NoError(t, err)
+	assert.Len(t, list, 1)
+
+	_, err = mon.Capture(context.Background(), []string{"test"}, "unknown", 0, nil)
+	assert.Error(t, err)
+}
+
+func TestCaptureInvalid(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a profile"))
+	}))
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	artifacts := storage.NewFileArtifactStore(t.TempDir(), nil, nil)
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+	}, storage.NewNoopStore(), artifacts, sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	_, err := mon.Capture(context.Background(), []string{"test"}, "heap", 0, nil)
+	var scrapeErr *monitor.ScrapeError
+	require.ErrorAs(t, err, &scrapeErr)
+	list, err := artifacts.ListArtifacts(monitor.CaptureKind)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
@@ -0,0 +1,142 @@
+package monitor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+func newTransport(cfg config.HTTPClientConfig) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.ProxyURL != "" {
+		proxyURL, err := url.Parse(cfg.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if cfg.TLS != nil {
+		tlsCfg, err := clientTLSConfig(cfg.TLS)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsCfg
+	}
+	return transport, nil
+}
+
+func clientTLSConfig(cfg *config.TLSClientConfig) (*tls.Config, error) {
+	tlsCfg := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CAFile != "" {
+		data, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsCfg.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client key pair: %w", err)
+		}
+		tlsCfg.Certificates = []tls.Certificate{cert}
+	}
+	return tlsCfg, nil
+}
+
+// authRoundTripper sets the configured credentials on every request
+type authRoundTripper struct {
+	cfg  config.HTTPClientConfig
+	next http.RoundTripper
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (a *authRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	switch {
+	case a.cfg.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+a.cfg.BearerToken)
+	case a.cfg.BearerTokenFile != "":
+		token, err := readSecretFile(a.cfg.BearerTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bearer token file: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case a.cfg.BasicAuth != nil:
+		password := a.cfg.BasicAuth.Password
+		if a.cfg.BasicAuth.PasswordFile != "" {
+			var err error
+			password, err = readSecretFile(a.cfg.BasicAuth.PasswordFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read basic auth password file: %w", err)
+			}
+		}
+		req.SetBasicAuth(a.cfg.BasicAuth.Username, password)
+	}
+	return a.next.RoundTrip(req)
+}
+
+func validateClientConfig(cfg config.HTTPClientConfig) error {
+	authMethods := 0
+	if cfg.BearerToken != "" || cfg.BearerTokenFile != "" {
+		authMethods++
+	}
+	if cfg.BasicAuth != nil {
+		authMethods++
+	}
+	if authMethods > 1 {
+		return fmt.Errorf("at most one of bearer token and basic auth can be configured")
+	}
+	if cfg.BearerToken != "" && cfg.BearerTokenFile != "" {
+		return fmt.Errorf("bearer_token and bearer_token_file are mutually exclusive")
+	}
+	if cfg.BasicAuth != nil && cfg.BasicAuth.Password != "" && cfg.BasicAuth.PasswordFile != "" {
+		return fmt.Errorf("password and password_file are mutually exclusive")
+	}
+	if cfg.KubernetesProxy != nil && (authMethods > 0 || cfg.TLS != nil || cfg.ProxyURL != "") {
+		return fmt.Errorf("kubernetes_proxy uses the API server's credentials, it can't be combined with tls, auth or proxy_url")
+	}
+	return nil
+}
+
+// newHTTPClient returns a client with its own transport, shared by every profile type of a target.
+// Timeouts are applied per request, since they depend on the requested profile duration
+func newHTTPClient(cfg config.HTTPClientConfig) (*http.Client, error) {
+	if err := validateClientConfig(cfg); err != nil {
+		return nil, err
+	}
+	if cfg.KubernetesProxy != nil {
+		return newKubeProxyClient(cfg.KubernetesProxy)
+	}
+	transport, err := newTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &authRoundTripper{
+			cfg:  cfg,
+			next: transport,
+		},
+	}, nil
+}
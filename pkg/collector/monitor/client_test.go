@@ -0,0 +1,84 @@
+package monitor_test
+
+import (
+	"context"
+	"encoding/pem"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPClientConfig(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		http.DefaultServeMux.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := path.Join(dir, "ca.crt")
+	tokenFile := path.Join(dir, "token")
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	}), 0600))
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "tls",
+		Endpoint: server.URL,
+		GlobalSampling: config.GlobalSamplingConfig{
+			Heap: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+		HTTPClient: config.HTTPClientConfig{
+			TLS: &config.TLSClientConfig{
+				CAFile:     caFile,
+				ServerName: "example.com",
+			},
+			BearerTokenFile: tokenFile,
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	assert.NoError(t, mon.Start(ctx))
+	defer mon.Shutdown()
+	assert.Eventually(t, func() bool {
+		return mon.Health()[0].Health == monitor.HealthUp
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestHTTPClientConfigInvalid(t *testing.T) {
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "invalid",
+		Endpoint: "https://localhost:6060",
+		GlobalSampling: config.GlobalSamplingConfig{
+			Heap: &config.SamplerConfig{},
+		},
+		HTTPClient: config.HTTPClientConfig{
+			BearerToken: "token",
+			BasicAuth: &config.BasicAuthConfig{
+				Username: "user",
+				Password: "password",
+			},
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), scheduler.NewScheduler(slog.Default()))
+	assert.Error(t, mon.Start(context.Background()))
+	assert.NoError(t, mon.Shutdown())
+}
@@ -0,0 +1,100 @@
+package monitor
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// deltaTracker turns cumulative profiles, which report totals since the process started,
+// into the difference between consecutive scrapes
+type deltaTracker struct {
+	mu   sync.Mutex
+	prev map[string]*profile.Profile
+}
+
+func newDeltaTracker() *deltaTracker {
+	return &deltaTracker{
+		prev: map[string]*profile.Profile{},
+	}
+}
+
+// delta returns the difference between p and the previous profile of the same type.
+// It returns nil on the first scrape, which only primes the tracker.
+// When the totals went down, the target was restarted and p is returned as is.
+func (d *deltaTracker) delta(profileType string, p *profile.Profile) (*profile.Profile, error) {
+	d.mu.Lock()
+	prev, ok := d.prev[profileType]
+	d.prev[profileType] = p.Copy()
+	d.mu.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	if !sameSampleTypes(p, prev) {
+		// sample types changed, start over from this profile
+		return nil, nil
+	}
+	prev = prev.Copy()
+	prev.Scale(-1)
+	delta, err := profile.Merge([]*profile.Profile{p, prev})
+	if err != nil {
+		return nil, err
+	}
+	samples := delta.Sample[:0]
+	for _, s := range delta.Sample {
+		zero := true
+		for _, v := range s.Value {
+			if v < 0 {
+				return p, nil
+			}
+			if v != 0 {
+				zero = false
+			}
+		}
+		if !zero {
+			samples = append(samples, s)
+		}
+	}
+	delta.Sample = samples
+	delta.TimeNanos = p.TimeNanos
+	if p.TimeNanos > 0 && prev.TimeNanos > 0 {
+		delta.DurationNanos = p.TimeNanos - prev.TimeNanos
+	}
+	return delta, nil
+}
+
+func (d *deltaTracker) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prev = map[string]*profile.Profile{}
+}
+
+// encodedDelta is delta for serialized profiles, returning nil when there is nothing to store yet
+func (d *deltaTracker) encodedDelta(profileType string, data []byte) ([]byte, error) {
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return nil, err
+	}
+	delta, err := d.delta(profileType, p)
+	if err != nil || delta == nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := delta.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sameSampleTypes(a, b *profile.Profile) bool {
+	if len(a.SampleType) != len(b.SampleType) {
+		return false
+	}
+	for i := range a.SampleType {
+		if a.SampleType[i].Type != b.SampleType[i].Type || a.SampleType[i].Unit != b.SampleType[i].Unit {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExclusiveRequests(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	cpu := testdata.TestData("heap1.pb")
+	var running, served atomic.Int32
+	var overlapped atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// like net/http/pprof, refuse concurrent CPU profiles
+		if running.Add(1) > 1 {
+			overlapped.Store(true)
+			running.Add(-1)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		time.Sleep(600 * time.Millisecond)
+		running.Add(-1)
+		served.Add(1)
+		w.Write(cpu)
+	}))
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	mons := []*monitor.Monitor{}
+	// separate monitors of the same target
+	for _, name := range []string{"a", "b"} {
+		mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+			Name:     name,
+			Endpoint: server.URL,
+			GlobalSampling: config.GlobalSamplingConfig{
+				Profile: &config.SamplerConfig{IntervalSeconds: 1},
+			},
+		}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+		require.NoError(t, mon.Start(context.Background()))
+		defer mon.Shutdown()
+		mons = append(mons, mon)
+	}
+
+	assert.Eventually(t, func() bool {
+		return served.Load() >= 4
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, overlapped.Load())
+	for _, mon := range mons {
+		assert.Equal(t, monitor.HealthUp, mon.Health()[0].Health)
+	}
+}
@@ -0,0 +1,90 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoroutineDump(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/goroutine", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("debug") != "2" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		pprof.Lookup("goroutine").WriteTo(w, 2)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	artifacts := storage.NewFileArtifactStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, nil)
+	store := &countingStore{}
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		Labels: map[string]string{
+			labels.NamespaceLabel: "default",
+			labels.NameLabel:      "example",
+		},
+		GlobalSampling: config.GlobalSamplingConfig{
+			GoroutineDump: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+	}, store, artifacts, sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		list, err := artifacts.ListArtifacts(goroutines.ArtifactKind)
+		return err == nil && len(list) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, store.puts.Load())
+
+	artifact, err := mon.CaptureGoroutines(context.Background(), "test")
+	require.NoError(t, err)
+	assert.Equal(t, "default/example/test", artifact.Key)
+	assert.NotZero(t, artifact.Size)
+}
+
+func TestGoroutineDumpInvalid(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testdata.TestData("heap1.pb"))
+	}))
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		GlobalSampling: config.GlobalSamplingConfig{
+			GoroutineDump: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return mon.Health()[0].Health == monitor.HealthDown
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, monitor.ReasonInvalidGoroutineDump, mon.Health()[0].LastFailureReason)
+}
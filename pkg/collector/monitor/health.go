@@ -0,0 +1,145 @@
+package monitor
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+type Health string
+
+const (
+	HealthUnknown Health = "unknown"
+	HealthUp      Health = "up"
+	HealthDown    Health = "down"
+)
+
+// TargetHealth is the scrape state of a single profile type of a target
+type TargetHealth struct {
+	ProfileType         string        `json:"profileType"`
+	Health              Health        `json:"health"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	LastError           string        `json:"lastError,omitempty"`
+	LastFailureReason   FailureReason `json:"lastFailureReason,omitempty"`
+	LastScrape          time.Time     `json:"lastScrape"`
+	LastScrapeDuration  time.Duration `json:"lastScrapeDuration"`
+	LastScrapeSize      int           `json:"lastScrapeSize"`
+	// Backoff is the delay applied after the last failure, before the next scrape
+	Backoff time.Duration `json:"backoff"`
+}
+
+type backoff struct {
+	initial time.Duration
+	max     time.Duration
+}
+
+func newBackoff(cfg *config.BackoffConfig) backoff {
+	b := backoff{
+		initial: config.DefaultBackoffInitial,
+		max:     config.DefaultBackoffMax,
+	}
+	if cfg != nil {
+		if cfg.InitialSeconds > 0 {
+			b.initial = time.Duration(cfg.InitialSeconds) * time.Second
+		}
+		if cfg.MaxSeconds > 0 {
+			b.max = time.Duration(cfg.MaxSeconds) * time.Second
+		}
+	}
+	return b
+}
+
+// delay doubles the initial delay for each consecutive failure, up to the max delay
+func (b backoff) delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	d := b.initial
+	for i := 1; i < failures; i++ {
+		d *= 2
+		if d >= b.max {
+			return b.max
+		}
+	}
+	return min(d, b.max)
+}
+
+type healthTracker struct {
+	backoff backoff
+
+	mu     sync.RWMutex
+	health map[string]*TargetHealth
+}
+
+func newHealthTracker(b backoff) *healthTracker {
+	return &healthTracker{
+		backoff: b,
+		health:  map[string]*TargetHealth{},
+	}
+}
+
+func (h *healthTracker) register(profileType string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.health[profileType]; !ok {
+		h.health[profileType] = &TargetHealth{
+			ProfileType: profileType,
+			Health:      HealthUnknown,
+		}
+	}
+}
+
+func (h *healthTracker) get(profileType string) *TargetHealth {
+	th, ok := h.health[profileType]
+	if !ok {
+		th = &TargetHealth{ProfileType: profileType, Health: HealthUnknown}
+		h.health[profileType] = th
+	}
+	return th
+}
+
+func (h *healthTracker) success(profileType string, start time.Time, duration time.Duration, size int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th := h.get(profileType)
+	th.Health = HealthUp
+	th.ConsecutiveFailures = 0
+	th.LastError = ""
+	th.LastFailureReason = ""
+	th.LastScrape = start
+	th.LastScrapeDuration = duration
+	th.LastScrapeSize = size
+	th.Backoff = 0
+}
+
+// failure records a failed scrape and returns the delay to back off for
+func (h *healthTracker) failure(profileType string, start time.Time, duration time.Duration, err error) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	th := h.get(profileType)
+	th.Health = HealthDown
+	th.ConsecutiveFailures++
+	th.LastError = err.Error()
+	th.LastFailureReason = failureReason(err)
+	th.LastScrape = start
+	th.LastScrapeDuration = duration
+	th.LastScrapeSize = 0
+	th.Backoff = h.backoff.delay(th.ConsecutiveFailures)
+	return th.Backoff
+}
+
+func (h *healthTracker) snapshot() []TargetHealth {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ret := make([]TargetHealth, 0, len(h.health))
+	for _, th := range h.health {
+		ret = append(ret, *th)
+	}
+	slices.SortFunc(ret, func(a, b TargetHealth) int {
+		return strings.Compare(a.ProfileType, b.ProfileType)
+	})
+	return ret
+}
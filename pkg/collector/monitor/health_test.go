@@ -0,0 +1,71 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealth(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	up := httptest.NewServer(http.DefaultServeMux)
+	defer up.Close()
+	down := httptest.NewServer(http.DefaultServeMux)
+	down.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	sampling := config.GlobalSamplingConfig{
+		Heap: &config.SamplerConfig{
+			IntervalSeconds: 1,
+		},
+	}
+	upMon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:           "up",
+		Endpoint:       up.URL,
+		GlobalSampling: sampling,
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+	downMon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:           "down",
+		Endpoint:       down.URL,
+		GlobalSampling: sampling,
+		Backoff: &config.BackoffConfig{
+			InitialSeconds: 10,
+			MaxSeconds:     15,
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	assert.NoError(t, upMon.Start(ctx))
+	assert.NoError(t, downMon.Start(ctx))
+	defer upMon.Shutdown()
+	defer downMon.Shutdown()
+
+	assert.Equal(t, []monitor.TargetHealth{{ProfileType: "heap", Health: monitor.HealthUnknown}}, upMon.Health())
+
+	assert.Eventually(t, func() bool {
+		return upMon.Health()[0].Health == monitor.HealthUp
+	}, 5*time.Second, 10*time.Millisecond)
+	h := upMon.Health()[0]
+	assert.Zero(t, h.ConsecutiveFailures)
+	assert.Positive(t, h.LastScrapeSize)
+	assert.False(t, h.LastScrape.IsZero())
+
+	assert.Eventually(t, func() bool {
+		return downMon.Health()[0].Health == monitor.HealthDown
+	}, 5*time.Second, 10*time.Millisecond)
+	h = downMon.Health()[0]
+	assert.Equal(t, 1, h.ConsecutiveFailures)
+	assert.NotEmpty(t, h.LastError)
+	assert.Equal(t, 10*time.Second, h.Backoff)
+}
@@ -0,0 +1,71 @@
+package monitor
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// kubeProxyRoundTripper rewrites requests to the endpoint into requests to the API server's proxy subresource
+type kubeProxyRoundTripper struct {
+	server *url.URL
+	cfg    *config.KubernetesProxyConfig
+	next   http.RoundTripper
+}
+
+// proxyPath is `/api/v1/namespaces/<namespace>/<resource>/[https:]<name>:<port>/proxy`
+func (k *kubeProxyRoundTripper) proxyPath(scheme string) string {
+	return path.Join("/api/v1/namespaces", k.cfg.Namespace, k.cfg.ProxyResource(), k.cfg.ProxyTarget(scheme), "proxy")
+}
+
+func (k *kubeProxyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	target := *k.server
+	target.Path = strings.TrimSuffix(k.server.Path, "/") + k.proxyPath(req.URL.Scheme) + req.URL.Path
+	target.RawPath = ""
+	target.RawQuery = req.URL.RawQuery
+	req.URL = &target
+	req.Host = ""
+	return k.next.RoundTrip(req)
+}
+
+// kubeRestConfig uses the in-cluster config, unless a kubeconfig is set
+func kubeRestConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	return rest.InClusterConfig()
+}
+
+// newKubeProxyClient authenticates to the API server with the collector's credentials, which are the only
+// credentials sent : the API server doesn't forward them to the target
+func newKubeProxyClient(cfg *config.KubernetesProxyConfig) (*http.Client, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	restCfg, err := kubeRestConfig(cfg.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %w", err)
+	}
+	server, _, err := rest.DefaultServerUrlFor(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := rest.TransportFor(restCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &kubeProxyRoundTripper{
+			server: server,
+			cfg:    cfg,
+			next:   transport,
+		},
+	}, nil
+}
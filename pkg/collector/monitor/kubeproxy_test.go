@@ -0,0 +1,122 @@
+package monitor_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const kubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: %s
+    insecure-skip-tls-verify: true
+users:
+- name: collector
+  user:
+    token: service-account-token
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: collector
+current-context: test
+`
+
+func TestKubernetesProxy(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	var (
+		mu    sync.Mutex
+		paths []string
+	)
+	// credentials are only sent to TLS API servers
+	apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer service-account-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		paths = append(paths, r.URL.RequestURI())
+		mu.Unlock()
+		if !strings.HasPrefix(r.URL.Path, "/api/v1/namespaces/payments/pods/https:api-0:pprof/proxy/debug/pprof/") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(testdata.TestData("heap1.pb"))
+	}))
+	defer apiServer.Close()
+	kubeconfigFile := path.Join(t.TempDir(), "kubeconfig")
+	require.NoError(t, os.WriteFile(kubeconfigFile, []byte(fmt.Sprintf(kubeconfig, apiServer.URL)), 0600))
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name: "api-0",
+		// only identifies the target, the pod is unreachable from the collector
+		Endpoint: "https://10.0.0.1:6060",
+		GlobalSampling: config.GlobalSamplingConfig{
+			Heap: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+		HTTPClient: config.HTTPClientConfig{
+			KubernetesProxy: &config.KubernetesProxyConfig{
+				Namespace:  "payments",
+				Name:       "api-0",
+				Port:       "pprof",
+				Kubeconfig: kubeconfigFile,
+			},
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return mon.Health()[0].Health == monitor.HealthUp
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "/api/v1/namespaces/payments/pods/https:api-0:pprof/proxy/debug/pprof/heap", paths[0])
+}
+
+func TestKubernetesProxyInvalid(t *testing.T) {
+	for _, cfg := range []config.HTTPClientConfig{
+		{
+			BearerToken:     "token",
+			KubernetesProxy: &config.KubernetesProxyConfig{Namespace: "default", Name: "api-0", Port: "6060"},
+		},
+		{
+			KubernetesProxy: &config.KubernetesProxyConfig{Resource: "nodes", Namespace: "default", Name: "api-0", Port: "6060"},
+		},
+		{
+			KubernetesProxy: &config.KubernetesProxyConfig{Namespace: "default", Name: "api-0"},
+		},
+	} {
+		mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+			Name:     "invalid",
+			Endpoint: "http://10.0.0.1:6060",
+			GlobalSampling: config.GlobalSamplingConfig{
+				Heap: &config.SamplerConfig{},
+			},
+			HTTPClient: cfg,
+		}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), scheduler.NewScheduler(slog.Default()))
+		assert.Error(t, mon.Start(context.Background()))
+		assert.NoError(t, mon.Shutdown())
+	}
+}
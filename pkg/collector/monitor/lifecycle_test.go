@@ -9,6 +9,7 @@ import (
 	_ "net/http/pprof"
 
 	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/stretchr/testify/assert"
@@ -29,7 +30,7 @@ func TestLifecycle(t *testing.T) {
 		Name:     "test",
 		Endpoint: "http://localhost:6060",
 		Labels:   map[string]string{},
-	}, storage.NewNoopStore())
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), scheduler.NewScheduler(slog.Default()))
 	ctx, ca := context.WithCancel(context.Background())
 	defer ca()
 
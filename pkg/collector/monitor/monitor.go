@@ -3,12 +3,18 @@ package monitor
 import (
 	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 	"github.com/rancher-sandbox/profiling/pkg/config"
 )
@@ -16,114 +22,164 @@ import (
 type reqWrapper struct {
 	req         *http.Request
 	profileType string
+	interval    time.Duration
+	timeout     time.Duration
+	cumulative  bool
+	// artifact requests are stored as is in the artifact store, instead of being merged
+	artifact bool
+	// exclusive requests never run concurrently against the same endpoint and path
+	exclusive bool
+}
+
+// resource identifies the endpoint and path of an exclusive request, across monitors
+func (r reqWrapper) resource() string {
+	u := *r.req.URL
+	u.RawQuery = ""
+	return u.String()
 }
 
 type Monitor struct {
 	logger *slog.Logger
 	config *config.MonitorConfig
+	// sinks are the configs of every monitor scraping the same target with the same settings,
+	// including config. Profiles are stored once for each of them.
+	sinksMu sync.RWMutex
+	sinks   []*config.MonitorConfig
 
 	lifecycleMu sync.Mutex
-	stopper     chan struct{}
-	ca          context.CancelFunc
-	store       storage.Store
+	scheduler   *scheduler.Scheduler
+	// keys of the jobs scheduled by this monitor
+	scheduled []string
+	client    *http.Client
+	store     storage.Store
+	artifacts storage.ArtifactStore
+	health    *healthTracker
+	deltas    *deltaTracker
+	observer  Observer
 }
 
-func NewMonitor(logger *slog.Logger, config *config.MonitorConfig, store storage.Store) *Monitor {
-	return &Monitor{
+func NewMonitor(
+	logger *slog.Logger,
+	config *config.MonitorConfig,
+	store storage.Store,
+	artifacts storage.ArtifactStore,
+	scheduler *scheduler.Scheduler,
+) *Monitor {
+	m := &Monitor{
 		logger:      logger,
 		config:      config,
-		stopper:     nil,
-		ca:          nil,
+		scheduler:   scheduler,
+		scheduled:   nil,
 		lifecycleMu: sync.Mutex{},
 		store:       store,
+		artifacts:   artifacts,
+		health:      newHealthTracker(newBackoff(config.Backoff)),
+		deltas:      newDeltaTracker(),
 	}
+	m.AddSink(config)
+	return m
 }
 
-func (c *Monitor) newClient() *http.Client {
-	// TODO : configure client
-	// TODO : reuse transport at monitor level or collector level?
-	return http.DefaultClient
-}
-
-func (c *Monitor) constructRequest(suffix string, seconds int) (reqWrapper, error) {
-	target := c.config.Endpoint + "/debug/pprof/" + suffix
-	if seconds != 0 {
-		target += fmt.Sprintf("?seconds=%d", seconds)
+func (c *Monitor) constructRequest(spec config.ProfileSpec) (reqWrapper, error) {
+	if err := spec.Validate(); err != nil {
+		return reqWrapper{}, err
 	}
-	req, err := http.NewRequest("GET", target, nil)
+	target, err := url.Parse(c.config.Endpoint + spec.ProfilePath())
+	if err != nil {
+		return reqWrapper{}, err
+	}
+	query := target.Query()
+	for k, v := range spec.Params {
+		query.Set(k, v)
+	}
+	if spec.Seconds != 0 {
+		query.Set("seconds", strconv.Itoa(spec.Seconds))
+	}
+	target.RawQuery = query.Encode()
+	req, err := http.NewRequest("GET", target.String(), nil)
 	if err != nil {
 		return reqWrapper{}, err
 	}
 	return reqWrapper{
 		req:         req,
-		profileType: suffix,
-	}, err
+		profileType: spec.Name,
+		interval:    spec.Interval(),
+		timeout:     time.Duration(spec.Seconds)*time.Second + c.config.HTTPClient.Timeout(),
+		cumulative:  spec.Cumulative,
+		exclusive:   spec.Exclusive,
+	}, nil
 }
 
-func (c *Monitor) requestsFromMonitorConfig() ([]reqWrapper, error) {
-	reqs := []reqWrapper{}
-
-	if c.config.GlobalSampling.Allocs != nil {
-		req, err := c.constructRequest("allocs", c.config.GlobalSampling.Allocs.Seconds)
-		if err != nil {
-			return nil, err
+// profileSpecs returns the built-in profiles enabled in the monitor's sampling config,
+// followed by its custom profiles
+func (c *Monitor) profileSpecs() ([]config.ProfileSpec, error) {
+	specs := []config.ProfileSpec{}
+	sampling := c.config.GlobalSampling
+	for _, s := range []struct {
+		suffix  string
+		sampler *config.SamplerConfig
+	}{
+		{"allocs", sampling.Allocs},
+		{"block", sampling.Block},
+		{"goroutine", sampling.Goroutine},
+		{"heap", sampling.Heap},
+		{"mutex", sampling.Mutex},
+		{"profile", sampling.Profile},
+		{"threadcreate", sampling.ThreadCreate},
+	} {
+		if s.sampler == nil {
+			continue
 		}
-		reqs = append(reqs, req)
+		specs = append(specs, config.ProfileSpec{
+			Name:          s.suffix,
+			Exclusive:     s.suffix == "profile",
+			SamplerConfig: *s.sampler,
+		})
 	}
-	if c.config.GlobalSampling.Block != nil {
-		req, err := c.constructRequest("block", c.config.GlobalSampling.Block.Seconds)
-		if err != nil {
-			return nil, err
+	for _, s := range []struct {
+		kind    string
+		sampler *config.SamplerConfig
+	}{
+		{exectrace.ArtifactKind, sampling.Trace},
+		{goroutines.ArtifactKind, sampling.GoroutineDump},
+	} {
+		// stored as artifacts, but listed so that custom profiles can't reuse their names
+		if s.sampler != nil {
+			specs = append(specs, artifactSpec(s.kind, *s.sampler))
 		}
-		reqs = append(reqs, req)
 	}
-	if c.config.GlobalSampling.Goroutine != nil {
-		req, err := c.constructRequest("goroutine", c.config.GlobalSampling.Goroutine.Seconds)
-		if err != nil {
-			return nil, err
-		}
-		reqs = append(reqs, req)
-	}
-	if c.config.GlobalSampling.Heap != nil {
-		req, err := c.constructRequest("heap", c.config.GlobalSampling.Heap.Seconds)
-		if err != nil {
-			return nil, err
-		}
-		reqs = append(reqs, req)
+	seen := map[string]struct{}{}
+	for _, spec := range specs {
+		seen[spec.Name] = struct{}{}
 	}
-	if c.config.GlobalSampling.Mutex != nil {
-		req, err := c.constructRequest("mutex", c.config.GlobalSampling.Goroutine.Seconds)
-		if err != nil {
-			return nil, err
+	for _, spec := range c.config.Profiles {
+		if _, ok := seen[spec.Name]; ok {
+			return nil, fmt.Errorf("duplicate profile type %q", spec.Name)
 		}
-		reqs = append(reqs, req)
+		seen[spec.Name] = struct{}{}
+		specs = append(specs, spec)
 	}
-	if c.config.GlobalSampling.Profile != nil {
-		req, err := c.constructRequest("profile", c.config.GlobalSampling.Profile.Seconds)
-		if err != nil {
-			return nil, err
-		}
-		reqs = append(reqs, req)
+	return specs, nil
+}
+
+func (c *Monitor) requestsFromMonitorConfig() ([]reqWrapper, error) {
+	specs, err := c.profileSpecs()
+	if err != nil {
+		return nil, err
 	}
-	if c.config.GlobalSampling.ThreadCreate != nil {
-		req, err := c.constructRequest("threadcreate", c.config.GlobalSampling.ThreadCreate.Seconds)
+	reqs := []reqWrapper{}
+	for _, spec := range specs {
+		req, err := c.constructRequest(spec)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("profile %q: %w", spec.Name, err)
 		}
+		_, req.artifact = artifactKinds[spec.Name]
 		reqs = append(reqs, req)
 	}
-	// Disbale since this conflicts with some other pprof-like functionality
-	// if c.config.GlobalSampling.Trace != nil {
-	// 	req, err := c.constructRequest("trace", c.config.GlobalSampling.Trace.Seconds)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
-	// 	reqs = append(reqs, req)
-	// }
 	return reqs, nil
 }
 
-// Spawns a goroutine to start monitor collection
+// Schedules the monitor's collection jobs on the shared scheduler
 func (c *Monitor) Start(ctx context.Context) error {
 	logger := c.logger.With("name", c.config.Name)
 	logger.Info("configuring monitor...")
@@ -134,69 +190,215 @@ func (c *Monitor) Start(ctx context.Context) error {
 		return err
 	}
 	logger.With("numRequests", len(reqs)).Info("monitors configured, starting...")
-	c.start(ctx, reqs)
-	return nil
+	return c.start(ctx, reqs)
 }
 
-func (c *Monitor) start(ctx context.Context, reqs []reqWrapper) {
-	client := c.newClient()
-	ctxca, ca := context.WithCancel(ctx)
-	c.ca = ca
-	c.stopper = make(chan struct{})
+func (c *Monitor) jobKey(profileType string) string {
+	return c.config.Name + "|" + c.config.Endpoint + "|" + profileType
+}
+
+func (c *Monitor) start(ctx context.Context, reqs []reqWrapper) error {
+	client, err := newHTTPClient(c.config.HTTPClient)
+	if err != nil {
+		return fmt.Errorf("failed to configure http client: %w", err)
+	}
+	c.client = client
 	for _, req := range reqs {
-		req := req
-		doReq := req.req.WithContext(ctxca)
-		go func() {
-			logger := c.logger.With("name", c.config.Name, "endpoint", doReq.URL.Path)
-			for {
-			RETRY:
-				select {
-				case <-c.stopper:
-					logger.Info("monitor shutdown")
-					c.ca()
-					return
-				default:
-					logger.Debug("sending request")
-					startTime := time.Now()
-					resp, err := client.Do(doReq)
-					endTime := time.Now()
-					if err != nil {
-						logger.Error(err.Error())
-					} else {
-						data, err := io.ReadAll(resp.Body)
-						if err != nil {
-							logger.Error(err.Error())
-							// FIXME: backoff retrier
-							time.Sleep(5 * time.Second)
-							goto RETRY
-						}
-						logger.With("start-time", startTime, "end-time", endTime, "size", len(data)).Debug("got response")
-						if err := c.store.Put(startTime, endTime, req.profileType, c.config.Name, c.config.Labels, data); err != nil {
-							logger.With("err", err).Error("failed to store profile")
-						}
-						logger.With("start-time", startTime, "end-time", endTime, "size", len(data)).Debug("stored response")
-					}
+		key := c.jobKey(req.profileType)
+		c.health.register(req.profileType)
+		if err := c.scheduler.Schedule(ctx, key, req.interval, c.scrapeJob(client, req)); err != nil {
+			return err
+		}
+		c.scheduled = append(c.scheduled, key)
+	}
+	return nil
+}
+
+func (c *Monitor) scrapeJob(client *http.Client, req reqWrapper) scheduler.Job {
+	logger := c.logger.With("name", c.config.Name, "endpoint", req.req.URL.Path)
+	return func(ctx context.Context) time.Duration {
+		logger.Debug("sending request")
+		startTime := time.Now()
+		data, err := c.scrape(ctx, client, req)
+		endTime := time.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				// shutting down, not a target failure
+				return 0
+			}
+			delay := c.health.failure(req.profileType, startTime, endTime.Sub(startTime), err)
+			metrics.ScrapeFailures.WithLabelValues(req.profileType, string(failureReason(err))).Inc()
+			logger.With("err", err, "reason", failureReason(err), "backoff", delay).Error("scrape failed")
+			return delay
+		}
+		logger.With("start-time", startTime, "end-time", endTime, "size", len(data)).Debug("got response")
+		c.health.success(req.profileType, startTime, endTime.Sub(startTime), len(data))
+		metrics.ScrapeDuration.WithLabelValues(req.profileType).Observe(endTime.Sub(startTime).Seconds())
+		metrics.ScrapeSize.WithLabelValues(req.profileType).Observe(float64(len(data)))
+		if c.observer != nil {
+			c.observer.Observe(c, req.profileType, data)
+		}
+		if req.artifact {
+			for _, sink := range c.getSinks() {
+				if _, err := c.artifacts.PutArtifact(startTime, endTime, req.profileType, sink.Name, sink.Labels, data); err != nil {
+					logger.With("err", err, "sink", sink.Name).Error("failed to store artifact")
 				}
 			}
-		}()
+			return 0
+		}
+		if req.cumulative {
+			data, err = c.deltas.encodedDelta(req.profileType, data)
+			if err != nil {
+				logger.With("err", err).Error("failed to compute profile delta")
+				return 0
+			}
+			if data == nil {
+				// first scrape of a cumulative profile only serves as a baseline
+				return 0
+			}
+		}
+		for _, sink := range c.getSinks() {
+			if err := c.store.Put(startTime, endTime, req.profileType, sink.Name, sink.Labels, data); err != nil {
+				logger.With("err", err, "sink", sink.Name).Error("failed to store profile")
+			}
+		}
+		logger.With("start-time", startTime, "end-time", endTime, "size", len(data)).Debug("stored response")
+		return 0
+	}
+}
+
+func (c *Monitor) scrape(ctx context.Context, client *http.Client, req reqWrapper) ([]byte, error) {
+	if req.exclusive {
+		release, err := c.scheduler.Acquire(ctx, req.resource())
+		if err != nil {
+			return nil, scrapeErr(ReasonRequest, err)
+		}
+		defer release()
+	}
+	ctx, ca := context.WithTimeout(ctx, req.timeout)
+	defer ca()
+	resp, err := client.Do(req.req.Clone(ctx))
+	if err != nil {
+		return nil, scrapeErr(ReasonRequest, err)
+	}
+	defer resp.Body.Close()
+	if req.artifact {
+		kind := artifactKinds[req.profileType]
+		read := readResponse
+		if kind.text {
+			read = readBody
+		}
+		data, err := read(resp, c.config.MaxResponseSize())
+		if err != nil {
+			return nil, err
+		}
+		if err := kind.validate(data); err != nil {
+			return nil, scrapeErr(kind.reason, err)
+		}
+		return data, nil
+	}
+	data, err := readResponse(resp, c.config.MaxResponseSize())
+	if err != nil {
+		return nil, err
+	}
+	if err := validateProfile(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CaptureTrace collects an execution trace of the given duration from the target, outside of its schedule,
+// and returns the artifact stored for the monitor with the given name
+func (c *Monitor) CaptureTrace(ctx context.Context, name string, seconds int) (storage.Artifact, error) {
+	return c.captureArtifact(ctx, name, artifactSpec(exectrace.ArtifactKind, config.SamplerConfig{Seconds: seconds}))
+}
+
+// CaptureGoroutines collects a goroutine dump from the target, outside of its schedule,
+// and returns the artifact stored for the monitor with the given name
+func (c *Monitor) CaptureGoroutines(ctx context.Context, name string) (storage.Artifact, error) {
+	return c.captureArtifact(ctx, name, artifactSpec(goroutines.ArtifactKind, config.SamplerConfig{}))
+}
+
+func (c *Monitor) captureArtifact(ctx context.Context, name string, spec config.ProfileSpec) (storage.Artifact, error) {
+	c.lifecycleMu.Lock()
+	client := c.client
+	c.lifecycleMu.Unlock()
+	if client == nil {
+		return storage.Artifact{}, fmt.Errorf("monitor %s is not running", c.config.Name)
+	}
+	req, err := c.constructRequest(spec)
+	if err != nil {
+		return storage.Artifact{}, err
+	}
+	req.artifact = true
+	startTime := time.Now()
+	data, err := c.scrape(ctx, client, req)
+	if err != nil {
+		return storage.Artifact{}, err
+	}
+	endTime := time.Now()
+	// the artifact is returned for the requested monitor, and stored for every monitor of the target
+	var ret storage.Artifact
+	for _, sink := range c.getSinks() {
+		artifact, err := c.artifacts.PutArtifact(startTime, endTime, req.profileType, sink.Name, sink.Labels, data)
+		if err != nil {
+			return storage.Artifact{}, err
+		}
+		if sink.Name == name {
+			ret = artifact
+		}
 	}
+	return ret, nil
+}
+
+// AddSink stores the target's profiles for another monitor configured with the same target and settings
+func (c *Monitor) AddSink(cfg *config.MonitorConfig) {
+	c.sinksMu.Lock()
+	defer c.sinksMu.Unlock()
+	c.sinks = append(c.sinks, cfg)
+}
+
+// SetSinks replaces the monitors the target's profiles are stored for, without interrupting scrapes.
+// The configs must only differ from the monitor's config in their name and labels.
+func (c *Monitor) SetSinks(cfgs []*config.MonitorConfig) {
+	c.sinksMu.Lock()
+	defer c.sinksMu.Unlock()
+	c.sinks = slices.Clone(cfgs)
+}
+
+func (c *Monitor) getSinks() []*config.MonitorConfig {
+	c.sinksMu.RLock()
+	defer c.sinksMu.RUnlock()
+	return c.sinks
+}
+
+// HasSink reports whether the monitor stores profiles for the monitor with the given name
+func (c *Monitor) HasSink(name string) bool {
+	for _, sink := range c.getSinks() {
+		if sink.Name == name {
+			return true
+		}
+	}
+	return false
+}
 
+// Health returns the scrape health of each profile type collected by the monitor
+func (c *Monitor) Health() []TargetHealth {
+	return c.health.snapshot()
 }
 
 func (c *Monitor) Shutdown() error {
 	c.lifecycleMu.Lock()
 	defer c.lifecycleMu.Unlock()
 	c.logger.With("name", c.config.Name).Info("shutting down monitor...")
-	// FIXME: hack
-	if c.ca != nil {
-		c.ca()
+	for _, key := range c.scheduled {
+		c.scheduler.Unschedule(key)
 	}
-	if c.stopper != nil {
-		close(c.stopper)
+	c.scheduled = nil
+	c.deltas.reset()
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+		c.client = nil
 	}
-	// select {
-	// case c.stopper <- struct{}{}:
-	// default:
-	// }
 	return nil
 }
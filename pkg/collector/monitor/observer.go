@@ -0,0 +1,40 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Observer is notified of every profile successfully scraped on the monitor's schedule, before it is stored.
+// It is called from the scrape job, so it must return quickly.
+type Observer interface {
+	Observe(mon *Monitor, profileType string, data []byte)
+}
+
+// SetObserver must be called before Start
+func (c *Monitor) SetObserver(o Observer) {
+	c.observer = o
+}
+
+// Fetch reads a path of the target's endpoint with the monitor's client, for signals that aren't profiles
+func (c *Monitor) Fetch(ctx context.Context, path string) ([]byte, error) {
+	c.lifecycleMu.Lock()
+	client := c.client
+	c.lifecycleMu.Unlock()
+	if client == nil {
+		return nil, fmt.Errorf("monitor %s is not running", c.config.Name)
+	}
+	ctx, ca := context.WithTimeout(ctx, c.config.HTTPClient.Timeout())
+	defer ca()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, scrapeErr(ReasonRequest, err)
+	}
+	defer resp.Body.Close()
+	return readBody(resp, c.config.MaxResponseSize())
+}
@@ -0,0 +1,134 @@
+package monitor_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingStore struct {
+	storage.NoopStore
+	mu   sync.Mutex
+	puts map[string][][]byte
+}
+
+func (r *recordingStore) Put(_, _ time.Time, profileType, _ string, _ map[string]string, data []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.puts[profileType] = append(r.puts[profileType], data)
+	return nil
+}
+
+func (r *recordingStore) get(profileType string) [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.puts[profileType]
+}
+
+func counterProfile(t *testing.T, count int64) []byte {
+	fn := &profile.Function{ID: 1, Name: "main.work"}
+	loc := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	p := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "events", Unit: "count"}},
+		Sample:     []*profile.Sample{{Location: []*profile.Location{loc}, Value: []int64{count}}},
+		Location:   []*profile.Location{loc},
+		Function:   []*profile.Function{fn},
+		TimeNanos:  time.Now().UnixNano(),
+	}
+	var buf bytes.Buffer
+	require.NoError(t, p.Write(&buf))
+	return buf.Bytes()
+}
+
+func TestCustomProfiles(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	heap := testdata.TestData("heap1.pb")
+	var counter atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/fgprof", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("seconds") != "1" || r.URL.Query().Get("format") != "pprof" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write(heap)
+	})
+	mux.HandleFunc("/debug/pprof/events", func(w http.ResponseWriter, r *http.Request) {
+		// totals since start, growing by 10 on every scrape
+		w.Write(counterProfile(t, counter.Add(10)))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	store := &recordingStore{puts: map[string][][]byte{}}
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		Profiles: []config.ProfileSpec{
+			{
+				Name:          "fgprof",
+				Path:          "/debug/fgprof",
+				Params:        map[string]string{"format": "pprof"},
+				SamplerConfig: config.SamplerConfig{Seconds: 1},
+			},
+			{
+				Name:          "events",
+				Cumulative:    true,
+				SamplerConfig: config.SamplerConfig{IntervalSeconds: 1},
+			},
+		},
+	}, store, storage.NewNoopArtifactStore(), sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return len(store.get("fgprof")) > 0 && len(store.get("events")) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, h := range mon.Health() {
+		assert.Equal(t, monitor.HealthUp, h.Health, h.ProfileType)
+	}
+
+	delta, err := profile.ParseData(store.get("events")[0])
+	require.NoError(t, err)
+	require.Len(t, delta.Sample, 1)
+	assert.Equal(t, int64(10), delta.Sample[0].Value[0])
+}
+
+func TestCustomProfilesInvalid(t *testing.T) {
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	for name, profiles := range map[string][]config.ProfileSpec{
+		"duplicate builtin": {{Name: "heap"}},
+		"missing name":      {{Path: "/debug/fgprof"}},
+		"invalid name":      {{Name: "a/b"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+				Name:     "test",
+				Endpoint: "http://localhost:6060",
+				GlobalSampling: config.GlobalSamplingConfig{
+					Heap: &config.SamplerConfig{},
+				},
+				Profiles: profiles,
+			}, &storage.NoopStore{}, storage.NewNoopArtifactStore(), sched)
+			assert.Error(t, mon.Start(context.Background()))
+			assert.NoError(t, mon.Shutdown())
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package monitor
+
+import (
+	"maps"
+)
+
+// TargetStatus describes what a monitor scrapes, and how its scrapes are going
+type TargetStatus struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"`
+	Labels   map[string]string `json:"labels"`
+	// Health is down if any profile type is down, up once every profile type is up, unknown otherwise
+	Health       Health         `json:"health"`
+	ProfileTypes []TargetHealth `json:"profileTypes"`
+}
+
+// Status returns the status of the target for each monitor it is scraped for
+func (c *Monitor) Status() []TargetStatus {
+	profileTypes := c.Health()
+	sinks := c.getSinks()
+	ret := make([]TargetStatus, 0, len(sinks))
+	for _, sink := range sinks {
+		ret = append(ret, TargetStatus{
+			Name:         sink.Name,
+			Endpoint:     sink.Endpoint,
+			Labels:       maps.Clone(sink.Labels),
+			Health:       overallHealth(profileTypes),
+			ProfileTypes: profileTypes,
+		})
+	}
+	return ret
+}
+
+func overallHealth(profileTypes []TargetHealth) Health {
+	if len(profileTypes) == 0 {
+		return HealthUnknown
+	}
+	ret := HealthUp
+	for _, th := range profileTypes {
+		switch th.Health {
+		case HealthDown:
+			return HealthDown
+		case HealthUnknown:
+			ret = HealthUnknown
+		}
+	}
+	return ret
+}
@@ -0,0 +1,85 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	trace := testdata.TestData("go122.trace")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/trace", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(trace)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	artifacts := storage.NewFileArtifactStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, nil)
+	store := &countingStore{}
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		Labels: map[string]string{
+			labels.NamespaceLabel: "default",
+			labels.NameLabel:      "example",
+		},
+		GlobalSampling: config.GlobalSamplingConfig{
+			Trace: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+	}, store, artifacts, sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		list, err := artifacts.ListArtifacts(exectrace.ArtifactKind)
+		return err == nil && len(list) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, store.puts.Load())
+
+	artifact, err := mon.CaptureTrace(context.Background(), "test", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "default/example/test", artifact.Key)
+	assert.Equal(t, int64(len(trace)), artifact.Size)
+}
+
+func TestTraceInvalid(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testdata.TestData("heap1.pb"))
+	}))
+	defer server.Close()
+
+	sched := scheduler.NewScheduler(slog.Default())
+	defer sched.Stop()
+	mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+		Name:     "test",
+		Endpoint: server.URL,
+		GlobalSampling: config.GlobalSamplingConfig{
+			Trace: &config.SamplerConfig{IntervalSeconds: 1},
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore(), sched)
+	require.NoError(t, mon.Start(context.Background()))
+	defer mon.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return mon.Health()[0].Health == monitor.HealthDown
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, monitor.ReasonInvalidTrace, mon.Health()[0].LastFailureReason)
+}
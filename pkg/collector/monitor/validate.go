@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// FailureReason classifies why a scrape failed
+type FailureReason string
+
+const (
+	ReasonRequest              FailureReason = "request"
+	ReasonStatusCode           FailureReason = "status_code"
+	ReasonContentType          FailureReason = "content_type"
+	ReasonRead                 FailureReason = "read"
+	ReasonTooLarge             FailureReason = "too_large"
+	ReasonEmpty                FailureReason = "empty"
+	ReasonInvalidProfile       FailureReason = "invalid_profile"
+	ReasonInvalidTrace         FailureReason = "invalid_trace"
+	ReasonInvalidGoroutineDump FailureReason = "invalid_goroutine_dump"
+)
+
+type ScrapeError struct {
+	Reason FailureReason
+	Err    error
+}
+
+func (e *ScrapeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Reason, e.Err)
+}
+
+func (e *ScrapeError) Unwrap() error {
+	return e.Err
+}
+
+func scrapeErr(reason FailureReason, err error) *ScrapeError {
+	return &ScrapeError{Reason: reason, Err: err}
+}
+
+func failureReason(err error) FailureReason {
+	var scrapeErr *ScrapeError
+	if errors.As(err, &scrapeErr) {
+		return scrapeErr.Reason
+	}
+	return ReasonRequest
+}
+
+// readResponse checks the response status and content type, and reads at most maxSize bytes of the body
+func readResponse(resp *http.Response, maxSize int64) ([]byte, error) {
+	if ct := resp.Header.Get("Content-Type"); ct != "" && resp.StatusCode == http.StatusOK {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err == nil && strings.HasPrefix(mediaType, "text/") {
+			return nil, scrapeErr(ReasonContentType, fmt.Errorf("unexpected content type %s", ct))
+		}
+	}
+	return readBody(resp, maxSize)
+}
+
+// readBody reads a response of any content type
+func readBody(resp *http.Response, maxSize int64) ([]byte, error) {
+	if resp.StatusCode != http.StatusOK {
+		// the body of pprof errors is a short plain text message
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, scrapeErr(ReasonStatusCode, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(msg))))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, scrapeErr(ReasonRead, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, scrapeErr(ReasonTooLarge, fmt.Errorf("response exceeds max size of %d bytes", maxSize))
+	}
+	if len(data) == 0 {
+		return nil, scrapeErr(ReasonEmpty, fmt.Errorf("empty response"))
+	}
+	return data, nil
+}
+
+func validateProfile(data []byte) error {
+	p, err := profile.ParseData(data)
+	if err != nil {
+		return scrapeErr(ReasonInvalidProfile, err)
+	}
+	if err := p.CheckValid(); err != nil {
+		return scrapeErr(ReasonInvalidProfile, err)
+	}
+	return nil
+}
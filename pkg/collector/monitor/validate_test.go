@@ -0,0 +1,129 @@
+package monitor_test
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingStore struct {
+	storage.NoopStore
+	puts atomic.Int32
+}
+
+func (c *countingStore) Put(_, _ time.Time, _, _ string, _ map[string]string, _ []byte) error {
+	c.puts.Add(1)
+	return nil
+}
+
+func TestValidation(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	valid := testdata.TestData("heap1.pb")
+	tcs := []struct {
+		name     string
+		handler  http.HandlerFunc
+		maxSize  int64
+		reason   monitor.FailureReason
+		expected monitor.Health
+	}{
+		{
+			name: "not found page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte("<html>not found</html>"))
+			},
+			reason:   monitor.ReasonStatusCode,
+			expected: monitor.HealthDown,
+		},
+		{
+			name: "html page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				w.Write([]byte("<html>login</html>"))
+			},
+			reason:   monitor.ReasonContentType,
+			expected: monitor.HealthDown,
+		},
+		{
+			name: "truncated profile",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(valid[:len(valid)/2])
+			},
+			reason:   monitor.ReasonInvalidProfile,
+			expected: monitor.HealthDown,
+		},
+		{
+			name: "empty",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+			},
+			reason:   monitor.ReasonEmpty,
+			expected: monitor.HealthDown,
+		},
+		{
+			name: "too large",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(valid)
+			},
+			maxSize:  10,
+			reason:   monitor.ReasonTooLarge,
+			expected: monitor.HealthDown,
+		},
+		{
+			name: "valid",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write(valid)
+			},
+			expected: monitor.HealthUp,
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(tc.handler)
+			defer server.Close()
+			sched := scheduler.NewScheduler(slog.Default())
+			defer sched.Stop()
+			store := &countingStore{}
+			failures := metrics.ScrapeFailures.WithLabelValues("heap", string(tc.reason))
+			failuresBefore := testutil.ToFloat64(failures)
+			mon := monitor.NewMonitor(slog.Default(), &config.MonitorConfig{
+				Name:     "test",
+				Endpoint: server.URL,
+				GlobalSampling: config.GlobalSamplingConfig{
+					Heap: &config.SamplerConfig{IntervalSeconds: 1},
+				},
+				MaxResponseBytes: tc.maxSize,
+			}, store, storage.NewNoopArtifactStore(), sched)
+			assert.NoError(t, mon.Start(context.Background()))
+			defer mon.Shutdown()
+
+			assert.Eventually(t, func() bool {
+				return mon.Health()[0].Health == tc.expected
+			}, 5*time.Second, 10*time.Millisecond)
+			h := mon.Health()[0]
+			assert.Equal(t, tc.reason, h.LastFailureReason)
+			if tc.expected == monitor.HealthDown {
+				assert.Zero(t, store.puts.Load())
+				assert.Eventually(t, func() bool {
+					return testutil.ToFloat64(failures) > failuresBefore
+				}, time.Second, 10*time.Millisecond)
+			} else {
+				assert.Equal(t, int32(1), store.puts.Load())
+			}
+		})
+	}
+}
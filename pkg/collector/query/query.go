@@ -0,0 +1,175 @@
+// Package query selects stored series by their labels and merges their profiles over a time window.
+package query
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+var ErrNoData = errors.New("no data")
+
+// Query selects the series of a profile type whose labels match, and the window of their data
+type Query struct {
+	// ProfileType is required to merge profiles, it selects every profile type when listing series
+	ProfileType string
+	Matchers    []*labels.Matcher
+	// Start and End bound the window, zero values leave it open
+	Start time.Time
+	End   time.Time
+}
+
+// Matches reports whether the series matches and has data in the window
+func (q Query) Matches(s storage.Series) bool {
+	if q.ProfileType != "" && s.ProfileType != q.ProfileType {
+		return false
+	}
+	if !q.End.IsZero() && s.Start.After(q.End) {
+		return false
+	}
+	if !q.Start.IsZero() && s.End.Before(q.Start) {
+		return false
+	}
+	return labels.MatchesAll(q.Matchers, s.Labels)
+}
+
+// Select returns the matching series
+func Select(store storage.Store, q Query) ([]storage.Series, error) {
+	series, err := store.Series()
+	if err != nil {
+		return nil, err
+	}
+	ret := []storage.Series{}
+	for _, s := range series {
+		if q.Matches(s) {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+// Profile merges the data of the matching series within the window, it returns ErrNoData when no series
+// has data in the window
+func Profile(store storage.Store, q Query) (*profile.Profile, error) {
+	if q.ProfileType == "" {
+		return nil, fmt.Errorf("profile type is required")
+	}
+	series, err := Select(store, q)
+	if err != nil {
+		return nil, err
+	}
+	profiles := []*profile.Profile{}
+	for _, s := range series {
+		p, err := Window(store, s, q.Start, q.End)
+		if errors.Is(err, ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s/%s: %w", s.ProfileType, s.Key, err)
+		}
+		profiles = append(profiles, p)
+	}
+	return Merge(profiles)
+}
+
+// Merge merges profiles of the same type, it returns ErrNoData when there are none
+func Merge(profiles []*profile.Profile) (*profile.Profile, error) {
+	if len(profiles) == 0 {
+		return nil, ErrNoData
+	}
+	if len(profiles) == 1 {
+		return profiles[0], nil
+	}
+	return profile.Merge(profiles)
+}
+
+// Window returns the data of a series between start and end. Stored profiles hold the data of the series
+// from its start, so the window is the last profile ending before end, minus the last one ending before start.
+// The window is rounded to the stored profiles.
+func Window(store storage.Store, s storage.Series, start, end time.Time) (*profile.Profile, error) {
+	filepaths, err := store.Get(s.ProfileType, s.Key)
+	if err != nil {
+		return nil, err
+	}
+	var top, base string
+	for _, filepath := range filepaths {
+		_, fileEnd, err := storage.ProfileTimes(filepath)
+		if err != nil {
+			return nil, err
+		}
+		if !end.IsZero() && fileEnd.After(end) {
+			break
+		}
+		top = filepath
+		if !start.IsZero() && !fileEnd.After(start) {
+			base = filepath
+		}
+	}
+	if top == "" || top == base {
+		return nil, ErrNoData
+	}
+	p, err := parseFile(top)
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		return p, nil
+	}
+	baseProfile, err := parseFile(base)
+	if err != nil {
+		return nil, err
+	}
+	_, baseEnd, err := storage.ProfileTimes(base)
+	if err != nil {
+		return nil, err
+	}
+	duration := max(0, p.DurationNanos-baseProfile.DurationNanos)
+	diff, err := Diff(p, baseProfile)
+	if err != nil {
+		return nil, err
+	}
+	diff.TimeNanos = baseEnd.UnixNano()
+	diff.DurationNanos = duration
+	return diff, nil
+}
+
+// Diff subtracts base from p, like pprof's -diff_base. The samples that cancel out are dropped
+func Diff(p, base *profile.Profile) (*profile.Profile, error) {
+	base = base.Copy()
+	base.Scale(-1)
+	diff, err := profile.Merge([]*profile.Profile{p, base})
+	if err != nil {
+		return nil, err
+	}
+	diff.Sample = slices.DeleteFunc(diff.Sample, func(sample *profile.Sample) bool {
+		for _, v := range sample.Value {
+			if v != 0 {
+				return false
+			}
+		}
+		return true
+	})
+	return diff.Compact(), nil
+}
+
+// Empty returns a profile of the same types as p, without samples
+func Empty(p *profile.Profile) *profile.Profile {
+	ret := p.Copy()
+	ret.Sample = nil
+	return ret.Compact()
+}
+
+func parseFile(filepath string) (*profile.Profile, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+	return profile.Parse(bytes.NewReader(data))
+}
@@ -0,0 +1,210 @@
+package query_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/query"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func total(t *testing.T, p *profile.Profile) int64 {
+	tree, err := query.Tree(p, len(p.SampleType)-1)
+	require.NoError(t, err)
+	return tree.Total
+}
+
+func parse(t *testing.T, name string) *profile.Profile {
+	p, err := profile.Parse(bytes.NewReader(testdata.TestData(name)))
+	require.NoError(t, err)
+	return p
+}
+
+func TestProfile(t *testing.T) {
+	store := storage.NewLabelBasedFileStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, &storage.PprofMerger{})
+	lbls := func(pod string) map[string]string {
+		return map[string]string{
+			labels.NamespaceLabel: "default",
+			labels.NameLabel:      "api",
+			"pod":                 pod,
+		}
+	}
+	t0 := time.Unix(1000, 0)
+	t1, t2 := t0.Add(time.Minute), t0.Add(2*time.Minute)
+	require.NoError(t, store.Put(t0, t1, "profile", "api-0", lbls("api-0"), testdata.TestData("profile1.pb")))
+	require.NoError(t, store.Put(t1, t2, "profile", "api-0", lbls("api-0"), testdata.TestData("profile2.pb")))
+	require.NoError(t, store.Put(t0, t1, "profile", "api-1", lbls("api-1"), testdata.TestData("profile1.pb")))
+	require.NoError(t, store.Put(t0, t1, "heap", "api-0", lbls("api-0"), testdata.TestData("heap1.pb")))
+
+	p1, p2 := total(t, parse(t, "profile1.pb")), total(t, parse(t, "profile2.pb"))
+	require.NotZero(t, p1)
+	require.NotZero(t, p2)
+
+	pod0, err := labels.NewMatcher(labels.MatchEqual, "pod", "api-0")
+	require.NoError(t, err)
+
+	series, err := query.Select(store, query.Query{Matchers: []*labels.Matcher{pod0}})
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	assert.Equal(t, "heap", series[0].ProfileType)
+	assert.Equal(t, "default/api/api-0", series[1].Key)
+	assert.Equal(t, t0, series[1].Start)
+	assert.Equal(t, t2, series[1].End)
+
+	// the window subtracts the data written before its start
+	p, err := query.Profile(store, query.Query{ProfileType: "profile", Matchers: []*labels.Matcher{pod0}, Start: t1})
+	require.NoError(t, err)
+	assert.Equal(t, p2, total(t, p))
+	p, err = query.Profile(store, query.Query{ProfileType: "profile", Matchers: []*labels.Matcher{pod0}, End: t1})
+	require.NoError(t, err)
+	assert.Equal(t, p1, total(t, p))
+
+	// series are merged
+	p, err = query.Profile(store, query.Query{ProfileType: "profile"})
+	require.NoError(t, err)
+	assert.Equal(t, 2*p1+p2, total(t, p))
+	p, err = query.Profile(store, query.Query{ProfileType: "profile", Start: t1})
+	require.NoError(t, err)
+	assert.Equal(t, p2, total(t, p))
+
+	_, err = query.Profile(store, query.Query{ProfileType: "profile", Start: t2})
+	assert.ErrorIs(t, err, query.ErrNoData)
+	_, err = query.Profile(store, query.Query{ProfileType: "mutex"})
+	assert.ErrorIs(t, err, query.ErrNoData)
+}
+
+func TestRender(t *testing.T) {
+	p := parse(t, "profile1.pb")
+	tree, err := query.Tree(p, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "root", tree.Name)
+	var sum func(n *query.Node) int64
+	sum = func(n *query.Node) int64 {
+		ret := n.Self
+		for i, c := range n.Children {
+			if i > 0 {
+				assert.GreaterOrEqual(t, n.Children[i-1].Total, c.Total)
+			}
+			ret += sum(c)
+		}
+		assert.Equal(t, n.Total, ret, n.Name)
+		return ret
+	}
+	sum(tree)
+	_, err = query.Tree(p, len(p.SampleType))
+	assert.Error(t, err)
+
+	jp := query.ToJSON(p)
+	assert.Len(t, jp.Samples, len(p.Sample))
+	assert.Len(t, jp.SampleTypes, len(p.SampleType))
+	assert.NotEmpty(t, jp.Samples[0].Stack[0].Function)
+}
+
+func TestFlamegraph(t *testing.T) {
+	p := parse(t, "profile1.pb")
+	full, err := query.Options{SampleType: "cpu"}.Flamegraph(p)
+	require.NoError(t, err)
+
+	focused, err := query.Options{SampleType: "cpu", Focus: regexp.MustCompile("runtime.findRunnable")}.Flamegraph(p)
+	require.NoError(t, err)
+	assert.Less(t, focused.Total, full.Total)
+	assert.NotZero(t, focused.Total)
+
+	ignored, err := query.Options{SampleType: "cpu", Ignore: regexp.MustCompile("runtime.findRunnable")}.Flamegraph(p)
+	require.NoError(t, err)
+	assert.Equal(t, full.Total, focused.Total+ignored.Total)
+
+	hidden, err := query.Options{SampleType: "cpu", Hide: regexp.MustCompile("runtime.mcall")}.Flamegraph(p)
+	require.NoError(t, err)
+	assert.Equal(t, full.Total, hidden.Total)
+	for _, c := range hidden.Children {
+		assert.NotEqual(t, "runtime.mcall", c.Name)
+	}
+
+	trimmed, err := query.Options{SampleType: "cpu", NodeFraction: 0.5}.Flamegraph(p)
+	require.NoError(t, err)
+	assert.Equal(t, full.Total, trimmed.Total)
+	var check func(n *query.Node)
+	check = func(n *query.Node) {
+		for _, c := range n.Children {
+			assert.GreaterOrEqual(t, c.Total, full.Total/2)
+			check(c)
+		}
+	}
+	check(trimmed)
+
+	_, err = query.Options{SampleType: "unknown"}.Flamegraph(p)
+	assert.Error(t, err)
+	_, err = query.Options{NodeFraction: 2}.Flamegraph(p)
+	assert.Error(t, err)
+	// the profile isn't modified
+	assert.Equal(t, full.Total, total(t, p))
+}
+
+func TestTop(t *testing.T) {
+	p := parse(t, "profile1.pb")
+	top, err := query.Options{SampleType: "cpu"}.Top(p, query.SortFlat, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "cpu", top.SampleType.Type)
+	assert.Equal(t, total(t, p), top.Total)
+	var flat int64
+	for i, f := range top.Functions {
+		flat += f.Flat
+		assert.LessOrEqual(t, f.Flat, f.Cum)
+		assert.InDelta(t, 100*float64(f.Cum)/float64(top.Total), f.CumPercent, 0.001)
+		if i > 0 {
+			assert.GreaterOrEqual(t, top.Functions[i-1].Flat, f.Flat)
+		}
+	}
+	assert.Equal(t, top.Total, flat)
+
+	byCum, err := query.Options{SampleType: "cpu"}.Top(p, query.SortCum, 3)
+	require.NoError(t, err)
+	require.Len(t, byCum.Functions, 3)
+	for _, f := range top.Functions {
+		assert.GreaterOrEqual(t, byCum.Functions[0].Cum, f.Cum)
+	}
+	assert.GreaterOrEqual(t, byCum.Functions[0].Cum, byCum.Functions[1].Cum)
+}
+
+func TestDiff(t *testing.T) {
+	p1, p2 := parse(t, "profile1.pb"), parse(t, "profile2.pb")
+
+	diff, err := query.Diff(p2, p1)
+	require.NoError(t, err)
+	assert.Equal(t, total(t, p2)-total(t, p1), total(t, diff))
+
+	// identical profiles cancel out
+	diff, err = query.Diff(p1, p1)
+	require.NoError(t, err)
+	assert.Empty(t, diff.Sample)
+
+	empty := query.Empty(p1)
+	assert.Empty(t, empty.Sample)
+	require.Len(t, empty.SampleType, len(p1.SampleType))
+	for i, st := range p1.SampleType {
+		assert.Equal(t, st.Type, empty.SampleType[i].Type)
+	}
+	diff, err = query.Diff(empty, p1)
+	require.NoError(t, err)
+	assert.Equal(t, -total(t, p1), total(t, diff))
+
+	// percentages are relative to the base
+	opts := query.Options{SampleType: "cpu"}.RelativeTo(p1)
+	assert.Equal(t, total(t, p1), opts.Total)
+	top, err := opts.Top(diff, query.SortFlat, 0)
+	require.NoError(t, err)
+	var flatPercent float64
+	for _, f := range top.Functions {
+		assert.LessOrEqual(t, f.Flat, int64(0))
+		flatPercent += f.FlatPercent
+	}
+	assert.InDelta(t, -100, flatPercent, 0.001)
+}
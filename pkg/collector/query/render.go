@@ -0,0 +1,239 @@
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// Options filter the samples of a profile before it is rendered, like the options of the same name of pprof
+type Options struct {
+	// SampleType is the name of the rendered sample type, defaults to the profile's default sample type
+	SampleType string
+	// Focus keeps the samples with a frame matching the function or file name, Ignore drops them
+	Focus  *regexp.Regexp
+	Ignore *regexp.Regexp
+	// Hide removes the matching frames from the stacks
+	Hide *regexp.Regexp
+	// NodeFraction drops the tree nodes whose total is below this fraction of the reference total
+	NodeFraction float64
+	// Total is the reference of node fractions and percentages, defaults to the sum of the absolute sample
+	// values. Diffs are relative to the total of their base, like pprof's
+	Total int64
+}
+
+// reference returns the total that fractions and percentages are relative to
+func (o Options) reference(p *profile.Profile, sampleIndex int) int64 {
+	if o.Total != 0 {
+		return o.Total
+	}
+	var ret int64
+	for _, s := range p.Sample {
+		ret += abs(s.Value[sampleIndex])
+	}
+	return ret
+}
+
+// RelativeTo makes fractions and percentages relative to the total of base, for diffs against it
+func (o Options) RelativeTo(base *profile.Profile) Options {
+	sampleIndex, err := base.SampleIndexByName(o.SampleType)
+	if err != nil {
+		return o
+	}
+	o.Total = 0
+	o.Total = o.reference(base, sampleIndex)
+	return o
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Apply filters a copy of the profile, and returns the index of the rendered sample type
+func (o Options) Apply(p *profile.Profile) (*profile.Profile, int, error) {
+	if o.NodeFraction < 0 || o.NodeFraction > 1 {
+		return nil, 0, fmt.Errorf("node fraction must be between 0 and 1")
+	}
+	sampleIndex, err := p.SampleIndexByName(o.SampleType)
+	if err != nil {
+		return nil, 0, err
+	}
+	p = p.Copy()
+	p.FilterSamplesByName(o.Focus, o.Ignore, o.Hide, nil)
+	return p, sampleIndex, nil
+}
+
+// Flamegraph renders the call tree of the filtered profile, trimmed to the node fraction
+func (o Options) Flamegraph(p *profile.Profile) (*Node, error) {
+	p, sampleIndex, err := o.Apply(p)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := Tree(p, sampleIndex)
+	if err != nil {
+		return nil, err
+	}
+	tree.Trim(int64(o.NodeFraction * float64(o.reference(p, sampleIndex))))
+	return tree, nil
+}
+
+type ValueType struct {
+	Type string `json:"type"`
+	Unit string `json:"unit"`
+}
+
+type Frame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int64  `json:"line,omitempty"`
+}
+
+type Sample struct {
+	// Stack is ordered from the leaf, inlined functions included
+	Stack  []Frame             `json:"stack"`
+	Values []int64             `json:"values"`
+	Labels map[string][]string `json:"labels,omitempty"`
+	Num    map[string][]int64  `json:"numLabels,omitempty"`
+}
+
+// JSONProfile is a denormalized profile, for clients that can't decode pprof's protobuf format
+type JSONProfile struct {
+	SampleTypes   []ValueType `json:"sampleTypes"`
+	PeriodType    *ValueType  `json:"periodType,omitempty"`
+	Period        int64       `json:"period"`
+	TimeNanos     int64       `json:"timeNanos"`
+	DurationNanos int64       `json:"durationNanos"`
+	Samples       []Sample    `json:"samples"`
+}
+
+func ToJSON(p *profile.Profile) JSONProfile {
+	ret := JSONProfile{
+		SampleTypes:   make([]ValueType, 0, len(p.SampleType)),
+		Period:        p.Period,
+		TimeNanos:     p.TimeNanos,
+		DurationNanos: p.DurationNanos,
+		Samples:       make([]Sample, 0, len(p.Sample)),
+	}
+	for _, st := range p.SampleType {
+		ret.SampleTypes = append(ret.SampleTypes, ValueType{Type: st.Type, Unit: st.Unit})
+	}
+	if p.PeriodType != nil {
+		ret.PeriodType = &ValueType{Type: p.PeriodType.Type, Unit: p.PeriodType.Unit}
+	}
+	for _, s := range p.Sample {
+		sample := Sample{
+			Stack:  []Frame{},
+			Values: s.Value,
+			Labels: s.Label,
+			Num:    s.NumLabel,
+		}
+		for _, loc := range s.Location {
+			sample.Stack = append(sample.Stack, locationFrames(loc)...)
+		}
+		ret.Samples = append(ret.Samples, sample)
+	}
+	return ret
+}
+
+// locationFrames returns the frames of a location, from the innermost inlined function
+func locationFrames(loc *profile.Location) []Frame {
+	if len(loc.Line) == 0 {
+		return []Frame{{Function: fmt.Sprintf("0x%x", loc.Address)}}
+	}
+	ret := make([]Frame, 0, len(loc.Line))
+	for _, line := range loc.Line {
+		if line.Function == nil || line.Function.Name == "" {
+			ret = append(ret, Frame{Function: fmt.Sprintf("0x%x", loc.Address)})
+			continue
+		}
+		ret = append(ret, Frame{
+			Function: line.Function.Name,
+			File:     line.Function.Filename,
+			Line:     line.Line,
+		})
+	}
+	return ret
+}
+
+// Node is a function of the call tree, its children are the functions it calls
+type Node struct {
+	Name string `json:"name"`
+	// Self is the value of the samples whose leaf is this node
+	Self int64 `json:"self"`
+	// Total is the value of the samples going through this node
+	Total    int64   `json:"total"`
+	Children []*Node `json:"children,omitempty"`
+
+	index map[string]*Node
+}
+
+func (n *Node) child(name string) *Node {
+	if n.index == nil {
+		n.index = map[string]*Node{}
+	}
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	c := &Node{Name: name}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+func (n *Node) sort() {
+	slices.SortFunc(n.Children, func(a, b *Node) int {
+		if c := cmp.Compare(b.Total, a.Total); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// Tree builds the call tree of a sample type of the profile, from a root node holding the total.
+// Children are sorted by total, largest first
+func Tree(p *profile.Profile, sampleIndex int) (*Node, error) {
+	if sampleIndex < 0 || sampleIndex >= len(p.SampleType) {
+		return nil, fmt.Errorf("sample index %d out of range", sampleIndex)
+	}
+	root := &Node{Name: "root"}
+	for _, s := range p.Sample {
+		value := s.Value[sampleIndex]
+		if value == 0 {
+			continue
+		}
+		frames := []Frame{}
+		for _, loc := range s.Location {
+			frames = append(frames, locationFrames(loc)...)
+		}
+		root.Total += value
+		node := root
+		for i := len(frames) - 1; i >= 0; i-- {
+			node = node.child(frames[i].Function)
+			node.Total += value
+		}
+		node.Self += value
+	}
+	root.sort()
+	return root, nil
+}
+
+// Trim drops the descendants whose absolute total is below minTotal, their values are only kept in the totals
+// of their ancestors
+func (n *Node) Trim(minTotal int64) {
+	n.Children = slices.DeleteFunc(n.Children, func(c *Node) bool {
+		return abs(c.Total) < minTotal
+	})
+	for _, c := range n.Children {
+		c.Trim(minTotal)
+	}
+}
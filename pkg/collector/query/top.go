@@ -0,0 +1,103 @@
+package query
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// Function is a row of the top functions table
+type Function struct {
+	Name string `json:"name"`
+	// Flat is the value of the samples whose leaf is this function
+	Flat        int64   `json:"flat"`
+	FlatPercent float64 `json:"flatPercent"`
+	// Cum is the value of the samples going through this function, recursive calls counted once
+	Cum        int64   `json:"cum"`
+	CumPercent float64 `json:"cumPercent"`
+}
+
+// TopTable lists the functions with the largest values of a sample type
+type TopTable struct {
+	SampleType ValueType  `json:"sampleType"`
+	Total      int64      `json:"total"`
+	Functions  []Function `json:"functions"`
+}
+
+const (
+	SortFlat = "flat"
+	SortCum  = "cum"
+)
+
+// Top renders the limit functions of the filtered profile with the largest flat or cumulative values,
+// every function when limit is 0
+func (o Options) Top(p *profile.Profile, sortBy string, limit int) (TopTable, error) {
+	p, sampleIndex, err := o.Apply(p)
+	if err != nil {
+		return TopTable{}, err
+	}
+	st := p.SampleType[sampleIndex]
+	ret := TopTable{
+		SampleType: ValueType{Type: st.Type, Unit: st.Unit},
+		Functions:  []Function{},
+	}
+	functions := map[string]*Function{}
+	function := func(name string) *Function {
+		if f, ok := functions[name]; ok {
+			return f
+		}
+		f := &Function{Name: name}
+		functions[name] = f
+		return f
+	}
+	for _, s := range p.Sample {
+		value := s.Value[sampleIndex]
+		if value == 0 {
+			continue
+		}
+		frames := []Frame{}
+		for _, loc := range s.Location {
+			frames = append(frames, locationFrames(loc)...)
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		ret.Total += value
+		function(frames[0].Function).Flat += value
+		seen := map[string]struct{}{}
+		for _, frame := range frames {
+			if _, ok := seen[frame.Function]; ok {
+				continue
+			}
+			seen[frame.Function] = struct{}{}
+			function(frame.Function).Cum += value
+		}
+	}
+	reference := o.reference(p, sampleIndex)
+	for _, f := range functions {
+		if reference != 0 {
+			f.FlatPercent = 100 * float64(f.Flat) / float64(reference)
+			f.CumPercent = 100 * float64(f.Cum) / float64(reference)
+		}
+		ret.Functions = append(ret.Functions, *f)
+	}
+	slices.SortFunc(ret.Functions, func(a, b Function) int {
+		first, second := cmp.Compare(b.Flat, a.Flat), cmp.Compare(b.Cum, a.Cum)
+		if sortBy == SortCum {
+			first, second = second, first
+		}
+		if first != 0 {
+			return first
+		}
+		if second != 0 {
+			return second
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if limit > 0 && len(ret.Functions) > limit {
+		ret.Functions = ret.Functions[:limit]
+	}
+	return ret, nil
+}
@@ -0,0 +1,193 @@
+// Package relabel implements Prometheus-style relabeling of target labels
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+const (
+	// MetaPrefix labels describe a target and are only available during relabeling
+	MetaPrefix = "__meta_"
+	// AddressLabel holds the monitor's endpoint during relabeling, rewriting it changes the scraped endpoint
+	AddressLabel = "__address__"
+	// MonitorNameLabel holds the monitor's name during relabeling
+	MonitorNameLabel = "__monitor_name__"
+)
+
+type rule struct {
+	cfg         config.RelabelConfig
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// Relabeler applies a compiled list of relabeling rules
+type Relabeler struct {
+	rules []rule
+}
+
+func New(cfgs []config.RelabelConfig) (*Relabeler, error) {
+	r := &Relabeler{}
+	for i, cfg := range cfgs {
+		compiled, err := compile(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("relabel config %d: %w", i, err)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+func compile(cfg config.RelabelConfig) (rule, error) {
+	if cfg.Action == "" {
+		cfg.Action = config.RelabelReplace
+	}
+	if cfg.Separator == "" {
+		cfg.Separator = config.DefaultRelabelSeparator
+	}
+	expr := cfg.Regex
+	if expr == "" {
+		expr = config.DefaultRelabelRegex
+	}
+	regex, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return rule{}, fmt.Errorf("invalid regex %q: %w", expr, err)
+	}
+	replacement := config.DefaultRelabelReplacement
+	if cfg.Replacement != nil {
+		replacement = *cfg.Replacement
+	}
+	switch cfg.Action {
+	case config.RelabelReplace:
+		if cfg.TargetLabel == "" {
+			return rule{}, fmt.Errorf("%s requires target_label", cfg.Action)
+		}
+	case config.RelabelHashMod:
+		if cfg.TargetLabel == "" {
+			return rule{}, fmt.Errorf("%s requires target_label", cfg.Action)
+		}
+		if cfg.Modulus == 0 {
+			return rule{}, fmt.Errorf("%s requires a non zero modulus", cfg.Action)
+		}
+	case config.RelabelKeep, config.RelabelDrop, config.RelabelLabelMap, config.RelabelLabelDrop, config.RelabelLabelKeep:
+	default:
+		return rule{}, fmt.Errorf("unknown action %q", cfg.Action)
+	}
+	return rule{cfg: cfg, regex: regex, replacement: replacement}, nil
+}
+
+// Process returns the relabeled labels, or false when the target is dropped. lbls is not modified.
+func (r *Relabeler) Process(lbls map[string]string) (map[string]string, bool) {
+	ret := maps.Clone(lbls)
+	if ret == nil {
+		ret = map[string]string{}
+	}
+	for _, rule := range r.rules {
+		if !rule.apply(ret) {
+			return nil, false
+		}
+	}
+	return ret, true
+}
+
+func (r rule) sourceValue(lbls map[string]string) string {
+	values := make([]string, 0, len(r.cfg.SourceLabels))
+	for _, name := range r.cfg.SourceLabels {
+		values = append(values, lbls[name])
+	}
+	return strings.Join(values, r.cfg.Separator)
+}
+
+func (r rule) apply(lbls map[string]string) bool {
+	switch r.cfg.Action {
+	case config.RelabelKeep:
+		return r.regex.MatchString(r.sourceValue(lbls))
+	case config.RelabelDrop:
+		return !r.regex.MatchString(r.sourceValue(lbls))
+	case config.RelabelReplace:
+		value := r.sourceValue(lbls)
+		indexes := r.regex.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.cfg.TargetLabel, value, indexes))
+		res := string(r.regex.ExpandString(nil, r.replacement, value, indexes))
+		if target == "" {
+			return true
+		}
+		if res == "" {
+			delete(lbls, target)
+			return true
+		}
+		lbls[target] = res
+	case config.RelabelHashMod:
+		lbls[r.cfg.TargetLabel] = strconv.FormatUint(HashMod(r.sourceValue(lbls), r.cfg.Modulus), 10)
+	case config.RelabelLabelMap:
+		for name, value := range maps.Clone(lbls) {
+			if r.regex.MatchString(name) {
+				lbls[r.regex.ReplaceAllString(name, r.replacement)] = value
+			}
+		}
+	case config.RelabelLabelDrop:
+		for name := range maps.Clone(lbls) {
+			if r.regex.MatchString(name) {
+				delete(lbls, name)
+			}
+		}
+	case config.RelabelLabelKeep:
+		for name := range maps.Clone(lbls) {
+			if !r.regex.MatchString(name) {
+				delete(lbls, name)
+			}
+		}
+	}
+	return true
+}
+
+// HashMod returns the hashmod of value, as computed by the hashmod action
+func HashMod(value string, modulus uint64) uint64 {
+	sum := md5.Sum([]byte(value))
+	return binary.BigEndian.Uint64(sum[8:]) % modulus
+}
+
+// Monitor applies the monitor's relabelings to its labels and endpoint, returning a copy of the config,
+// or false when the monitor is dropped. Reserved labels other than the kubernetes index labels are
+// removed afterwards.
+func Monitor(cfg *config.MonitorConfig) (*config.MonitorConfig, bool, error) {
+	r, err := New(cfg.Relabelings)
+	if err != nil {
+		return nil, false, err
+	}
+	lbls := maps.Clone(cfg.Labels)
+	if lbls == nil {
+		lbls = map[string]string{}
+	}
+	lbls[AddressLabel] = cfg.Endpoint
+	lbls[MonitorNameLabel] = cfg.Name
+	out, keep := r.Process(lbls)
+	if !keep {
+		return nil, false, nil
+	}
+	ret := *cfg
+	ret.Endpoint = out[AddressLabel]
+	ret.Relabelings = nil
+	ret.Labels = map[string]string{}
+	for k, v := range out {
+		if strings.HasPrefix(k, labels.ReservedPrefix) && !strings.HasPrefix(k, labels.K8sPrefix) {
+			continue
+		}
+		ret.Labels[k] = v
+	}
+	if ret.Endpoint == "" {
+		return nil, false, fmt.Errorf("relabeling removed the endpoint of monitor %s", cfg.Name)
+	}
+	return &ret, true, nil
+}
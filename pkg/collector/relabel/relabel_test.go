@@ -0,0 +1,194 @@
+package relabel_test
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestProcess(t *testing.T) {
+	input := map[string]string{
+		"__meta_kubernetes_namespace":             "payments",
+		"__meta_kubernetes_service_label_team":    "checkout",
+		"__meta_kubernetes_service_label_env":     "prod",
+		"__meta_kubernetes_pod_name":              "api-7d9f",
+		"__address__":                             "http://10.0.0.1:6060",
+		"__k8s_namespace":                         "payments",
+		"__meta_kubernetes_service_annotation_ok": "true",
+	}
+	tcs := []struct {
+		name     string
+		cfgs     []config.RelabelConfig
+		expected map[string]string
+		dropped  bool
+	}{
+		{
+			name: "replace with capture group",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_pod_name"},
+				Regex:        "(.*)-[^-]+",
+				TargetLabel:  "deployment",
+			}},
+			expected: map[string]string{"deployment": "api"},
+		},
+		{
+			name: "replace joins source labels",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_service_label_team", "__meta_kubernetes_service_label_env"},
+				Separator:    "/",
+				TargetLabel:  "owner",
+			}},
+			expected: map[string]string{"owner": "checkout/prod"},
+		},
+		{
+			name: "replace without match is a noop",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_pod_name"},
+				Regex:        "web-.*",
+				TargetLabel:  "deployment",
+				Replacement:  ptr("web"),
+			}},
+			expected: map[string]string{},
+		},
+		{
+			name: "keep",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_service_label_env"},
+				Regex:        "prod|staging",
+				Action:       config.RelabelKeep,
+			}},
+			expected: map[string]string{},
+		},
+		{
+			name: "keep drops unmatched targets",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_service_label_env"},
+				Regex:        "dev",
+				Action:       config.RelabelKeep,
+			}},
+			dropped: true,
+		},
+		{
+			name: "drop",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__meta_kubernetes_namespace"},
+				Regex:        "pay.*",
+				Action:       config.RelabelDrop,
+			}},
+			dropped: true,
+		},
+		{
+			name: "labelmap",
+			cfgs: []config.RelabelConfig{{
+				Regex:  "__meta_kubernetes_service_label_(.+)",
+				Action: config.RelabelLabelMap,
+			}},
+			expected: map[string]string{"team": "checkout", "env": "prod"},
+		},
+		{
+			name: "labelmap then labeldrop",
+			cfgs: []config.RelabelConfig{
+				{
+					Regex:  "__meta_kubernetes_service_label_(.+)",
+					Action: config.RelabelLabelMap,
+				},
+				{
+					Regex:  "env",
+					Action: config.RelabelLabelDrop,
+				},
+			},
+			expected: map[string]string{"team": "checkout"},
+		},
+		{
+			name: "hashmod",
+			cfgs: []config.RelabelConfig{{
+				SourceLabels: []string{"__address__"},
+				Modulus:      4,
+				TargetLabel:  "shard",
+				Action:       config.RelabelHashMod,
+			}},
+			expected: map[string]string{"shard": "2"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := relabel.New(tc.cfgs)
+			require.NoError(t, err)
+			out, keep := r.Process(input)
+			assert.Equal(t, !tc.dropped, keep)
+			if tc.dropped {
+				return
+			}
+			for k, v := range tc.expected {
+				assert.Equal(t, v, out[k], k)
+			}
+			// the input is left untouched
+			assert.Len(t, input, 7)
+		})
+	}
+}
+
+func TestHashMod(t *testing.T) {
+	assert.Equal(t, relabel.HashMod("http://10.0.0.1:6060", 4), relabel.HashMod("http://10.0.0.1:6060", 4))
+	counts := map[uint64]int{}
+	for _, addr := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"} {
+		counts[relabel.HashMod(addr, 3)]++
+	}
+	assert.Len(t, counts, 3)
+}
+
+func TestInvalid(t *testing.T) {
+	for name, cfg := range map[string]config.RelabelConfig{
+		"unknown action":        {Action: "rename"},
+		"invalid regex":         {Regex: "(", Action: config.RelabelKeep},
+		"replace without label": {SourceLabels: []string{"a"}},
+		"hashmod without mod":   {TargetLabel: "shard", Action: config.RelabelHashMod},
+	} {
+		_, err := relabel.New([]config.RelabelConfig{cfg})
+		assert.Error(t, err, name)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	cfg := &config.MonitorConfig{
+		Name:     "api-7d9f",
+		Endpoint: "http://10.0.0.1:6060",
+		Labels: map[string]string{
+			"__k8s_namespace":                      "payments",
+			"__k8s_name":                           "api",
+			"__meta_kubernetes_service_label_team": "checkout",
+		},
+		Relabelings: []config.RelabelConfig{
+			{
+				Regex:  "__meta_kubernetes_service_label_(.+)",
+				Action: config.RelabelLabelMap,
+			},
+			{
+				SourceLabels: []string{"__address__"},
+				Regex:        "http://(.*)",
+				TargetLabel:  "__address__",
+				Replacement:  ptr("https://$1"),
+			},
+		},
+	}
+	relabeled, keep, err := relabel.Monitor(cfg)
+	require.NoError(t, err)
+	require.True(t, keep)
+	assert.Equal(t, "https://10.0.0.1:6060", relabeled.Endpoint)
+	assert.Equal(t, map[string]string{
+		"__k8s_namespace": "payments",
+		"__k8s_name":      "api",
+		"team":            "checkout",
+	}, relabeled.Labels)
+	assert.Nil(t, relabeled.Relabelings)
+	// the original config is left untouched
+	assert.Equal(t, "http://10.0.0.1:6060", cfg.Endpoint)
+	assert.Len(t, cfg.Labels, 3)
+}
@@ -0,0 +1,84 @@
+package collector_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func monitorConfig(name, endpoint, namespace string, interval int) *config.MonitorConfig {
+	return &config.MonitorConfig{
+		Name:     name,
+		Endpoint: endpoint,
+		Labels:   map[string]string{"__k8s_namespace": namespace},
+		GlobalSampling: config.GlobalSamplingConfig{
+			Heap: &config.SamplerConfig{IntervalSeconds: interval},
+		},
+	}
+}
+
+func TestIncrementalReload(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+	c := collector.NewCollector(ctx, slog.Default(), &config.CollectorConfig{
+		SelfTelemetry: &config.SelfTelemetryConfig{
+			PprofPort:       7771,
+			IntervalSeconds: 60,
+		},
+		Monitors: []*config.MonitorConfig{
+			monitorConfig("unchanged", "http://localhost:6071", "default", 60),
+			monitorConfig("relabeled", "http://localhost:6072", "default", 60),
+			monitorConfig("resampled", "http://localhost:6073", "default", 60),
+			monitorConfig("removed", "http://localhost:6074", "default", 60),
+		},
+	}, storage.NewNoopStore(), storage.NewNoopArtifactStore())
+	require.NoError(t, c.Start(ctx))
+	defer c.Shutdown()
+	require.Len(t, c.Monitors, 5)
+	self, unchanged, relabeled := c.Monitors[0], c.Monitors[1], c.Monitors[2]
+
+	report, err := c.Reload(&config.CollectorConfig{
+		SelfTelemetry: &config.SelfTelemetryConfig{
+			PprofPort:       7771,
+			IntervalSeconds: 60,
+		},
+		Monitors: []*config.MonitorConfig{
+			monitorConfig("unchanged", "http://localhost:6071", "default", 60),
+			monitorConfig("relabeled", "http://localhost:6072", "other", 60),
+			monitorConfig("resampled", "http://localhost:6073", "default", 30),
+			monitorConfig("added", "http://localhost:6075", "default", 60),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"added"}, report.Added)
+	assert.Equal(t, []string{"removed"}, report.Removed)
+	assert.Equal(t, []string{"relabeled", "resampled"}, report.Changed)
+	assert.Equal(t, 1, report.Unchanged)
+	// the relabeled target keeps scraping, only storing under its new labels
+	assert.Equal(t, 2, report.StartedScrapers)
+	assert.Equal(t, 2, report.StoppedScrapers)
+	assert.Equal(t, "unchanged", report.SelfTelemetry)
+
+	require.Len(t, c.Monitors, 5)
+	assert.Same(t, self, c.Monitors[0])
+	assert.Same(t, unchanged, c.Monitors[1])
+	assert.Same(t, relabeled, c.Monitors[2])
+	targets := c.Targets()
+	require.Len(t, targets, 5)
+	assert.Equal(t, "relabeled", targets[2].Name)
+	assert.Equal(t, "other", targets[2].Labels["__k8s_namespace"])
+
+	report, err = c.Reload(&config.CollectorConfig{})
+	require.NoError(t, err)
+	assert.Len(t, report.Removed, 4)
+	assert.Equal(t, 4, report.StoppedScrapers)
+	assert.Equal(t, "stopped", report.SelfTelemetry)
+	assert.Empty(t, c.Monitors)
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+import "context"
+
+type resource struct {
+	sem  chan struct{}
+	refs int
+}
+
+// Acquire blocks until no other job holds the resource, or ctx is done.
+// Jobs hold a resource while making requests that a target refuses to serve concurrently,
+// like CPU profiles and execution traces.
+func (s *Scheduler) Acquire(ctx context.Context, name string) (release func(), err error) {
+	s.mu.Lock()
+	r, ok := s.resources[name]
+	if !ok {
+		r = &resource{sem: make(chan struct{}, 1)}
+		s.resources[name] = r
+	}
+	r.refs++
+	s.mu.Unlock()
+
+	select {
+	case r.sem <- struct{}{}:
+		return func() {
+			<-r.sem
+			s.unref(name, r)
+		}, nil
+	case <-ctx.Done():
+		s.unref(name, r)
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Scheduler) unref(name string, r *resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.refs--
+	if r.refs == 0 {
+		delete(s.resources, name)
+	}
+}
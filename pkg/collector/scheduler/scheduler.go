@@ -0,0 +1,142 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Job is a single scheduled run, it should return once ctx is done.
+// The returned delay is the minimum time to wait before the next run, for example to back off
+// from a failing target; zero keeps the regular interval.
+type Job func(ctx context.Context) (delay time.Duration)
+
+// Scheduler runs jobs at fixed intervals. Each job is offset within its interval by a hash of its key,
+// so that jobs sharing an interval are spread out instead of all firing at the same moment.
+// A job never overlaps with itself : when a run takes longer than the interval, the next run starts as
+// soon as the previous one returns, unless the job asks to be delayed.
+type Scheduler struct {
+	logger *slog.Logger
+
+	mu        sync.Mutex
+	entries   map[string]*entry
+	resources map[string]*resource
+}
+
+type entry struct {
+	interval time.Duration
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+func NewScheduler(logger *slog.Logger) *Scheduler {
+	return &Scheduler{
+		logger:    logger.With("component", "scheduler"),
+		entries:   map[string]*entry{},
+		resources: map[string]*resource{},
+	}
+}
+
+// Offset returns the deterministic jitter of a key within the interval
+func Offset(key string, interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// firstRun returns the first slot aligned to interval + offset that is not in the past
+func firstRun(now time.Time, key string, interval time.Duration) time.Time {
+	next := now.Truncate(interval).Add(Offset(key, interval))
+	if next.Before(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+// Schedule starts running the job every interval until the key is unscheduled or ctx is done
+func (s *Scheduler) Schedule(ctx context.Context, key string, interval time.Duration, job Job) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval %s for %s", interval, key)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; ok {
+		return fmt.Errorf("%s is already scheduled", key)
+	}
+	ctxca, ca := context.WithCancel(ctx)
+	e := &entry{
+		interval: interval,
+		cancel:   ca,
+		done:     make(chan struct{}),
+	}
+	s.entries[key] = e
+	go s.run(ctxca, key, e, job)
+	return nil
+}
+
+func (s *Scheduler) run(ctx context.Context, key string, e *entry, job Job) {
+	defer close(e.done)
+	logger := s.logger.With("key", key, "interval", e.interval)
+	next := firstRun(time.Now(), key, e.interval)
+	logger.With("first-run", next).Debug("scheduled job")
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		delay := job(ctx)
+		next = next.Add(e.interval)
+		now := time.Now()
+		if next.Before(now) {
+			logger.Debug("job overran its interval, running again immediately")
+			next = now
+		}
+		if backoff := now.Add(delay); backoff.After(next) {
+			logger.With("delay", delay).Debug("job backing off")
+			next = backoff
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// Unschedule stops the job and waits for its current run to return
+func (s *Scheduler) Unschedule(key string) {
+	s.mu.Lock()
+	e, ok := s.entries[key]
+	delete(s.entries, key)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	e.cancel()
+	<-e.done
+}
+
+// Stop unschedules every job
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.entries))
+	for key := range s.entries {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+	for _, key := range keys {
+		s.Unschedule(key)
+	}
+}
+
+// Len returns the number of scheduled jobs
+func (s *Scheduler) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
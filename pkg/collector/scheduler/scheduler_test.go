@@ -0,0 +1,120 @@
+package scheduler_test
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOffset(t *testing.T) {
+	interval := time.Minute
+	a := scheduler.Offset("http://10.0.0.1:6060|profile", interval)
+	b := scheduler.Offset("http://10.0.0.2:6060|profile", interval)
+	assert.Equal(t, a, scheduler.Offset("http://10.0.0.1:6060|profile", interval))
+	assert.NotEqual(t, a, b)
+	for _, offset := range []time.Duration{a, b} {
+		assert.GreaterOrEqual(t, offset, time.Duration(0))
+		assert.Less(t, offset, interval)
+	}
+	assert.Equal(t, time.Duration(0), scheduler.Offset("any", 0))
+}
+
+func TestSchedule(t *testing.T) {
+	s := scheduler.NewScheduler(slog.Default())
+	ctx, ca := context.WithCancel(context.Background())
+	defer ca()
+
+	var runs, running atomic.Int32
+	var overlapped atomic.Bool
+	job := func(ctx context.Context) time.Duration {
+		if running.Add(1) > 1 {
+			overlapped.Store(true)
+		}
+		defer running.Add(-1)
+		runs.Add(1)
+		// overrun the interval
+		select {
+		case <-time.After(30 * time.Millisecond):
+		case <-ctx.Done():
+		}
+		return 0
+	}
+	assert.NoError(t, s.Schedule(ctx, "a", 10*time.Millisecond, job))
+	assert.Error(t, s.Schedule(ctx, "a", 10*time.Millisecond, job))
+	assert.Error(t, s.Schedule(ctx, "b", 0, job))
+	assert.Equal(t, 1, s.Len())
+
+	assert.Eventually(t, func() bool {
+		return runs.Load() >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+	s.Unschedule("a")
+	assert.Equal(t, int32(0), running.Load())
+	assert.False(t, overlapped.Load())
+	assert.Equal(t, 0, s.Len())
+
+	// unscheduled keys can be scheduled again
+	assert.NoError(t, s.Schedule(ctx, "a", time.Hour, job))
+	s.Stop()
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	s := scheduler.NewScheduler(slog.Default())
+	defer s.Stop()
+
+	var runs atomic.Int32
+	var last atomic.Int64
+	var minGap atomic.Int64
+	minGap.Store(int64(time.Hour))
+	job := func(ctx context.Context) time.Duration {
+		now := time.Now().UnixNano()
+		if prev := last.Swap(now); prev != 0 && now-prev < minGap.Load() {
+			minGap.Store(now - prev)
+		}
+		runs.Add(1)
+		return 50 * time.Millisecond
+	}
+	assert.NoError(t, s.Schedule(context.Background(), "a", time.Millisecond, job))
+	assert.Eventually(t, func() bool {
+		return runs.Load() >= 3
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.GreaterOrEqual(t, time.Duration(minGap.Load()), 50*time.Millisecond)
+}
+
+func TestAcquire(t *testing.T) {
+	s := scheduler.NewScheduler(slog.Default())
+	ctx := context.Background()
+
+	release, err := s.Acquire(ctx, "http://10.0.0.1:6060/debug/pprof/profile")
+	assert.NoError(t, err)
+
+	// other resources are independent
+	releaseOther, err := s.Acquire(ctx, "http://10.0.0.2:6060/debug/pprof/profile")
+	assert.NoError(t, err)
+	releaseOther()
+
+	timeoutCtx, ca := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer ca()
+	_, err = s.Acquire(timeoutCtx, "http://10.0.0.1:6060/debug/pprof/profile")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := s.Acquire(ctx, "http://10.0.0.1:6060/debug/pprof/profile")
+		assert.NoError(t, err)
+		close(acquired)
+		release()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("resource acquired while held")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release()
+	<-acquired
+}
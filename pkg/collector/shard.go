@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+)
+
+// Shard selects the targets scraped by one of several collector replicas, by the hashmod of their `__address__`
+// host and port once relabeled, like Prometheus' hashmod. Monitors sharing an address always land on the same
+// shard, whatever their scheme and path, so that monitors of the same endpoint keep sharing a scraper
+type Shard struct {
+	Index int
+	// Count of shards, a collector with 0 or 1 shards scrapes every target
+	Count int
+}
+
+func (s Shard) Validate() error {
+	if s.Count < 0 {
+		return fmt.Errorf("invalid shard count %d", s.Count)
+	}
+	if s.Count > 1 && (s.Index < 0 || s.Index >= s.Count) {
+		return fmt.Errorf("shard index %d is out of range for %d shards", s.Index, s.Count)
+	}
+	return nil
+}
+
+// Owns returns true when the monitor is scraped by this shard, once relabeled
+func (s Shard) Owns(cfg *config.MonitorConfig) bool {
+	if s.Count <= 1 {
+		return true
+	}
+	return relabel.HashMod(shardAddress(cfg.Endpoint), uint64(s.Count)) == uint64(s.Index)
+}
+
+// ShardIndexFromHostname returns the ordinal of a StatefulSet pod, the suffix of its `<statefulset>-<ordinal>`
+// hostname
+func ShardIndexFromHostname(hostname string) (int, error) {
+	i := strings.LastIndex(hostname, "-")
+	if i < 0 {
+		return 0, fmt.Errorf("hostname %q has no ordinal suffix", hostname)
+	}
+	index, err := strconv.ParseUint(hostname[i+1:], 10, 31)
+	if err != nil {
+		return 0, fmt.Errorf("hostname %q has no ordinal suffix", hostname)
+	}
+	return int(index), nil
+}
+
+// shardAddress returns the host and port of an endpoint
+func shardAddress(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(endpoint, "/")
+	}
+	return u.Host
+}
+
+// SetShard restricts the collector to the targets of its shard, it must be called before Start
+func (c *Collector) SetShard(shard Shard) {
+	c.shard = shard
+}
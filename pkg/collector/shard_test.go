@@ -0,0 +1,93 @@
+package collector_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShards(t *testing.T) {
+	slog.SetLogLoggerLevel(NoLogsLevel)
+	monitors := func() []*config.MonitorConfig {
+		ret := []*config.MonitorConfig{}
+		for i := range 20 {
+			endpoint := fmt.Sprintf("http://10.0.0.%d:6060", i)
+			// monitors sharing an endpoint stay on the same shard
+			for _, name := range []string{"a", "b"} {
+				ret = append(ret, &config.MonitorConfig{
+					Name:     fmt.Sprintf("%s-%d", name, i),
+					Endpoint: endpoint,
+					GlobalSampling: config.GlobalSamplingConfig{
+						Heap: &config.SamplerConfig{IntervalSeconds: 3600},
+					},
+				})
+			}
+		}
+		return ret
+	}
+
+	owner := map[string]int{}
+	for index := range 3 {
+		shard := collector.Shard{Index: index, Count: 3}
+		require.NoError(t, shard.Validate())
+		c := collector.NewCollector(context.Background(), slog.Default(), &config.CollectorConfig{
+			Monitors: monitors(),
+		}, storage.NewNoopStore(), storage.NewNoopArtifactStore())
+		c.SetShard(shard)
+		require.NoError(t, c.Start(context.Background()))
+		targets := c.Targets()
+		assert.NotEmpty(t, targets)
+		// both monitors of each endpoint
+		assert.Zero(t, len(targets)%2)
+		for _, target := range targets {
+			if prev, ok := owner[target.Endpoint]; ok {
+				assert.Equal(t, index, prev, "%s is scraped by several shards", target.Endpoint)
+			}
+			owner[target.Endpoint] = index
+		}
+		require.NoError(t, c.Shutdown())
+	}
+	assert.Len(t, owner, 20)
+
+	assert.Error(t, collector.Shard{Index: 3, Count: 3}.Validate())
+	assert.Error(t, collector.Shard{Count: -1}.Validate())
+	assert.NoError(t, collector.Shard{}.Validate())
+}
+
+func TestShardAddress(t *testing.T) {
+	for _, count := range []int{2, 3, 5} {
+		owner := func(endpoint string) int {
+			for index := range count {
+				if (collector.Shard{Index: index, Count: count}).Owns(&config.MonitorConfig{Endpoint: endpoint}) {
+					return index
+				}
+			}
+			return -1
+		}
+		// the shard only depends on the host and port
+		shard := owner("10.0.0.1:6060")
+		require.NotEqual(t, -1, shard)
+		assert.Equal(t, int(relabel.HashMod("10.0.0.1:6060", uint64(count))), shard)
+		assert.Equal(t, shard, owner("http://10.0.0.1:6060"))
+		assert.Equal(t, shard, owner("https://10.0.0.1:6060/app/debug/pprof"))
+	}
+}
+
+func TestShardIndexFromHostname(t *testing.T) {
+	index, err := collector.ShardIndexFromHostname("profiling-collector-12")
+	require.NoError(t, err)
+	assert.Equal(t, 12, index)
+
+	for _, hostname := range []string{"collector", "collector-", "collector-a"} {
+		_, err := collector.ShardIndexFromHostname(hostname)
+		assert.Error(t, err, hostname)
+	}
+}
@@ -2,14 +2,21 @@ package collector
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"reflect"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/rancher-sandbox/profiling/pkg/collector/burst"
+	"github.com/rancher-sandbox/profiling/pkg/collector/discovery"
 	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
 	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/collector/scheduler"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 	"github.com/rancher-sandbox/profiling/pkg/config"
 	"golang.org/x/sync/errgroup"
@@ -22,17 +29,46 @@ type Collector struct {
 	Config      *config.CollectorConfig
 	Monitors    []*monitor.Monitor
 	Store       storage.Store
+	Artifacts   storage.ArtifactStore
+	Scheduler   *scheduler.Scheduler
+
+	// context monitors run in, set by Start
+	runCtx context.Context
+	// self telemetry monitor, also in Monitors
+	selfMonitor *monitor.Monitor
+	// external monitors, by target key
+	targets map[string]*monitor.Monitor
+
+	discovery      *discovery.Manager
+	stopDiscoveryF context.CancelFunc
+	// monitors of the discovered targets, run alongside Config.Monitors
+	discovered []*config.MonitorConfig
+	// observes the signals of every monitor for the burst rules
+	bursts *burst.Engine
+	// targets of other shards are dropped after relabeling
+	shard Shard
 
 	lifecycleMu sync.Mutex
 }
 
-func NewCollector(ctx context.Context, logger *slog.Logger, cfg *config.CollectorConfig, store storage.Store) *Collector {
+func NewCollector(
+	ctx context.Context,
+	logger *slog.Logger,
+	cfg *config.CollectorConfig,
+	store storage.Store,
+	artifacts storage.ArtifactStore,
+) *Collector {
 	return &Collector{
 		ctx:         ctx,
 		logger:      logger,
 		Config:      cfg,
 		Monitors:    nil,
 		Store:       store,
+		Artifacts:   artifacts,
+		Scheduler:   scheduler.NewScheduler(logger),
+		runCtx:      ctx,
+		targets:     map[string]*monitor.Monitor{},
+		bursts:      burst.NewEngine(logger),
 		lifecycleMu: sync.Mutex{},
 	}
 }
@@ -40,102 +76,176 @@ func NewCollector(ctx context.Context, logger *slog.Logger, cfg *config.Collecto
 func (c *Collector) Start(ctx context.Context) error {
 	c.lifecycleMu.Lock()
 	defer c.lifecycleMu.Unlock()
-	mons := []*monitor.Monitor{}
+	c.runCtx = ctx
+	c.bursts.Start(ctx)
+	c.bursts.SetRules(c.Config.BurstRules)
 
 	if c.Config.SelfTelemetry != nil {
-		addr := fmt.Sprintf("127.0.0.1:%d", c.Config.SelfTelemetry.PprofPort)
-		c.logger.With("addr", addr).Info("configuring internal pprof server")
-		server := &http.Server{
-			Addr:    addr,
-			Handler: nil,
+		c.startSelfTelemetry(ctx, c.Config.SelfTelemetry)
+	}
+
+	c.logger.With("len", len(c.Config.Monitors)).Info("starting external monitors...")
+	c.applyMonitors(ctx, c.relabelMonitors(c.monitorConfigs(c.Config)))
+	c.startDiscovery(ctx, c.Config.Discovery)
+	return nil
+}
+
+// monitorConfigs returns the configured monitors followed by the discovered ones
+func (c *Collector) monitorConfigs(cfg *config.CollectorConfig) []*config.MonitorConfig {
+	return append(slices.Clone(cfg.Monitors), c.discovered...)
+}
+
+// startDiscovery applies the discovered monitors whenever they change. The discovery goroutines never
+// take lifecycleMu, so that stopDiscovery can wait for them while holding it
+func (c *Collector) startDiscovery(ctx context.Context, cfgs []*config.DiscoveryConfig) {
+	if len(cfgs) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	mgr := discovery.NewManager(c.logger, cfgs)
+	mgr.Start(ctx)
+	c.discovery = mgr
+	c.stopDiscoveryF = cancel
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-mgr.Updates():
+			}
+			c.lifecycleMu.Lock()
+			// discovery may have been stopped while waiting for the lock
+			if ctx.Err() == nil {
+				c.discovered = mgr.Monitors()
+				started, stopped := c.applyMonitors(c.runCtx, c.relabelMonitors(c.monitorConfigs(c.Config)))
+				c.logger.With(
+					"discovered", len(c.discovered),
+					"started-scrapers", started,
+					"stopped-scrapers", stopped,
+				).Info("applied discovered targets")
+			}
+			c.lifecycleMu.Unlock()
+		}
+	}()
+}
+
+func (c *Collector) stopDiscovery() {
+	if c.discovery == nil {
+		return
+	}
+	c.stopDiscoveryF()
+	c.discovery.Wait()
+	c.discovery = nil
+	c.stopDiscoveryF = nil
+}
+
+// relabelMonitors returns the monitors of the collector's shard to run, once their relabelings are applied
+func (c *Collector) relabelMonitors(cfgs []*config.MonitorConfig) []*config.MonitorConfig {
+	ret := make([]*config.MonitorConfig, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		relabeled, keep, err := relabel.Monitor(cfg)
+		if err != nil {
+			c.logger.With("name", cfg.Name, "err", err).Error("skipping monitor with invalid relabeling")
+			continue
+		}
+		if !keep {
+			c.logger.With("name", cfg.Name).Debug("monitor dropped by relabeling")
+			continue
+		}
+		if !c.shard.Owns(relabeled) {
+			c.logger.With("name", cfg.Name, "shard", c.shard.Index).Debug("monitor belongs to another shard")
+			continue
 		}
+		ret = append(ret, relabeled)
+	}
+	return ret
+}
+
+func (c *Collector) startSelfTelemetry(ctx context.Context, cfg *config.SelfTelemetryConfig) {
+	addr := fmt.Sprintf("127.0.0.1:%d", cfg.PprofPort)
+	c.logger.With("addr", addr).Info("configuring internal pprof server")
+	server := &http.Server{
+		Addr:    addr,
+		Handler: nil,
+	}
 
-		if c.pprofServer != nil {
-			panic("pprof server should be nil here")
+	if c.pprofServer != nil {
+		panic("pprof server should be nil here")
+	}
+	go func() {
+		c.logger.With("addr", addr).Info("launching pprof server")
+		if err := server.ListenAndServe(); err != nil {
+			c.logger.Error(err.Error())
 		}
-		go func() {
-			c.logger.With("addr", addr).Info("launching pprof server")
-			if err := server.ListenAndServe(); err != nil {
-				c.logger.Error(err.Error())
-			}
-		}()
-		c.pprofServer = server
-		mon := monitor.NewMonitor(c.logger, &config.MonitorConfig{
-			Name:     "__self",
-			Endpoint: fmt.Sprintf("http://%s", addr),
-			Labels: map[string]string{
-				// FIXME: temporary hack
-				labels.NamespaceLabel: "self",
-				labels.NameLabel:      "self",
+	}()
+	c.pprofServer = server
+	mon := monitor.NewMonitor(c.logger, &config.MonitorConfig{
+		Name:     "__self",
+		Endpoint: fmt.Sprintf("http://%s", addr),
+		Labels: map[string]string{
+			// FIXME: temporary hack
+			labels.NamespaceLabel: "self",
+			labels.NameLabel:      "self",
+		},
+		GlobalSampling: config.GlobalSamplingConfig{
+			Profile: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
+			},
+			Heap: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
+			},
+			Goroutine: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
+			},
+			Allocs: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
+			},
+			Block: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
 			},
-			GlobalSampling: config.GlobalSamplingConfig{
-				Profile: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				Heap: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				Goroutine: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				Allocs: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				Block: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				Mutex: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
-				ThreadCreate: &config.SamplerConfig{
-					Seconds: c.Config.SelfTelemetry.IntervalSeconds,
-				},
+			Mutex: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
+			},
+			ThreadCreate: &config.SamplerConfig{
+				Seconds: cfg.IntervalSeconds,
 			},
 		},
-			c.Store,
-		)
-
-		// FIXME: hack
-		maxRetries := 50
-		for range maxRetries {
-			req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/debug/pprof", addr), nil)
-			if err != nil {
-				panic(err)
-			}
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				c.logger.Info("waiting for internal pprof endpoint to be available, retrying...")
-				time.Sleep(50 * time.Millisecond)
-				continue
-			}
-			c.logger.Info("connected to internal pprof server")
-			resp.Body.Close()
-			break
+	},
+		c.Store,
+		c.Artifacts,
+		c.Scheduler,
+	)
+	mon.SetObserver(c.bursts)
+
+	// FIXME: hack
+	maxRetries := 50
+	for range maxRetries {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/debug/pprof", addr), nil)
+		if err != nil {
+			panic(err)
 		}
-		mons = append(mons, mon)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			c.logger.Info("waiting for internal pprof endpoint to be available, retrying...")
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+		c.logger.Info("connected to internal pprof server")
+		resp.Body.Close()
+		break
 	}
-
-	c.logger.With("len", len(c.Config.Monitors)).Info("starting external monitors...")
-	for _, cfg := range c.Config.Monitors {
-		mons = append(mons, monitor.NewMonitor(c.logger, cfg, c.Store))
+	if err := mon.Start(ctx); err != nil {
+		c.logger.With("err", err).Error("failed to start self telemetry monitor")
 	}
-	c.Monitors = mons
-	for _, mon := range c.Monitors {
-		mon := mon
-		mon.Start(ctx)
-	}
-	return nil
+	c.selfMonitor = mon
+	c.Monitors = append([]*monitor.Monitor{mon}, c.Monitors...)
 }
 
-func (c *Collector) Shutdown() error {
-	c.lifecycleMu.Lock()
-	defer c.lifecycleMu.Unlock()
+func (c *Collector) stopSelfTelemetry() error {
 	var eg errgroup.Group
-	for _, mon := range c.Monitors {
-		mon := mon
-		eg.Go(mon.Shutdown)
+	if c.selfMonitor != nil {
+		eg.Go(c.selfMonitor.Shutdown)
 	}
-
 	if c.pprofServer != nil {
 		eg.Go(func() error {
 			c.logger.Info("shutting down internal pprof server...")
@@ -148,20 +258,226 @@ func (c *Collector) Shutdown() error {
 		})
 	}
 	if err := eg.Wait(); err != nil {
-		c.logger.With("err", err).Error("shutting down monitors")
 		return err
 	}
+	if c.selfMonitor != nil {
+		c.Monitors = c.externalMonitors()
+		c.selfMonitor = nil
+	}
 	return nil
 }
 
-func (c *Collector) Reload(cfg *config.CollectorConfig) error {
-	if err := c.Shutdown(); err != nil {
-		return err
+func (c *Collector) externalMonitors() []*monitor.Monitor {
+	ret := []*monitor.Monitor{}
+	for _, mon := range c.Monitors {
+		if mon != c.selfMonitor {
+			ret = append(ret, mon)
+		}
 	}
-	c.Config = cfg
-	if err := c.Start(context.TODO()); err != nil {
-		return err
+	return ret
+}
+
+// applyMonitors converges the running external monitors to cfgs : targets whose scrape settings didn't
+// change keep running, only storing their profiles for the new set of monitors
+func (c *Collector) applyMonitors(ctx context.Context, cfgs []*config.MonitorConfig) (started, stopped int) {
+	next := map[string]*monitor.Monitor{}
+	mons := []*monitor.Monitor{}
+	if c.selfMonitor != nil {
+		mons = append(mons, c.selfMonitor)
 	}
+	for _, group := range groupByTarget(cfgs) {
+		key := targetKey(group[0])
+		mon, ok := c.targets[key]
+		if ok {
+			mon.SetSinks(group)
+		} else {
+			mon = monitor.NewMonitor(c.logger, group[0], c.Store, c.Artifacts, c.Scheduler)
+			mon.SetObserver(c.bursts)
+			for _, cfg := range group[1:] {
+				c.logger.With("name", cfg.Name, "target", group[0].Name).Info("sharing target with another monitor")
+				mon.AddSink(cfg)
+			}
+			if err := mon.Start(ctx); err != nil {
+				c.logger.With("err", err).Error("failed to start monitor")
+			}
+			started++
+		}
+		next[key] = mon
+		mons = append(mons, mon)
+	}
+	var eg errgroup.Group
+	for key, mon := range c.targets {
+		if _, ok := next[key]; !ok {
+			eg.Go(mon.Shutdown)
+			stopped++
+		}
+	}
+	if err := eg.Wait(); err != nil {
+		c.logger.With("err", err).Error("shutting down removed monitors")
+	}
+	c.targets = next
+	c.Monitors = mons
+	c.bursts.SetTargets(mons)
+	return started, stopped
+}
 
+// Targets returns the status of every running monitor
+func (c *Collector) Targets() []monitor.TargetStatus {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	ret := make([]monitor.TargetStatus, 0, len(c.Monitors))
+	for _, mon := range c.Monitors {
+		ret = append(ret, mon.Status()...)
+	}
+	return ret
+}
+
+var ErrTargetNotFound = errors.New("target not found")
+
+func (c *Collector) monitorFor(name string) (*monitor.Monitor, error) {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	for _, mon := range c.Monitors {
+		if mon.HasSink(name) {
+			return mon, nil
+		}
+	}
+	return nil, ErrTargetNotFound
+}
+
+// CaptureTrace collects an execution trace from the monitor with the given name
+func (c *Collector) CaptureTrace(ctx context.Context, name string, seconds int) (storage.Artifact, error) {
+	target, err := c.monitorFor(name)
+	if err != nil {
+		return storage.Artifact{}, err
+	}
+	return target.CaptureTrace(ctx, name, seconds)
+}
+
+// CaptureGoroutines collects a goroutine dump from the monitor with the given name
+func (c *Collector) CaptureGoroutines(ctx context.Context, name string) (storage.Artifact, error) {
+	target, err := c.monitorFor(name)
+	if err != nil {
+		return storage.Artifact{}, err
+	}
+	return target.CaptureGoroutines(ctx, name)
+}
+
+func (c *Collector) Shutdown() error {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	c.stopDiscovery()
+	c.discovered = nil
+	c.bursts.Stop()
+	var eg errgroup.Group
+	for _, mon := range c.externalMonitors() {
+		mon := mon
+		eg.Go(mon.Shutdown)
+	}
+	eg.Go(c.stopSelfTelemetry)
+	if err := eg.Wait(); err != nil {
+		c.logger.With("err", err).Error("shutting down monitors")
+		return err
+	}
+	c.Monitors = nil
+	c.targets = map[string]*monitor.Monitor{}
 	return nil
 }
+
+// ReloadReport describes what a reload changed
+type ReloadReport struct {
+	// Added, Removed and Changed are monitor names
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Changed   []string `json:"changed"`
+	Unchanged int      `json:"unchanged"`
+	// StartedScrapers and StoppedScrapers count the targets that were started or stopped,
+	// monitors that only changed labels keep scraping
+	StartedScrapers int `json:"started_scrapers"`
+	StoppedScrapers int `json:"stopped_scrapers"`
+	// SelfTelemetry is one of unchanged, started, stopped or restarted
+	SelfTelemetry string `json:"self_telemetry"`
+}
+
+func diffMonitors(prev, next []*config.MonitorConfig) *ReloadReport {
+	report := &ReloadReport{
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []string{},
+	}
+	prevByName := make(map[string]*config.MonitorConfig, len(prev))
+	for _, cfg := range prev {
+		prevByName[cfg.Name] = cfg
+	}
+	nextByName := make(map[string]struct{}, len(next))
+	for _, cfg := range next {
+		nextByName[cfg.Name] = struct{}{}
+		old, ok := prevByName[cfg.Name]
+		switch {
+		case !ok:
+			report.Added = append(report.Added, cfg.Name)
+		case !reflect.DeepEqual(old, cfg):
+			report.Changed = append(report.Changed, cfg.Name)
+		default:
+			report.Unchanged++
+		}
+	}
+	for _, cfg := range prev {
+		if _, ok := nextByName[cfg.Name]; !ok {
+			report.Removed = append(report.Removed, cfg.Name)
+		}
+	}
+	return report
+}
+
+// Reload applies cfg, only starting and stopping what changed
+func (c *Collector) Reload(cfg *config.CollectorConfig) (*ReloadReport, error) {
+	c.lifecycleMu.Lock()
+	defer c.lifecycleMu.Unlock()
+	report := diffMonitors(c.Config.Monitors, cfg.Monitors)
+
+	report.SelfTelemetry = "unchanged"
+	if !reflect.DeepEqual(c.Config.SelfTelemetry, cfg.SelfTelemetry) || (cfg.SelfTelemetry != nil && c.pprofServer == nil) {
+		wasRunning := c.pprofServer != nil
+		if err := c.stopSelfTelemetry(); err != nil {
+			return nil, err
+		}
+		switch {
+		case cfg.SelfTelemetry != nil && wasRunning:
+			report.SelfTelemetry = "restarted"
+		case cfg.SelfTelemetry != nil:
+			report.SelfTelemetry = "started"
+		case wasRunning:
+			report.SelfTelemetry = "stopped"
+		}
+		if cfg.SelfTelemetry != nil {
+			c.startSelfTelemetry(c.runCtx, cfg.SelfTelemetry)
+		}
+	}
+
+	// discovered targets keep running until the restarted discovery replaces them
+	if !reflect.DeepEqual(c.Config.Discovery, cfg.Discovery) {
+		c.stopDiscovery()
+		if len(cfg.Discovery) == 0 {
+			c.discovered = nil
+		}
+		c.startDiscovery(c.runCtx, cfg.Discovery)
+	}
+
+	if !reflect.DeepEqual(c.Config.BurstRules, cfg.BurstRules) {
+		c.bursts.SetRules(cfg.BurstRules)
+	}
+
+	report.StartedScrapers, report.StoppedScrapers = c.applyMonitors(c.runCtx, c.relabelMonitors(c.monitorConfigs(cfg)))
+	c.Config = cfg
+	c.logger.With(
+		"added", len(report.Added),
+		"removed", len(report.Removed),
+		"changed", len(report.Changed),
+		"unchanged", report.Unchanged,
+		"started-scrapers", report.StartedScrapers,
+		"stopped-scrapers", report.StoppedScrapers,
+		"self-telemetry", report.SelfTelemetry,
+	).Info("reloaded config")
+	return report, nil
+}
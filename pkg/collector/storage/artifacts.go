@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Artifact is data stored as is, without merging, like an execution trace
+type Artifact struct {
+	Kind string `json:"kind"`
+	// Key of the series the artifact belongs to, as returned by SeriesKey
+	Key   string    `json:"key"`
+	ID    string    `json:"id"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Size  int64     `json:"size"`
+}
+
+type ArtifactStore interface {
+	PutArtifact(startTime, endTime time.Time, kind, key string, labels map[string]string, value []byte) (Artifact, error)
+	// ListArtifacts returns the artifacts of a kind, most recent first
+	ListArtifacts(kind string) ([]Artifact, error)
+	// GetArtifact returns the path of an artifact
+	GetArtifact(kind, key, id string) (string, error)
+}
+
+var ErrArtifactNotFound = errors.New("artifact not found")
+
+// Retention bounds the artifacts of a kind kept for each series
+type Retention struct {
+	MaxAge   time.Duration
+	MaxCount int
+}
+
+// FileArtifactStore stores one file per artifact under `<dataDir>/<kind>/<series key>/<start>_<end>`.
+// It must not share its data dir with a LabelBasedFileStore.
+type FileArtifactStore struct {
+	DataDir string
+	IndexBy []string
+
+	mu        sync.Mutex
+	retention map[string]Retention
+}
+
+var _ ArtifactStore = (*FileArtifactStore)(nil)
+
+func NewFileArtifactStore(dataDir string, indexBy []string, retention map[string]Retention) *FileArtifactStore {
+	if retention == nil {
+		retention = map[string]Retention{}
+	}
+	return &FileArtifactStore{
+		DataDir:   dataDir,
+		IndexBy:   indexBy,
+		retention: retention,
+	}
+}
+
+func (s *FileArtifactStore) SetRetention(kind string, retention Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retention[kind] = retention
+}
+
+func (s *FileArtifactStore) getRetention(kind string) Retention {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retention[kind]
+}
+
+var artifactIDRegex = regexp.MustCompile(`^\d+_\d+$`)
+
+func parseArtifactID(id string) (time.Time, time.Time, error) {
+	if !artifactIDRegex.MatchString(id) {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid artifact id %q", id)
+	}
+	parts := strings.Split(id, "_")
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return time.Unix(0, start), time.Unix(0, end), nil
+}
+
+func (s *FileArtifactStore) PutArtifact(startTime, endTime time.Time, kind, key string, labels map[string]string, value []byte) (Artifact, error) {
+	if err := validPathComponent("kind", kind); err != nil {
+		return Artifact{}, err
+	}
+	// artifact keys can span several directories, e.g. captures per monitor and profile type
+	seriesKey, err := seriesKey(s.IndexBy, labels, strings.Split(key, "/"))
+	if err != nil {
+		return Artifact{}, err
+	}
+	basePath := path.Join(s.DataDir, kind, seriesKey)
+	if err := os.MkdirAll(basePath, 0755); err != nil {
+		return Artifact{}, err
+	}
+	id := fmt.Sprintf("%d_%d", startTime.UnixNano(), endTime.UnixNano())
+	// artifacts are large, don't expose partially written files
+	tmp, err := os.CreateTemp(basePath, ".tmp-")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return Artifact{}, err
+	}
+	if err := tmp.Close(); err != nil {
+		return Artifact{}, err
+	}
+	if err := os.Rename(tmp.Name(), path.Join(basePath, id)); err != nil {
+		return Artifact{}, err
+	}
+	if err := s.prune(basePath, s.getRetention(kind), time.Now()); err != nil {
+		return Artifact{}, err
+	}
+	return Artifact{
+		Kind:  kind,
+		Key:   seriesKey,
+		ID:    id,
+		Start: time.Unix(0, startTime.UnixNano()),
+		End:   time.Unix(0, endTime.UnixNano()),
+		Size:  int64(len(value)),
+	}, nil
+}
+
+// prune deletes the artifacts of a series that are expired or in excess, oldest first
+func (s *FileArtifactStore) prune(basePath string, retention Retention, now time.Time) error {
+	entries, err := os.ReadDir(basePath)
+	if err != nil {
+		return err
+	}
+	ids := []string{}
+	for _, e := range entries {
+		if !e.IsDir() && artifactIDRegex.MatchString(e.Name()) {
+			ids = append(ids, e.Name())
+		}
+	}
+	slices.SortFunc(ids, func(a, b string) int {
+		_, endA, _ := parseArtifactID(a)
+		_, endB, _ := parseArtifactID(b)
+		return endB.Compare(endA)
+	})
+	for i, id := range ids {
+		_, end, _ := parseArtifactID(id)
+		expired := retention.MaxAge > 0 && now.Sub(end) > retention.MaxAge
+		excess := retention.MaxCount > 0 && i >= retention.MaxCount
+		if expired || excess {
+			if err := os.Remove(path.Join(basePath, id)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *FileArtifactStore) ListArtifacts(kind string) ([]Artifact, error) {
+	basePath := path.Join(s.DataDir, kind)
+	retention := s.getRetention(kind)
+	now := time.Now()
+	ret := []Artifact{}
+	err := filepath.WalkDir(basePath, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		start, end, err := parseArtifactID(d.Name())
+		if err != nil {
+			// temporary file
+			return nil
+		}
+		if retention.MaxAge > 0 && now.Sub(end) > retention.MaxAge {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(basePath, filepath.Dir(p))
+		if err != nil {
+			return err
+		}
+		ret = append(ret, Artifact{
+			Kind:  kind,
+			Key:   filepath.ToSlash(key),
+			ID:    d.Name(),
+			Start: start,
+			End:   end,
+			Size:  info.Size(),
+		})
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return ret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(ret, func(a, b Artifact) int {
+		return b.End.Compare(a.End)
+	})
+	return ret, nil
+}
+
+func (s *FileArtifactStore) GetArtifact(kind, key, id string) (string, error) {
+	if _, _, err := parseArtifactID(id); err != nil {
+		return "", err
+	}
+	key = strings.Trim(key, "/")
+	for _, part := range append(strings.Split(key, "/"), kind) {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("invalid artifact key %q", key)
+		}
+	}
+	target := path.Join(s.DataDir, kind, key, id)
+	if _, err := os.Stat(target); err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrArtifactNotFound
+		}
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArtifactStore(t *testing.T) {
+	dir := t.TempDir()
+	store := storage.NewFileArtifactStore(dir, []string{labels.NamespaceLabel, labels.NameLabel}, map[string]storage.Retention{
+		"trace": {MaxAge: time.Hour, MaxCount: 2},
+	})
+	lbls := map[string]string{
+		labels.NamespaceLabel: "default",
+		labels.NameLabel:      "example1",
+	}
+	now := time.Now()
+	for i := range 3 {
+		start := now.Add(time.Duration(i) * time.Second)
+		a, err := store.PutArtifact(start, start.Add(time.Second), "trace", "pod-example1", lbls, []byte{byte(i)})
+		require.NoError(t, err)
+		assert.Equal(t, "default/example1/pod-example1", a.Key)
+		assert.Equal(t, int64(1), a.Size)
+	}
+	// expired artifacts are pruned on the next write
+	_, err := store.PutArtifact(now.Add(-3*time.Hour), now.Add(-2*time.Hour), "trace", "pod-example2", lbls, []byte("old"))
+	require.NoError(t, err)
+
+	artifacts, err := store.ListArtifacts("trace")
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+	assert.True(t, artifacts[0].End.After(artifacts[1].End))
+
+	p, err := store.GetArtifact("trace", artifacts[0].Key, artifacts[0].ID)
+	require.NoError(t, err)
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{2}, data)
+
+	_, err = store.GetArtifact("trace", "default/example1/pod-example2", artifacts[0].ID)
+	assert.ErrorIs(t, err, storage.ErrArtifactNotFound)
+	_, err = store.GetArtifact("trace", "../../etc", artifacts[0].ID)
+	assert.Error(t, err)
+	_, err = store.GetArtifact("trace", artifacts[0].Key, "passwd")
+	assert.Error(t, err)
+
+	empty, err := store.ListArtifacts("goroutine")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
@@ -25,3 +25,27 @@ func (n *NoopStore) GroupKeys() (map[string]map[string]map[string][]string, erro
 func (n *NoopStore) Get(profileType, key string) (filepaths []string, err error) {
 	return []string{}, nil
 }
+
+func (n *NoopStore) Series() ([]Series, error) {
+	return []Series{}, nil
+}
+
+type NoopArtifactStore struct{}
+
+var _ ArtifactStore = (*NoopArtifactStore)(nil)
+
+func NewNoopArtifactStore() *NoopArtifactStore {
+	return &NoopArtifactStore{}
+}
+
+func (n *NoopArtifactStore) PutArtifact(startTime, endTime time.Time, kind, key string, labels map[string]string, value []byte) (Artifact, error) {
+	return Artifact{Kind: kind, Start: startTime, End: endTime, Size: int64(len(value))}, nil
+}
+
+func (n *NoopArtifactStore) ListArtifacts(kind string) ([]Artifact, error) {
+	return []Artifact{}, nil
+}
+
+func (n *NoopArtifactStore) GetArtifact(kind, key, id string) (string, error) {
+	return "", ErrArtifactNotFound
+}
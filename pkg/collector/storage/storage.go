@@ -3,6 +3,9 @@ package storage
 // FIXME: this entire implementation is a mess, done for speed / demonstration purposes
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -11,6 +14,9 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
 )
 
 type Merger interface {
@@ -22,6 +28,42 @@ type Store interface {
 	ListKeys() ([]string, error)
 	GroupKeys() (map[string]map[string]map[string][]string, error)
 	Get(profileType, key string) (filepaths []string, err error)
+	Series() ([]Series, error)
+}
+
+// Series is a stored series of profiles. Profiles are merged as they are written : every file holds the
+// data of the series from Start to the end time in its name
+type Series struct {
+	ProfileType string            `json:"profileType"`
+	Key         string            `json:"key"`
+	Labels      map[string]string `json:"labels"`
+	Start       time.Time         `json:"start"`
+	End         time.Time         `json:"end"`
+}
+
+// seriesLabelsFile holds the labels of the last profile written to a series, next to its profiles
+const seriesLabelsFile = "labels.json"
+
+// ProfileTimes parses the start and end times of a profile file, named `<start>_<end>` in unix nanoseconds
+func ProfileTimes(filepath string) (start, end time.Time, err error) {
+	startStr, endStr, ok := strings.Cut(path.Base(filepath), "_")
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid profile file name %s", path.Base(filepath))
+	}
+	startNano, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid profile file name %s", path.Base(filepath))
+	}
+	endNano, err := strconv.ParseInt(endStr, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid profile file name %s", path.Base(filepath))
+	}
+	return time.Unix(0, startNano), time.Unix(0, endNano), nil
+}
+
+func isProfileFile(filepath string) bool {
+	_, _, err := ProfileTimes(filepath)
+	return err == nil
 }
 
 type LabelBasedFileStore struct {
@@ -41,23 +83,61 @@ func NewLabelBasedFileStore(dataDir string, indexBy []string, merger Merger) *La
 
 var _ Store = (*LabelBasedFileStore)(nil)
 
+// ErrInvalidSeries is returned for series whose profile type, key or index labels can't be used as directories
+var ErrInvalidSeries = errors.New("invalid series")
+
+// validPathComponent rejects the values that would drop a directory level or escape the data directory
+func validPathComponent(name, value string) error {
+	if value == "" || value == "." || value == ".." || strings.Contains(value, "/") {
+		return fmt.Errorf("%w: %s %q must be a non-empty name without '/'", ErrInvalidSeries, name, value)
+	}
+	return nil
+}
+
+// SeriesKey returns the key of a series, relative to its profile type, as accepted by Store.Get
+func SeriesKey(indexBy []string, labels map[string]string, key string) (string, error) {
+	return seriesKey(indexBy, labels, []string{key})
+}
+
+// seriesKey joins the index labels and the key directories
+func seriesKey(indexBy []string, labels map[string]string, keys []string) (string, error) {
+	parts := []string{}
+	for _, idx := range indexBy {
+		if _, ok := labels[idx]; !ok {
+			return "", fmt.Errorf("%w: missing label %s to use as index", ErrInvalidSeries, idx)
+		}
+		if err := validPathComponent("label "+idx, labels[idx]); err != nil {
+			return "", err
+		}
+		parts = append(parts, labels[idx])
+	}
+	for _, key := range keys {
+		if err := validPathComponent("key", key); err != nil {
+			return "", err
+		}
+		parts = append(parts, key)
+	}
+	return path.Join(parts...), nil
+}
+
 func (s *LabelBasedFileStore) basePath(
 	labels map[string]string,
 	profileType string,
 	key string,
 ) (string, error) {
-	base := path.Join(s.DataDir, profileType)
-	for _, idx := range s.IndexBy {
-		if _, ok := labels[idx]; !ok {
-			return "", fmt.Errorf("missing label %s to use as index", idx)
-		}
-		base = path.Join(base, labels[idx])
+	if err := validPathComponent("profile type", profileType); err != nil {
+		return "", err
+	}
+	seriesKey, err := SeriesKey(s.IndexBy, labels, key)
+	if err != nil {
+		return "", err
 	}
-	base = path.Join(base, key)
-	return base, nil
+	return path.Join(s.DataDir, profileType, seriesKey), nil
 }
 
 func (s *LabelBasedFileStore) Put(startTime, endTime time.Time, profileType, key string, labels map[string]string, value []byte) error {
+	timer := prometheus.NewTimer(metrics.StorePutDuration.WithLabelValues(profileType))
+	defer timer.ObserveDuration()
 	basePath, err := s.basePath(labels, profileType, key)
 	if err != nil {
 		return err
@@ -71,12 +151,15 @@ func (s *LabelBasedFileStore) Put(startTime, endTime time.Time, profileType, key
 	if err := os.MkdirAll(basePath, 0755); err != nil {
 		return err
 	}
+	if err := putSeriesLabels(basePath, labels); err != nil {
+		return err
+	}
 	files := []string{}
 	pathErr := filepath.WalkDir(basePath, func(path string, d os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		if !d.IsDir() {
+		if !d.IsDir() && isProfileFile(path) {
 			files = append(files, path)
 		}
 		return nil
@@ -103,6 +186,7 @@ func (s *LabelBasedFileStore) Put(startTime, endTime time.Time, profileType, key
 		}
 		merged, err := s.Merger.Merge(data, value)
 		if err != nil {
+			metrics.MergeFailures.WithLabelValues(profileType).Inc()
 			return err
 		}
 		value = merged
@@ -196,7 +280,17 @@ func (s *LabelBasedFileStore) ListKeys() ([]string, error) {
 	return ret, nil
 }
 
+// Get returns the profile files of a series, oldest first. The profile type and key are validated like the
+// series written by Put, so that they can't escape the data dir
 func (s *LabelBasedFileStore) Get(profileType, key string) (filepaths []string, err error) {
+	if err := validPathComponent("profile type", profileType); err != nil {
+		return nil, err
+	}
+	for _, part := range strings.Split(key, "/") {
+		if err := validPathComponent("key", part); err != nil {
+			return nil, err
+		}
+	}
 	basePath := path.Join(s.DataDir, profileType)
 	basePath = path.Join(basePath, key)
 	ret := []string{}
@@ -204,7 +298,7 @@ func (s *LabelBasedFileStore) Get(profileType, key string) (filepaths []string,
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() {
+		if !info.IsDir() && isProfileFile(path) {
 			ret = append(ret, path)
 		}
 		return nil
@@ -215,3 +309,92 @@ func (s *LabelBasedFileStore) Get(profileType, key string) (filepaths []string,
 	slices.Sort(ret)
 	return ret, nil
 }
+
+// putSeriesLabels only rewrites the labels of a series when they change
+func putSeriesLabels(basePath string, labels map[string]string) error {
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return err
+	}
+	labelsPath := path.Join(basePath, seriesLabelsFile)
+	if current, err := os.ReadFile(labelsPath); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	return os.WriteFile(labelsPath, data, 0644)
+}
+
+// seriesLabels reads the labels of a series, series written before labels were stored only have the labels
+// they are indexed by
+func (s *LabelBasedFileStore) seriesLabels(profileType, key string) (map[string]string, error) {
+	data, err := os.ReadFile(path.Join(s.DataDir, profileType, key, seriesLabelsFile))
+	if err == nil {
+		ret := map[string]string{}
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	ret := map[string]string{}
+	parts := strings.Split(key, "/")
+	for i, idx := range s.IndexBy {
+		if i < len(parts) {
+			ret[idx] = parts[i]
+		}
+	}
+	return ret, nil
+}
+
+func (s *LabelBasedFileStore) Series() ([]Series, error) {
+	keys, err := s.ListKeys()
+	if err != nil {
+		return nil, err
+	}
+	ret := []Series{}
+	for _, key := range keys {
+		key = strings.TrimPrefix(key, string(os.PathSeparator))
+		// an empty data dir lists itself
+		if key == "" {
+			continue
+		}
+		profileType, seriesKey, ok := strings.Cut(key, string(os.PathSeparator))
+		if !ok {
+			return nil, fmt.Errorf("invalid key %s", key)
+		}
+		filepaths, err := s.Get(profileType, seriesKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(filepaths) == 0 {
+			continue
+		}
+		labels, err := s.seriesLabels(profileType, seriesKey)
+		if err != nil {
+			return nil, err
+		}
+		start, _, err := ProfileTimes(filepaths[0])
+		if err != nil {
+			return nil, err
+		}
+		_, end, err := ProfileTimes(filepaths[len(filepaths)-1])
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Series{
+			ProfileType: profileType,
+			Key:         seriesKey,
+			Labels:      labels,
+			Start:       start,
+			End:         end,
+		})
+	}
+	slices.SortFunc(ret, func(a, b Series) int {
+		if c := strings.Compare(a.ProfileType, b.ProfileType); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+	return ret, nil
+}
@@ -101,3 +101,57 @@ func TestStorage(t *testing.T) {
 	}, groupedKeys)
 
 }
+
+func TestSeries(t *testing.T) {
+	store := storage.NewLabelBasedFileStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, &byteMerger{})
+	series, err := store.Series()
+	assert.NoError(t, err)
+	assert.Empty(t, series)
+
+	lbls := map[string]string{
+		labels.NamespaceLabel: "default",
+		labels.NameLabel:      "example1",
+		"pod":                 "example1-abc",
+	}
+	start := time.Unix(100, 0)
+	assert.NoError(t, store.Put(start, start.Add(time.Minute), "heap", "pod-example1", lbls, []byte("hello")))
+	assert.NoError(t, store.Put(start.Add(time.Minute), start.Add(2*time.Minute), "heap", "pod-example1", lbls, []byte("world")))
+	assert.NoError(t, store.Put(start, start.Add(time.Minute), "goroutine", "pod-example1", lbls, []byte("hello")))
+
+	// the labels aren't listed as profiles
+	filepaths, err := store.Get("heap", "default/example1/pod-example1")
+	assert.NoError(t, err)
+	assert.Len(t, filepaths, 2)
+
+	series, err = store.Series()
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.Series{
+		{
+			ProfileType: "goroutine",
+			Key:         "default/example1/pod-example1",
+			Labels:      lbls,
+			Start:       start,
+			End:         start.Add(time.Minute),
+		},
+		{
+			ProfileType: "heap",
+			Key:         "default/example1/pod-example1",
+			Labels:      lbls,
+			Start:       start,
+			End:         start.Add(2 * time.Minute),
+		},
+	}, series)
+}
+
+func TestGetInvalidSeries(t *testing.T) {
+	store := storage.NewLabelBasedFileStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, &byteMerger{})
+	for _, tc := range []struct{ profileType, key string }{
+		{"..", "default/example1/pod-example1"},
+		{"profile", "default/../../pod-example1"},
+		{"profile", "default//pod-example1"},
+		{"profile", ""},
+	} {
+		_, err := store.Get(tc.profileType, tc.key)
+		assert.ErrorIs(t, err, storage.ErrInvalidSeries, tc)
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Usage is the disk usage of a profile type
+type Usage struct {
+	Bytes  int64
+	Series int
+}
+
+// Usage walks the data dir, returning the usage of every profile type
+func (s *LabelBasedFileStore) Usage() (map[string]Usage, error) {
+	ret := map[string]Usage{}
+	series := map[string]struct{}{}
+	err := filepath.WalkDir(s.DataDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isProfileFile(path) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.DataDir, path)
+		if err != nil {
+			return err
+		}
+		profileType, _, ok := strings.Cut(rel, string(os.PathSeparator))
+		if !ok {
+			return nil
+		}
+		usage := ret[profileType]
+		usage.Bytes += info.Size()
+		dir := filepath.Dir(rel)
+		if _, ok := series[dir]; !ok {
+			series[dir] = struct{}{}
+			usage.Series++
+		}
+		ret[profileType] = usage
+		return nil
+	})
+	return ret, err
+}
+
+var (
+	storeBytesDesc = prometheus.NewDesc(
+		"pprof_collector_store_bytes",
+		"Bytes on disk, by profile type.",
+		[]string{"profile_type"}, nil,
+	)
+	storeSeriesDesc = prometheus.NewDesc(
+		"pprof_collector_store_series",
+		"Stored series, by profile type.",
+		[]string{"profile_type"}, nil,
+	)
+)
+
+// UsageCollector reports the disk usage of a store when scraped. Usage walks the whole data dir, so it is
+// computed at most once per ttl and scrapes in between report the last usage
+type UsageCollector struct {
+	store *LabelBasedFileStore
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	usage     map[string]Usage
+	err       error
+	updatedAt time.Time
+}
+
+func NewUsageCollector(store *LabelBasedFileStore, ttl time.Duration) *UsageCollector {
+	return &UsageCollector{store: store, ttl: ttl}
+}
+
+func (u *UsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- storeBytesDesc
+	ch <- storeSeriesDesc
+}
+
+// cachedUsage holds the lock while walking, so that concurrent scrapes share the walk
+func (u *UsageCollector) cachedUsage() (map[string]Usage, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.updatedAt.IsZero() || time.Since(u.updatedAt) >= u.ttl {
+		u.usage, u.err = u.store.Usage()
+		u.updatedAt = time.Now()
+	}
+	return u.usage, u.err
+}
+
+func (u *UsageCollector) Collect(ch chan<- prometheus.Metric) {
+	usage, err := u.cachedUsage()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(storeBytesDesc, err)
+		return
+	}
+	for profileType, usage := range usage {
+		ch <- prometheus.MustNewConstMetric(storeBytesDesc, prometheus.GaugeValue, float64(usage.Bytes), profileType)
+		ch <- prometheus.MustNewConstMetric(storeSeriesDesc, prometheus.GaugeValue, float64(usage.Series), profileType)
+	}
+}
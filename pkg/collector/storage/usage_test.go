@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsage(t *testing.T) {
+	store := storage.NewLabelBasedFileStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, &storage.PprofMerger{})
+	heap := testdata.TestData("heap1.pb")
+	lbls := map[string]string{
+		labels.NamespaceLabel: "default",
+		labels.NameLabel:      "example",
+	}
+	now := time.Now()
+	require.NoError(t, store.Put(now, now, "heap", "pod-1", lbls, heap))
+	require.NoError(t, store.Put(now, now, "heap", "pod-2", lbls, heap))
+	require.NoError(t, store.Put(now, now, "goroutine", "pod-1", lbls, heap))
+
+	usage, err := store.Usage()
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage["heap"].Series)
+	assert.Equal(t, 1, usage["goroutine"].Series)
+	assert.Equal(t, int64(2*len(heap)), usage["heap"].Bytes)
+
+	collector := storage.NewUsageCollector(store, time.Hour)
+	expected := `
+# HELP pprof_collector_store_series Stored series, by profile type.
+# TYPE pprof_collector_store_series gauge
+pprof_collector_store_series{profile_type="goroutine"} 1
+pprof_collector_store_series{profile_type="heap"} 2
+`
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "pprof_collector_store_series"))
+
+	// the data dir isn't walked again until the usage expires
+	require.NoError(t, store.Put(now, now, "heap", "pod-3", lbls, heap))
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected), "pprof_collector_store_series"))
+	assert.NoError(t, testutil.CollectAndCompare(storage.NewUsageCollector(store, 0), strings.NewReader(`
+# HELP pprof_collector_store_series Stored series, by profile type.
+# TYPE pprof_collector_store_series gauge
+pprof_collector_store_series{profile_type="goroutine"} 1
+pprof_collector_store_series{profile_type="heap"} 3
+`), "pprof_collector_store_series"))
+}
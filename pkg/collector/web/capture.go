@@ -0,0 +1,175 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+)
+
+type Capturer interface {
+	Capture(ctx context.Context, matchers []*labels.Matcher, profileType string, seconds int) ([]collector.CaptureResult, error)
+}
+
+const (
+	maxCaptureSeconds = 60
+	capturePrefix     = "/pprof/capture/"
+	// capture keys are made of the namespace, name, monitor name and profile type
+	captureKeyParts = 4
+)
+
+type captureRequest struct {
+	Matchers []labels.Matcher `json:"matchers"`
+	Type     string           `json:"type"`
+	Seconds  int              `json:"seconds"`
+}
+
+type captureResponse struct {
+	collector.CaptureResult
+	// View opens the captured profile in the pprof UI
+	View     string `json:"view,omitempty"`
+	Download string `json:"download,omitempty"`
+}
+
+func (r captureRequest) matchers() ([]*labels.Matcher, error) {
+	if len(r.Matchers) == 0 {
+		return nil, fmt.Errorf("at least one matcher is required")
+	}
+	ret := make([]*labels.Matcher, 0, len(r.Matchers))
+	for _, m := range r.Matchers {
+		matcher, err := labels.NewMatcher(m.Type, m.Name, m.Value)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, matcher)
+	}
+	return ret, nil
+}
+
+func (w *WebServer) capture(c *gin.Context) ([]captureResponse, int, error) {
+	var req captureRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if req.Type == "" {
+		return nil, http.StatusBadRequest, fmt.Errorf("type is required")
+	}
+	if req.Seconds < 0 || req.Seconds > maxCaptureSeconds {
+		return nil, http.StatusBadRequest, fmt.Errorf("seconds must be between 0 and %d", maxCaptureSeconds)
+	}
+	matchers, err := req.matchers()
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	results, err := w.collector.Capture(c.Request.Context(), matchers, req.Type, req.Seconds)
+	if err != nil {
+		return nil, artifactErrStatus(err), err
+	}
+	ret := make([]captureResponse, 0, len(results))
+	for _, res := range results {
+		resp := captureResponse{CaptureResult: res}
+		if res.Artifact != nil {
+			resp.View = path.Join(capturePrefix, res.Artifact.Key, res.Artifact.ID) + "/"
+			resp.Download = path.Join("/api/v1/captures/download", res.Artifact.Key, res.Artifact.ID)
+		}
+		ret = append(ret, resp)
+	}
+	return ret, http.StatusOK, nil
+}
+
+func (w *WebServer) registerCaptureRoutes(router *gin.Engine) {
+	// takes a profile of every target matching the label matchers, body: {"matchers": [...], "type": <profile type>, "seconds": <duration>}
+	router.POST("/api/v1/capture", func(c *gin.Context) {
+		wait := w.fanOut(c, "")
+		captures, status, err := w.capture(c)
+		responses := wait()
+		if err != nil && status != http.StatusNotFound {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		// the matching targets can be spread across shards, the shards without any answer not found
+		found := []shardResponse{}
+		for _, resp := range responses {
+			if resp.err != nil || resp.status != http.StatusNotFound {
+				found = append(found, resp)
+			}
+		}
+		if err != nil && len(found) == 0 {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		remote, errs := decodeShards[struct {
+			Captures []captureResponse `json:"captures"`
+		}](found)
+		if len(remote) > 0 {
+			for _, r := range remote {
+				captures = append(captures, r.Captures...)
+			}
+			slices.SortStableFunc(captures, func(a, b captureResponse) int {
+				return strings.Compare(a.Target, b.Target)
+			})
+		}
+		if captures == nil {
+			captures = []captureResponse{}
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"captures": captures}, errs))
+	})
+
+	router.GET("/api/v1/captures", func(c *gin.Context) {
+		captures, errs, err := w.allArtifacts(c, monitor.CaptureKind, "", "captures")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"captures": captures}, errs))
+	})
+
+	router.GET("/api/v1/captures/download/*path", w.shardFallback, func(c *gin.Context) {
+		key, id := splitArtifactPath(c.Param("path"))
+		filepath, err := w.artifacts.GetArtifact(monitor.CaptureKind, key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		filename := strings.ReplaceAll(key, "/", "_") + "_" + id + ".pb.gz"
+		c.FileAttachment(filepath, filename)
+	})
+
+	// the pprof UI of a capture, `<key>/<id>/` followed by the pprof page
+	router.GET(path.Join(capturePrefix, "*path"), w.shardFallback, func(c *gin.Context) {
+		parts := strings.Split(strings.Trim(c.Param("path"), "/"), "/")
+		if len(parts) < captureKeyParts+1 || len(parts) > captureKeyParts+2 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid capture path " + c.Param("path")})
+			return
+		}
+		key, id := path.Join(parts[:captureKeyParts]...), parts[captureKeyParts]
+		profileType := parts[captureKeyParts-1]
+		filepath, err := w.artifacts.GetArtifact(monitor.CaptureKind, key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		pprofServer := &PprofWebWrapper{
+			filepath:    filepath,
+			profileType: profileType,
+		}
+		mux, err := w.driver(filepath, pprofServer)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		newPath := path.Join(pprofPrefix, profileType) + "/"
+		if len(parts) == captureKeyParts+2 {
+			newPath = path.Join(pprofPrefix, profileType, parts[captureKeyParts+1])
+		}
+		c.Request.URL.Path = newPath
+		mux.ServeHTTP(c.Writer, c.Request)
+	})
+}
@@ -0,0 +1,96 @@
+package web
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector/correlation"
+)
+
+type correlatedSeries struct {
+	correlation.SeriesRef
+	// Link opens the series in the embedded pprof UI, focused on the matching samples
+	Link string `json:"link"`
+}
+
+func (w *WebServer) registerCorrelationRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/correlation")
+
+	api.GET("/labels", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"labels": w.index.Labels()})
+	})
+
+	// lists the series with samples matching ?label=<label>&value=<value>
+	api.GET("/series", func(c *gin.Context) {
+		label, value, ok := labelValueParams(c)
+		if !ok {
+			return
+		}
+		wait := w.fanOut(c, "")
+		refs := w.index.Lookup(label, value)
+		ret := make([]correlatedSeries, 0, len(refs))
+		for _, ref := range refs {
+			ret = append(ret, correlatedSeries{
+				SeriesRef: ref,
+				Link:      correlatedLink(ref, label, value),
+			})
+		}
+		remote, errs := decodeShards[struct {
+			Series []correlatedSeries `json:"series"`
+		}](wait())
+		for _, r := range remote {
+			ret = append(ret, r.Series...)
+		}
+		if len(remote) > 0 {
+			slices.SortFunc(ret, func(a, b correlatedSeries) int {
+				if c := strings.Compare(a.ProfileType, b.ProfileType); c != 0 {
+					return c
+				}
+				return strings.Compare(a.Key, b.Key)
+			})
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"series": ret}, errs))
+	})
+
+	// returns the latest profile of a series, only keeping samples matching ?label=<label>&value=<value>
+	api.GET("/profile/:profileType/*key", w.shardFallback, func(c *gin.Context) {
+		label, value, ok := labelValueParams(c)
+		if !ok {
+			return
+		}
+		profileType := c.Param("profileType")
+		key := strings.TrimPrefix(strings.TrimSpace(c.Param("key")), "/")
+		p, err := w.latestProfile(profileType, key)
+		if err != nil {
+			c.JSON(profileErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		b := bytes.NewBuffer([]byte{})
+		if err := correlation.Filter(p, label, value).Write(b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "application/octet-stream", b.Bytes())
+	})
+}
+
+func labelValueParams(c *gin.Context) (string, string, bool) {
+	label, value := c.Query("label"), c.Query("value")
+	if label == "" || value == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "label and value query parameters are required"})
+		return "", "", false
+	}
+	return label, value, true
+}
+
+func correlatedLink(ref correlation.SeriesRef, label, value string) string {
+	q := url.Values{}
+	// tf is the tagfocus parameter of the pprof web UI
+	q.Set("tf", label+"="+value)
+	return path.Join(pprofPrefix, ref.ProfileType, ref.Key) + "/?" + q.Encode()
+}
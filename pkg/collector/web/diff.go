@@ -0,0 +1,288 @@
+package web
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/query"
+)
+
+const diffPrefix = "/pprof/diff"
+
+// diffQueries reads the selection from the parameters of parseQuery, and the base it is compared to from
+// `?base_selector=<selector>&base_start=<time>&base_end=<time>`, which default to the selection's
+func diffQueries(c *gin.Context) (query.Query, query.Query, error) {
+	target, err := parseQuery(c)
+	if err != nil {
+		return query.Query{}, query.Query{}, err
+	}
+	if target.ProfileType == "" {
+		return query.Query{}, query.Query{}, fmt.Errorf("type is required")
+	}
+	base := target
+	if raw := c.Query("base_selector"); raw != "" {
+		if base.Matchers, err = labels.ParseSelector(raw); err != nil {
+			return query.Query{}, query.Query{}, fmt.Errorf("invalid base selector: %w", err)
+		}
+	}
+	if raw := c.Query("base_start"); raw != "" {
+		if base.Start, err = parseTime(raw); err != nil {
+			return query.Query{}, query.Query{}, err
+		}
+	}
+	if raw := c.Query("base_end"); raw != "" {
+		if base.End, err = parseTime(raw); err != nil {
+			return query.Query{}, query.Query{}, err
+		}
+	}
+	if !base.Start.IsZero() && !base.End.IsZero() && !base.Start.Before(base.End) {
+		return query.Query{}, query.Query{}, fmt.Errorf("base_start must be before base_end")
+	}
+	return target, base, nil
+}
+
+// mergeDiff merges the selection and its base, a side without data is compared as empty. It returns
+// query.ErrNoData when neither has data, errs are the shards that failed
+func (w *WebServer) mergeDiff(c *gin.Context, targetQuery, baseQuery query.Query) (target, base *profile.Profile, errs map[string]string, err error) {
+	errs = map[string]string{}
+	merge := func(q query.Query) (*profile.Profile, error) {
+		p, shardErrs, err := w.queryProfile(c, q)
+		maps.Copy(errs, shardErrs)
+		if errors.Is(err, query.ErrNoData) {
+			return nil, nil
+		}
+		return p, err
+	}
+	if target, err = merge(targetQuery); err != nil {
+		return nil, nil, errs, err
+	}
+	if base, err = merge(baseQuery); err != nil {
+		return nil, nil, errs, err
+	}
+	switch {
+	case target == nil && base == nil:
+		return nil, nil, errs, fmt.Errorf("%w in either selection", query.ErrNoData)
+	case target == nil:
+		target = query.Empty(base)
+	case base == nil:
+		base = query.Empty(target)
+	}
+	return target, base, errs, nil
+}
+
+// diffKey identifies the data of the compared selections : the series of both sides and the times of their
+// profiles, without reading the profiles
+func (w *WebServer) diffKey(c *gin.Context, targetQuery, baseQuery query.Query) (string, map[string]string, error) {
+	errs := map[string]string{}
+	h := sha256.New()
+	for _, q := range []query.Query{targetQuery, baseQuery} {
+		series, shardErrs, err := w.selectSeries(c, seriesURI(q), q)
+		if err != nil {
+			return "", errs, err
+		}
+		maps.Copy(errs, shardErrs)
+		for _, s := range series {
+			fmt.Fprintf(h, "%s/%s %d %d\n", s.ProfileType, s.Key, s.Start.UnixNano(), s.End.UnixNano())
+		}
+		fmt.Fprintln(h)
+	}
+	return fmt.Sprintf("%s %x", diffGroup(c), h.Sum(nil)), errs, nil
+}
+
+// diffKeyTTL is how long the key of a selection is reused : the pprof UI requests its views and assets in
+// bursts, each of which would otherwise list the series of every shard. New data is shown once it expires
+const diffKeyTTL = 10 * time.Second
+
+type diffKey struct {
+	key     string
+	expires time.Time
+}
+
+// diffKeys holds the recent keys of the viewed selections, by diffGroup
+type diffKeys struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]diffKey
+}
+
+func newDiffKeys(ttl time.Duration) *diffKeys {
+	return &diffKeys{ttl: ttl, entries: map[string]diffKey{}}
+}
+
+// get returns the key of group, computed again once expired. Concurrent misses compute it concurrently
+func (d *diffKeys) get(group string, compute func() (string, map[string]string, error)) (string, map[string]string, error) {
+	now := time.Now()
+	d.mu.Lock()
+	if e, ok := d.entries[group]; ok && now.Before(e.expires) {
+		d.mu.Unlock()
+		return e.key, nil, nil
+	}
+	d.mu.Unlock()
+
+	key, errs, err := compute()
+	if err != nil || len(errs) > 0 {
+		// keys missing the series of failed shards aren't reused
+		return key, errs, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	maps.DeleteFunc(d.entries, func(_ string, e diffKey) bool {
+		return !now.Before(e.expires)
+	})
+	d.entries[group] = diffKey{key: key, expires: now.Add(d.ttl)}
+	return key, nil, nil
+}
+
+// diffGroup identifies the compared selections, the pprof UI adds its own parameters to the query
+func diffGroup(c *gin.Context) string {
+	values := url.Values{}
+	for _, param := range []string{"type", "selector", "start", "end", "base_selector", "base_start", "base_end"} {
+		if v := c.Query(param); v != "" {
+			values.Set(param, v)
+		}
+	}
+	return diffPrefix + "?" + values.Encode()
+}
+
+func (w *WebServer) registerDiffRoutes(router *gin.Engine) {
+	// compares a selection to a base, ?format=<pprof|json|tree|top> with the options of flamegraphs and top
+	// tables. Values are the selection's minus the base's, percentages are relative to the base
+	router.GET("/api/v1/query/diff", func(c *gin.Context) {
+		format := c.DefaultQuery("format", "pprof")
+		if format != "pprof" && format != "json" && format != "tree" && format != "top" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q, expected pprof, json, tree or top", format)})
+			return
+		}
+		opts, err := renderOptions(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		sortBy, limit, err := topParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		targetQuery, baseQuery, err := diffQueries(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		target, base, errs, err := w.mergeDiff(c, targetQuery, baseQuery)
+		w.setShardErrors(c, errs)
+		if err != nil {
+			c.JSON(queryErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		diff, err := query.Diff(target, base)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		opts = opts.RelativeTo(base)
+		switch format {
+		case "json":
+			c.JSON(http.StatusOK, query.ToJSON(diff))
+		case "tree":
+			renderFlamegraph(c, diff, opts)
+		case "top":
+			top, err := opts.Top(diff, sortBy, limit)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusOK, top)
+		default:
+			b := bytes.NewBuffer([]byte{})
+			if err := diff.Write(b); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, "application/octet-stream", b.Bytes())
+		}
+	})
+
+	router.GET("/ui/diff", func(c *gin.Context) {
+		if err := w.templates.ExecuteTemplate(c.Writer, "diff.html.tmpl", c.Request.URL.Query()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	})
+
+	// the embedded pprof UI, with the base as -diff_base. The selections are kept in the query parameters,
+	// which the pprof UI carries over to its other views
+	router.GET(path.Join(diffPrefix, "*view"), func(c *gin.Context) {
+		targetQuery, baseQuery, err := diffQueries(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		errs := map[string]string{}
+		build := func() (*http.ServeMux, int64, error) {
+			target, base, shardErrs, err := w.mergeDiff(c, targetQuery, baseQuery)
+			maps.Copy(errs, shardErrs)
+			if err != nil {
+				return nil, 0, err
+			}
+			dir, err := os.MkdirTemp("", "pprof-diff-")
+			if err != nil {
+				return nil, 0, err
+			}
+			// the driver parses the profiles before returning
+			defer os.RemoveAll(dir)
+			var size int64
+			for name, p := range map[string]*profile.Profile{"target": target, "base": base} {
+				b := bytes.NewBuffer([]byte{})
+				if err := p.Write(b); err != nil {
+					return nil, 0, err
+				}
+				if err := os.WriteFile(path.Join(dir, name), b.Bytes(), 0644); err != nil {
+					return nil, 0, err
+				}
+				size += int64(b.Len())
+			}
+			pprofServer := &PprofWebWrapper{
+				filepath: path.Join(dir, "target"),
+				diffBase: path.Join(dir, "base"),
+				prefix:   diffPrefix,
+			}
+			mux, err := pprofServer.Driver()
+			return mux, size * driverMemoryFactor, err
+		}
+		var mux *http.ServeMux
+		if w.drivers == nil {
+			mux, _, err = build()
+		} else {
+			// the profiles are merged again once the series of either selection get new data
+			var key string
+			var keyErrs map[string]string
+			key, keyErrs, err = w.diffKeys.get(diffGroup(c), func() (string, map[string]string, error) {
+				return w.diffKey(c, targetQuery, baseQuery)
+			})
+			maps.Copy(errs, keyErrs)
+			if err == nil {
+				mux, err = w.drivers.Get(diffGroup(c), key, build)
+			}
+		}
+		w.setShardErrors(c, errs)
+		if err != nil {
+			c.JSON(queryErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// the root view is served at the prefix itself
+		c.Request.URL.Path = path.Join(diffPrefix, strings.Trim(c.Param("view"), "/"))
+		mux.ServeHTTP(c.Writer, c.Request)
+	})
+}
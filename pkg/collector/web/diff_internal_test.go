@@ -0,0 +1,37 @@
+package web
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffKeys(t *testing.T) {
+	keys := newDiffKeys(50 * time.Millisecond)
+	computed := 0
+	compute := func(key string, errs map[string]string) func() (string, map[string]string, error) {
+		return func() (string, map[string]string, error) {
+			computed++
+			return key, errs, nil
+		}
+	}
+	get := func(group string, f func() (string, map[string]string, error)) string {
+		key, _, err := keys.get(group, f)
+		require.NoError(t, err)
+		return key
+	}
+
+	assert.Equal(t, "a1", get("a", compute("a1", nil)))
+	assert.Equal(t, "a1", get("a", compute("a2", nil)))
+	assert.Equal(t, "b1", get("b", compute("b1", nil)))
+	assert.Equal(t, 2, computed)
+
+	// keys missing the series of failed shards aren't reused
+	get("c", compute("c1", map[string]string{"shard-1": "unreachable"}))
+	assert.Equal(t, "c2", get("c", compute("c2", nil)))
+
+	time.Sleep(60 * time.Millisecond)
+	assert.Equal(t, "a2", get("a", compute("a2", nil)))
+}
@@ -0,0 +1,72 @@
+package web_test
+
+import (
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/cache"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/collector/web"
+	"github.com/rancher-sandbox/profiling/pkg/test/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingStore counts the reads of profile files and the listings of series
+type countingStore struct {
+	storage.Store
+	gets   atomic.Int32
+	series atomic.Int32
+}
+
+func (s *countingStore) Series() ([]storage.Series, error) {
+	s.series.Add(1)
+	return s.Store.Series()
+}
+
+func (s *countingStore) Get(profileType, key string) ([]string, error) {
+	s.gets.Add(1)
+	return s.Store.Get(profileType, key)
+}
+
+func TestDiffUICache(t *testing.T) {
+	store := &countingStore{
+		Store: storage.NewLabelBasedFileStore(t.TempDir(), []string{"__k8s_namespace", "__k8s_name"}, &storage.PprofMerger{}),
+	}
+	labels := map[string]string{"__k8s_namespace": "default", "__k8s_name": "app"}
+	start := time.Now().Add(-time.Hour)
+	put := func(i int, data []byte) {
+		require.NoError(t, store.Put(start.Add(time.Duration(i)*time.Minute), start.Add(time.Duration(i+1)*time.Minute), "cpu", "app", labels, data))
+	}
+	put(0, testdata.TestData("profile1.pb"))
+	put(1, testdata.TestData("profile2.pb"))
+
+	baseURL := startWebServer(t, store, func(w *web.WebServer) {
+		w.SetDriverCache(cache.NewLRU[*http.ServeMux](256 << 20))
+	})
+
+	values := url.Values{}
+	values.Set("type", "cpu")
+	values.Set("base_end", start.Add(time.Minute).Format(time.RFC3339Nano))
+	uri := baseURL + "/pprof/diff/top?" + values.Encode()
+	get := func() int {
+		return getStatus(t, uri)
+	}
+	assert.Equal(t, http.StatusOK, get())
+
+	// the other views and assets of the UI neither read the profiles nor list the series again
+	gets, series := store.gets.Load(), store.series.Load()
+	assert.Greater(t, gets, int32(0))
+	assert.Equal(t, http.StatusOK, get())
+	assert.Equal(t, http.StatusOK, getStatus(t, baseURL+"/pprof/diff/flamegraph?"+values.Encode()))
+	assert.Equal(t, gets, store.gets.Load())
+	assert.Equal(t, series, store.series.Load())
+
+	// another selection gets its own UI
+	values.Set("base_end", start.Add(2*time.Minute).Format(time.RFC3339Nano))
+	assert.Equal(t, http.StatusOK, getStatus(t, baseURL+"/pprof/diff/top?"+values.Encode()))
+	assert.Greater(t, store.series.Load(), series)
+}
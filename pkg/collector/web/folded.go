@@ -0,0 +1,68 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/folded"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+var errSeriesNotFound = errors.New("series not found")
+
+// latestProfile parses the most recent profile stored for the series
+func (w *WebServer) latestProfile(profileType, key string) (*profile.Profile, error) {
+	filepaths, err := w.store.Get(profileType, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(filepaths) == 0 {
+		return nil, fmt.Errorf("%w: %s", errSeriesNotFound, path.Join(profileType, key))
+	}
+	data, err := os.ReadFile(filepaths[len(filepaths)-1])
+	if err != nil {
+		return nil, err
+	}
+	return profile.Parse(bytes.NewReader(data))
+}
+
+func profileErrStatus(err error) int {
+	if errors.Is(err, storage.ErrInvalidSeries) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, errSeriesNotFound) || errors.Is(err, os.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func (w *WebServer) registerFoldedRoutes(router *gin.Engine) {
+	// exports the latest profile of a series as folded stacks, ?sample_type=<name> selects the sample type
+	router.GET("/api/v1/folded/:profileType/*key", w.shardFallback, func(c *gin.Context) {
+		profileType := c.Param("profileType")
+		key := strings.TrimPrefix(strings.TrimSpace(c.Param("key")), "/")
+		p, err := w.latestProfile(profileType, key)
+		if err != nil {
+			c.JSON(profileErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		sampleIndex, err := p.SampleIndexByName(c.Query("sample_type"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		b := bytes.NewBuffer([]byte{})
+		if err := folded.Write(b, p, sampleIndex); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", b.Bytes())
+	})
+}
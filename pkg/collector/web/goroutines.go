@@ -0,0 +1,273 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector/goroutines"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+type GoroutineCapturer interface {
+	CaptureGoroutines(ctx context.Context, name string) (storage.Artifact, error)
+}
+
+// goroutineFilter reads `?q=<function or file substring>&state=<state>&min_wait=<minutes>`
+func goroutineFilter(c *gin.Context) (goroutines.Filter, error) {
+	f := goroutines.Filter{
+		Query: strings.TrimSpace(c.Query("q")),
+		State: strings.TrimSpace(c.Query("state")),
+	}
+	if raw := c.Query("min_wait"); raw != "" {
+		minWait, err := strconv.Atoi(raw)
+		if err != nil || minWait < 0 {
+			return goroutines.Filter{}, fmt.Errorf("min_wait must be a number of minutes")
+		}
+		f.MinWaitMinutes = minWait
+	}
+	return f, nil
+}
+
+func (w *WebServer) parseGoroutineDump(key, id string) ([]goroutines.Goroutine, error) {
+	filepath, err := w.artifacts.GetArtifact(goroutines.ArtifactKind, key, id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return goroutines.Parse(f)
+}
+
+// latestGoroutineDumps returns the most recent dump of every series whose key starts with prefix
+func (w *WebServer) latestGoroutineDumps(prefix string) ([]storage.Artifact, error) {
+	dumps, err := w.artifacts.ListArtifacts(goroutines.ArtifactKind)
+	if err != nil {
+		return nil, err
+	}
+	prefix = strings.Trim(prefix, "/")
+	seen := map[string]struct{}{}
+	ret := []storage.Artifact{}
+	// dumps are listed most recent first
+	for _, dump := range dumps {
+		if _, ok := seen[dump.Key]; ok {
+			continue
+		}
+		if prefix != "" && dump.Key != prefix && !strings.HasPrefix(dump.Key, prefix+"/") {
+			continue
+		}
+		seen[dump.Key] = struct{}{}
+		ret = append(ret, dump)
+	}
+	return ret, nil
+}
+
+type goroutineSearch struct {
+	Groups []goroutines.Group `json:"groups"`
+	Dumps  []storage.Artifact `json:"dumps"`
+	// Errors lists the dumps that couldn't be parsed
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// searchGoroutines groups the matching goroutines of the latest dump of every series, by stack. The searches
+// of the other shards are merged, uri is their search API
+func (w *WebServer) searchGoroutines(c *gin.Context, uri string, filter goroutines.Filter) (goroutineSearch, map[string]string, error) {
+	wait := w.fanOut(c, uri)
+	dumps, err := w.latestGoroutineDumps(c.Query("prefix"))
+	if err != nil {
+		wait()
+		return goroutineSearch{}, nil, err
+	}
+	ret := goroutineSearch{Dumps: dumps, Errors: map[string]string{}}
+	grouper := goroutines.NewGrouper()
+	for _, dump := range dumps {
+		gs, err := w.parseGoroutineDump(dump.Key, dump.ID)
+		if err != nil {
+			ret.Errors[dump.Key] = err.Error()
+			continue
+		}
+		grouper.Add(dump.Key, filter.Apply(gs))
+	}
+	remote, errs := decodeShards[goroutineSearch](wait())
+	lists := make([][]storage.Artifact, 0, len(remote))
+	for _, search := range remote {
+		for _, group := range search.Groups {
+			grouper.AddGroup(group)
+		}
+		maps.Copy(ret.Errors, search.Errors)
+		lists = append(lists, search.Dumps)
+	}
+	ret.Dumps = mergeArtifacts(ret.Dumps, lists)
+	ret.Groups = grouper.Groups()
+	return ret, errs, nil
+}
+
+type goroutinesView struct {
+	Query   string
+	State   string
+	MinWait int
+	Prefix  string
+	// Dump is set when viewing a single dump
+	Dump *storage.Artifact
+	goroutineSearch
+}
+
+func (w *WebServer) renderGoroutines(c *gin.Context, view goroutinesView) {
+	if err := w.templates.ExecuteTemplate(c.Writer, "goroutines.html.tmpl", view); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (w *WebServer) registerGoroutineRoutes(router *gin.Engine) {
+	router.GET("/api/v1/goroutines", func(c *gin.Context) {
+		dumps, errs, err := w.allArtifacts(c, goroutines.ArtifactKind, "", "dumps")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"dumps": dumps}, errs))
+	})
+
+	// captures a goroutine dump on demand, ?target=<monitor name>
+	router.POST("/api/v1/goroutines/capture", w.shardFallback, func(c *gin.Context) {
+		target := c.Query("target")
+		if target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target is required"})
+			return
+		}
+		artifact, err := w.collector.CaptureGoroutines(c.Request.Context(), target)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, artifact)
+	})
+
+	// the raw dump, as served by the target
+	router.GET("/api/v1/goroutines/download/*path", w.shardFallback, func(c *gin.Context) {
+		key, id := splitArtifactPath(c.Param("path"))
+		filepath, err := w.artifacts.GetArtifact(goroutines.ArtifactKind, key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		filename := strings.ReplaceAll(key, "/", "_") + "_" + id + ".txt"
+		c.FileAttachment(filepath, filename)
+	})
+
+	// the goroutines of a dump, ?group=true groups them by stack
+	router.GET("/api/v1/goroutines/dump/*path", w.shardFallback, func(c *gin.Context) {
+		filter, err := goroutineFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		key, id := splitArtifactPath(c.Param("path"))
+		gs, err := w.parseGoroutineDump(key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		gs = filter.Apply(gs)
+		if c.Query("group") == "true" {
+			grouper := goroutines.NewGrouper()
+			grouper.Add(key, gs)
+			c.JSON(http.StatusOK, gin.H{"groups": grouper.Groups()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"goroutines": gs})
+	})
+
+	// searches the latest dump of every series, ?prefix=<namespace>[/<name>] restricts the series
+	router.GET("/api/v1/goroutines/search", func(c *gin.Context) {
+		filter, err := goroutineFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		search, errs, err := w.searchGoroutines(c, "", filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if len(errs) > 0 {
+			c.JSON(http.StatusOK, gin.H{
+				"groups":       search.Groups,
+				"dumps":        search.Dumps,
+				"errors":       search.Errors,
+				"shard_errors": errs,
+			})
+			return
+		}
+		c.JSON(http.StatusOK, search)
+	})
+
+	router.GET("/ui/goroutines", func(c *gin.Context) {
+		filter, err := goroutineFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		search, errs, err := w.searchGoroutines(c, "/api/v1/goroutines/search?"+c.Request.URL.RawQuery, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		w.logShardErrors(errs)
+		w.renderGoroutines(c, goroutinesView{
+			Query:           filter.Query,
+			State:           filter.State,
+			MinWait:         filter.MinWaitMinutes,
+			Prefix:          c.Query("prefix"),
+			goroutineSearch: search,
+		})
+	})
+
+	router.POST("/ui/goroutines/capture", w.shardFallback, func(c *gin.Context) {
+		target := c.PostForm("target")
+		if target == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "target is required"})
+			return
+		}
+		artifact, err := w.collector.CaptureGoroutines(c.Request.Context(), target)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusSeeOther, path.Join("/ui/goroutines/view", artifact.Key, artifact.ID))
+	})
+
+	router.GET("/ui/goroutines/view/*path", w.shardFallback, func(c *gin.Context) {
+		filter, err := goroutineFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		key, id := splitArtifactPath(c.Param("path"))
+		gs, err := w.parseGoroutineDump(key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		grouper := goroutines.NewGrouper()
+		grouper.Add(key, filter.Apply(gs))
+		w.renderGoroutines(c, goroutinesView{
+			Query:   filter.Query,
+			State:   filter.State,
+			MinWait: filter.MinWaitMinutes,
+			Dump:    &storage.Artifact{Kind: goroutines.ArtifactKind, Key: key, ID: id},
+			goroutineSearch: goroutineSearch{
+				Groups: grouper.Groups(),
+			},
+		})
+	})
+}
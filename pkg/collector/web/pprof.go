@@ -3,24 +3,74 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"os"
 	"path"
 
 	"github.com/google/pprof/driver"
+	"github.com/rancher-sandbox/profiling/pkg/collector/cache"
 	"github.com/rancher-sandbox/profiling/pkg/collector/web/internal/pprof"
 )
 
+// driverMemoryFactor estimates the memory held by the pprof UI of a profile from the size of its gzipped file
+const driverMemoryFactor = 10
+
+// SetDriverCache keeps the pprof UIs of the last viewed profiles, rather than parsing the profile on every
+// request of the UI and its assets. It must be called before Start
+func (w *WebServer) SetDriverCache(drivers *cache.LRU[*http.ServeMux]) {
+	w.drivers = drivers
+}
+
+// driver returns the pprof UI of p, cached by the profile files it shows. A group holds the UI of the latest
+// files of a series, so new data replaces it
+func (w *WebServer) driver(group string, p *PprofWebWrapper) (*http.ServeMux, error) {
+	if w.drivers == nil {
+		return p.Driver()
+	}
+	key := fmt.Sprintf("%s %s %s", p.basePath(), p.filepath, p.diffBase)
+	return w.drivers.Get(group, key, func() (*http.ServeMux, int64, error) {
+		var size int64
+		for _, filepath := range []string{p.filepath, p.diffBase} {
+			if filepath == "" {
+				continue
+			}
+			info, err := os.Stat(filepath)
+			if err != nil {
+				return nil, 0, err
+			}
+			size += info.Size()
+		}
+		mux, err := p.Driver()
+		return mux, size * driverMemoryFactor, err
+	})
+}
+
 type PprofWebWrapper struct {
 	filepath    string
 	profileType string
+	// diffBase is subtracted from the profile, when set
+	diffBase string
+	// prefix the UI is served under, defaults to the profile type under pprofPrefix
+	prefix string
+}
+
+func (p *PprofWebWrapper) basePath() string {
+	if p.prefix != "" {
+		return p.prefix
+	}
+	return path.Join(pprofPrefix, p.profileType)
 }
 
 func (p *PprofWebWrapper) Driver() (*http.ServeMux, error) {
 
 	mux := http.NewServeMux()
 
+	args := []string{"-http=localhost:0", "-no_browser"}
+	if p.diffBase != "" {
+		args = append(args, "-diff_base", p.diffBase)
+	}
 	options := &driver.Options{
 		Flagset: &pprof.Flags{
-			Args: []string{"-http=localhost:0", "-no_browser", p.filepath},
+			Args: append(args, p.filepath),
 		},
 		HTTPServer: p.server(mux),
 	}
@@ -44,9 +94,9 @@ func (p *PprofWebWrapper) server(mux *http.ServeMux) func(*driver.HTTPServerArgs
 		for pattern, handler := range args.Handlers {
 			var joinedPattern string
 			if pattern == "/" {
-				joinedPattern = path.Join(pprofPrefix, p.profileType)
+				joinedPattern = p.basePath()
 			} else {
-				joinedPattern = path.Join(pprofPrefix, p.profileType, pattern)
+				joinedPattern = path.Join(p.basePath(), pattern)
 			}
 			mux.Handle(joinedPattern, debugWrapper(handler))
 		}
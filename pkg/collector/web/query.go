@@ -0,0 +1,412 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/pprof/profile"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/query"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+// parseTime accepts RFC3339 times and unix timestamps in seconds, an empty time is the zero time
+func parseTime(raw string) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		return time.Unix(0, int64(seconds*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339 or unix seconds", raw)
+	}
+	return t, nil
+}
+
+// parseQuery reads `?selector={<label><op>"<value>",...}&type=<profile type>&start=<time>&end=<time>`
+func parseQuery(c *gin.Context) (query.Query, error) {
+	matchers, err := labels.ParseSelector(c.Query("selector"))
+	if err != nil {
+		return query.Query{}, err
+	}
+	start, err := parseTime(c.Query("start"))
+	if err != nil {
+		return query.Query{}, err
+	}
+	end, err := parseTime(c.Query("end"))
+	if err != nil {
+		return query.Query{}, err
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return query.Query{}, fmt.Errorf("start must be before end")
+	}
+	return query.Query{
+		ProfileType: c.Query("type"),
+		Matchers:    matchers,
+		Start:       start,
+		End:         end,
+	}, nil
+}
+
+// renderOptions reads `?sample_type=<name>&focus=<regex>&ignore=<regex>&hide=<regex>&node_fraction=<0-1>`
+func renderOptions(c *gin.Context) (query.Options, error) {
+	opts := query.Options{SampleType: c.Query("sample_type")}
+	for param, re := range map[string]**regexp.Regexp{
+		"focus":  &opts.Focus,
+		"ignore": &opts.Ignore,
+		"hide":   &opts.Hide,
+	} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		compiled, err := regexp.Compile(raw)
+		if err != nil {
+			return query.Options{}, fmt.Errorf("invalid %s regex: %w", param, err)
+		}
+		*re = compiled
+	}
+	if raw := c.Query("node_fraction"); raw != "" {
+		fraction, err := strconv.ParseFloat(raw, 64)
+		if err != nil || fraction < 0 || fraction > 1 {
+			return query.Options{}, fmt.Errorf("node_fraction must be between 0 and 1")
+		}
+		opts.NodeFraction = fraction
+	}
+	return opts, nil
+}
+
+// topParams reads `?sort=<flat|cum>&limit=<n>`
+func topParams(c *gin.Context) (string, int, error) {
+	limit := 0
+	if raw := c.Query("limit"); raw != "" {
+		var err error
+		if limit, err = strconv.Atoi(raw); err != nil || limit < 0 {
+			return "", 0, fmt.Errorf("limit must be a positive number")
+		}
+	}
+	sortBy := c.DefaultQuery("sort", query.SortFlat)
+	if sortBy != query.SortFlat && sortBy != query.SortCum {
+		return "", 0, fmt.Errorf("invalid sort %q, expected flat or cum", sortBy)
+	}
+	return sortBy, limit, nil
+}
+
+// renderedProfile merges the profile of the query for rendering, it writes the error response on failure
+func (w *WebServer) renderedProfile(c *gin.Context) (*profile.Profile, query.Options, bool) {
+	q, err := parseQuery(c)
+	if err == nil && q.ProfileType == "" {
+		err = fmt.Errorf("type is required")
+	}
+	var opts query.Options
+	if err == nil {
+		opts, err = renderOptions(c)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, query.Options{}, false
+	}
+	p, errs, err := w.queryProfile(c, q)
+	w.setShardErrors(c, errs)
+	if err != nil {
+		c.JSON(queryErrStatus(err), gin.H{"error": err.Error()})
+		return nil, query.Options{}, false
+	}
+	return p, opts, true
+}
+
+// selectSeries returns the matching series of every shard, uri is the series API of the other shards
+func (w *WebServer) selectSeries(c *gin.Context, uri string, q query.Query) ([]storage.Series, map[string]string, error) {
+	wait := w.fanOut(c, uri)
+	series, err := query.Select(w.store, q)
+	if err != nil {
+		wait()
+		return nil, nil, err
+	}
+	remote, errs := decodeShards[struct {
+		Series []storage.Series `json:"series"`
+	}](wait())
+	if len(remote) > 0 {
+		for _, r := range remote {
+			series = append(series, r.Series...)
+		}
+		slices.SortFunc(series, func(a, b storage.Series) int {
+			if c := strings.Compare(a.ProfileType, b.ProfileType); c != 0 {
+				return c
+			}
+			return strings.Compare(a.Key, b.Key)
+		})
+	}
+	return series, errs, nil
+}
+
+// queryValues are the query parameters of q, as read by parseQuery
+func queryValues(q query.Query) url.Values {
+	ret := url.Values{}
+	if len(q.Matchers) > 0 {
+		matchers := make([]string, 0, len(q.Matchers))
+		for _, m := range q.Matchers {
+			matchers = append(matchers, m.String())
+		}
+		ret.Set("selector", "{"+strings.Join(matchers, ",")+"}")
+	}
+	if q.ProfileType != "" {
+		ret.Set("type", q.ProfileType)
+	}
+	if !q.Start.IsZero() {
+		ret.Set("start", q.Start.Format(time.RFC3339Nano))
+	}
+	if !q.End.IsZero() {
+		ret.Set("end", q.End.Format(time.RFC3339Nano))
+	}
+	return ret
+}
+
+// seriesURI is the series API of the query
+func seriesURI(q query.Query) string {
+	return "/api/v1/query/series?" + queryValues(q).Encode()
+}
+
+// queryProfile merges the matching profiles of every shard, it returns query.ErrNoData when none of them
+// has data in the window
+func (w *WebServer) queryProfile(c *gin.Context, q query.Query) (*profile.Profile, map[string]string, error) {
+	values := queryValues(q)
+	values.Set("format", "pprof")
+	wait := w.fanOut(c, "/api/v1/query/profile?"+values.Encode())
+	local, err := query.Profile(w.store, q)
+	if err != nil && !errors.Is(err, query.ErrNoData) {
+		wait()
+		return nil, nil, err
+	}
+	profiles := []*profile.Profile{}
+	if local != nil {
+		profiles = append(profiles, local)
+	}
+	errs := map[string]string{}
+	for _, resp := range wait() {
+		if resp.err == nil && resp.status == http.StatusNotFound {
+			continue
+		}
+		if resp.err == nil && resp.status != http.StatusOK {
+			resp.err = fmt.Errorf("unexpected status %d : %s", resp.status, resp.body)
+		}
+		var p *profile.Profile
+		if resp.err == nil {
+			p, resp.err = profile.Parse(bytes.NewReader(resp.body))
+		}
+		if resp.err != nil {
+			errs[resp.peer] = resp.err.Error()
+			continue
+		}
+		profiles = append(profiles, p)
+	}
+	merged, err := query.Merge(profiles)
+	return merged, errs, err
+}
+
+// setShardErrors reports the shards that couldn't be queried in a header, for responses that aren't JSON objects
+func (w *WebServer) setShardErrors(c *gin.Context, errs map[string]string) {
+	if len(errs) == 0 {
+		return
+	}
+	w.logShardErrors(errs)
+	c.Header(shardErrorsHeader, strings.Join(slices.Sorted(maps.Keys(errs)), ","))
+}
+
+func renderFlamegraph(c *gin.Context, p *profile.Profile, opts query.Options) {
+	tree, err := opts.Flamegraph(p)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+func queryErrStatus(err error) int {
+	if errors.Is(err, query.ErrNoData) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// sortedSet returns the values of a set, sorted
+func sortedSet(set map[string]struct{}) []string {
+	return slices.Sorted(maps.Keys(set))
+}
+
+func (w *WebServer) registerQueryRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/query")
+
+	// the label names of the matching series
+	api.GET("/labels", func(c *gin.Context) {
+		q, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		series, errs, err := w.selectSeries(c, seriesURI(q), q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		names := map[string]struct{}{}
+		for _, s := range series {
+			for name := range s.Labels {
+				names[name] = struct{}{}
+			}
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"labels": sortedSet(names)}, errs))
+	})
+
+	// the values of a label across the matching series
+	api.GET("/labels/:name/values", func(c *gin.Context) {
+		q, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		series, errs, err := w.selectSeries(c, seriesURI(q), q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		values := map[string]struct{}{}
+		for _, s := range series {
+			if v, ok := s.Labels[c.Param("name")]; ok {
+				values[v] = struct{}{}
+			}
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"values": sortedSet(values)}, errs))
+	})
+
+	// the profile types of the matching series
+	api.GET("/profile_types", func(c *gin.Context) {
+		q, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		series, errs, err := w.selectSeries(c, seriesURI(q), q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		types := map[string]struct{}{}
+		for _, s := range series {
+			types[s.ProfileType] = struct{}{}
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"profileTypes": sortedSet(types)}, errs))
+	})
+
+	// the matching series, with the time range of their data
+	api.GET("/series", func(c *gin.Context) {
+		q, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		series, errs, err := w.selectSeries(c, "", q)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"series": series}, errs))
+	})
+
+	// a single series, with the sample types of its latest profile
+	api.GET("/series/:profileType/*key", w.shardFallback, func(c *gin.Context) {
+		profileType := c.Param("profileType")
+		key := strings.Trim(strings.TrimSpace(c.Param("key")), "/")
+		series, err := query.Select(w.store, query.Query{ProfileType: profileType})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		i := slices.IndexFunc(series, func(s storage.Series) bool { return s.Key == key })
+		if i < 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s: %s/%s", errSeriesNotFound, profileType, key)})
+			return
+		}
+		p, err := w.latestProfile(profileType, key)
+		if err != nil {
+			c.JSON(profileErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		sampleTypes := make([]query.ValueType, 0, len(p.SampleType))
+		for _, st := range p.SampleType {
+			sampleTypes = append(sampleTypes, query.ValueType{Type: st.Type, Unit: st.Unit})
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"series":            series[i],
+			"sampleTypes":       sampleTypes,
+			"defaultSampleType": p.DefaultSampleType,
+		})
+	})
+
+	// merges the matching series of a profile type over the window, ?format=<pprof|json|tree>, trees take the
+	// same options as flamegraphs
+	api.GET("/profile", func(c *gin.Context) {
+		format := c.DefaultQuery("format", "pprof")
+		if !slices.Contains([]string{"pprof", "json", "tree"}, format) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid format %q, expected pprof, json or tree", format)})
+			return
+		}
+		p, opts, ok := w.renderedProfile(c)
+		if !ok {
+			return
+		}
+		switch format {
+		case "json":
+			c.JSON(http.StatusOK, query.ToJSON(p))
+		case "tree":
+			renderFlamegraph(c, p, opts)
+		default:
+			b := bytes.NewBuffer([]byte{})
+			if err := p.Write(b); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, "application/octet-stream", b.Bytes())
+		}
+	})
+
+	// the call tree of the merged profile, ?sample_type=<name>&focus=<regex>&ignore=<regex>&hide=<regex>&node_fraction=<0-1>
+	api.GET("/flamegraph", func(c *gin.Context) {
+		p, opts, ok := w.renderedProfile(c)
+		if !ok {
+			return
+		}
+		renderFlamegraph(c, p, opts)
+	})
+
+	// the top functions of the merged profile, with the flamegraph options and ?limit=<n>&sort=<flat|cum>
+	api.GET("/top", func(c *gin.Context) {
+		sortBy, limit, err := topParams(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		p, opts, ok := w.renderedProfile(c)
+		if !ok {
+			return
+		}
+		top, err := opts.Top(p, sortBy, limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, top)
+	})
+}
@@ -0,0 +1,281 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+// shardLocalHeader marks the requests fanned out by another shard, which are only answered from local data
+const shardLocalHeader = "X-Profiling-Shard-Local"
+
+// shardErrorsHeader lists the shards that couldn't be queried, for responses that can't hold them in JSON
+const shardErrorsHeader = "X-Profiling-Shard-Errors"
+
+// Shards are the web servers of every collector replica : list queries are fanned out to the other
+// shards and merged, queries about a single series or target are forwarded to the shard that has it
+type Shards struct {
+	index int
+	// peers are the base urls of every shard, in shard order
+	peers  []string
+	client *http.Client
+}
+
+func NewShards(index int, peers []string) *Shards {
+	ret := &Shards{
+		index: index,
+		client: &http.Client{
+			// redirects are returned as is to the client
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+	for _, peer := range peers {
+		ret.peers = append(ret.peers, strings.TrimSuffix(peer, "/"))
+	}
+	return ret
+}
+
+// SetShards fans queries out to the other shards, it must be called before Start
+func (w *WebServer) SetShards(shards *Shards) {
+	w.shards = shards
+}
+
+// remotes returns the other shards, none for requests fanned out by another shard
+func (w *WebServer) remotes(c *gin.Context) []string {
+	if w.shards == nil || c.GetHeader(shardLocalHeader) != "" {
+		return nil
+	}
+	ret := []string{}
+	for i, peer := range w.shards.peers {
+		if i != w.shards.index {
+			ret = append(ret, peer)
+		}
+	}
+	return ret
+}
+
+type shardResponse struct {
+	peer   string
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+// do sends a request to a shard, uri is the path and query of the request
+func (s *Shards) do(ctx context.Context, peer, method, uri string, header http.Header, body []byte) shardResponse {
+	ret := shardResponse{peer: peer}
+	out, err := http.NewRequestWithContext(ctx, method, peer+uri, bytes.NewReader(body))
+	if err != nil {
+		ret.err = err
+		return ret
+	}
+	out.Header.Set(shardLocalHeader, "true")
+	if contentType := header.Get("Content-Type"); contentType != "" {
+		out.Header.Set("Content-Type", contentType)
+	}
+	resp, err := s.client.Do(out)
+	if err != nil {
+		ret.err = err
+		return ret
+	}
+	defer resp.Body.Close()
+	ret.status = resp.StatusCode
+	ret.header = resp.Header
+	ret.body, ret.err = io.ReadAll(resp.Body)
+	return ret
+}
+
+// requestBody reads the request's body, so that it can be sent to every shard
+func requestBody(c *gin.Context) ([]byte, error) {
+	if c.Request.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// fanOut sends the request to the other shards concurrently, while the local shard answers it. uri overrides
+// the request's path and query, for pages built from an API. The returned function waits for the responses,
+// in shard order
+func (w *WebServer) fanOut(c *gin.Context, uri string) func() []shardResponse {
+	remotes := w.remotes(c)
+	if len(remotes) == 0 {
+		return func() []shardResponse { return nil }
+	}
+	if uri == "" {
+		uri = c.Request.URL.RequestURI()
+	}
+	body, err := requestBody(c)
+	if err != nil {
+		return func() []shardResponse { return []shardResponse{{err: err}} }
+	}
+	ret := make([]shardResponse, len(remotes))
+	var wg sync.WaitGroup
+	for i, peer := range remotes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ret[i] = w.shards.do(c.Request.Context(), peer, c.Request.Method, uri, c.Request.Header, body)
+		}()
+	}
+	return func() []shardResponse {
+		wg.Wait()
+		return ret
+	}
+}
+
+// decodeShards decodes the successful JSON responses of the other shards, the other responses are returned
+// as errors by shard
+func decodeShards[T any](responses []shardResponse) ([]T, map[string]string) {
+	ret := []T{}
+	errs := map[string]string{}
+	for _, resp := range responses {
+		err := resp.err
+		if err == nil && resp.status != http.StatusOK {
+			err = fmt.Errorf("unexpected status %d : %s", resp.status, resp.body)
+		}
+		var value T
+		if err == nil {
+			err = json.Unmarshal(resp.body, &value)
+		}
+		if err != nil {
+			errs[resp.peer] = err.Error()
+			continue
+		}
+		ret = append(ret, value)
+	}
+	return ret, errs
+}
+
+// withShardErrors reports the shards that couldn't be queried, the response holds the results of the others
+func withShardErrors(h gin.H, errs map[string]string) gin.H {
+	if len(errs) > 0 {
+		h["shard_errors"] = errs
+	}
+	return h
+}
+
+// logShardErrors reports the shards that couldn't be queried for a page
+func (w *WebServer) logShardErrors(errs map[string]string) {
+	for peer, err := range errs {
+		w.logger.With("shard", peer, "err", err).Warn("failed to query shard")
+	}
+}
+
+// mergeArtifacts adds the artifacts listed by the other shards, most recent first
+func mergeArtifacts(local []storage.Artifact, remote [][]storage.Artifact) []storage.Artifact {
+	ret := slices.Clone(local)
+	for _, artifacts := range remote {
+		ret = append(ret, artifacts...)
+	}
+	slices.SortStableFunc(ret, func(a, b storage.Artifact) int {
+		return b.End.Compare(a.End)
+	})
+	return ret
+}
+
+// allArtifacts lists the artifacts of a kind stored by every shard, field names the list in the response to uri
+func (w *WebServer) allArtifacts(c *gin.Context, kind, uri, field string) ([]storage.Artifact, map[string]string, error) {
+	wait := w.fanOut(c, uri)
+	local, err := w.artifacts.ListArtifacts(kind)
+	if err != nil {
+		wait()
+		return nil, nil, err
+	}
+	remote, errs := decodeShards[map[string][]storage.Artifact](wait())
+	lists := make([][]storage.Artifact, 0, len(remote))
+	for _, r := range remote {
+		lists = append(lists, r[field])
+	}
+	return mergeArtifacts(local, lists), errs, nil
+}
+
+// bufferedWriter holds back a local response until it is known whether another shard should answer instead
+type bufferedWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedWriter(w gin.ResponseWriter) *bufferedWriter {
+	return &bufferedWriter{
+		ResponseWriter: w,
+		header:         http.Header{},
+		status:         http.StatusOK,
+	}
+}
+
+func (b *bufferedWriter) Header() http.Header         { return b.header }
+func (b *bufferedWriter) WriteHeader(code int)        { b.status = code }
+func (b *bufferedWriter) WriteHeaderNow()             {}
+func (b *bufferedWriter) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedWriter) WriteString(s string) (int, error) {
+	return b.body.WriteString(s)
+}
+func (b *bufferedWriter) Status() int   { return b.status }
+func (b *bufferedWriter) Size() int     { return b.body.Len() }
+func (b *bufferedWriter) Written() bool { return b.body.Len() > 0 }
+func (b *bufferedWriter) Flush()        {}
+
+func writeResponse(w gin.ResponseWriter, status int, header http.Header, body []byte) {
+	for k, v := range header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// shardFallback answers requests about a single series or target from the other shards, when the local
+// handler doesn't find it
+func (w *WebServer) shardFallback(c *gin.Context) {
+	remotes := w.remotes(c)
+	if len(remotes) == 0 {
+		c.Next()
+		return
+	}
+	body, err := requestBody(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	writer := c.Writer
+	local := newBufferedWriter(writer)
+	c.Writer = local
+	c.Next()
+	c.Writer = writer
+	if local.status != http.StatusNotFound {
+		writeResponse(writer, local.status, local.header, local.body.Bytes())
+		return
+	}
+	for _, peer := range remotes {
+		resp := w.shards.do(c.Request.Context(), peer, c.Request.Method, c.Request.URL.RequestURI(), c.Request.Header, body)
+		if resp.err != nil {
+			w.logger.With("shard", peer, "err", resp.err).Warn("failed to query shard")
+			continue
+		}
+		if resp.status != http.StatusNotFound {
+			header := resp.header.Clone()
+			header.Del("Content-Length")
+			writeResponse(writer, resp.status, header, resp.body)
+			return
+		}
+	}
+	writeResponse(writer, local.status, local.header, local.body.Bytes())
+}
@@ -0,0 +1,82 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/monitor"
+)
+
+type TargetLister interface {
+	Targets() []monitor.TargetStatus
+}
+
+// namespace -> name -> targets
+type groupedTargets map[string]map[string][]monitor.TargetStatus
+
+func groupTargets(targets []monitor.TargetStatus) groupedTargets {
+	ret := groupedTargets{}
+	for _, t := range targets {
+		ns, name := t.Labels[labels.NamespaceLabel], t.Labels[labels.NameLabel]
+		if _, ok := ret[ns]; !ok {
+			ret[ns] = map[string][]monitor.TargetStatus{}
+		}
+		ret[ns][name] = append(ret[ns][name], t)
+	}
+	for _, names := range ret {
+		for _, targets := range names {
+			slices.SortFunc(targets, func(a, b monitor.TargetStatus) int {
+				if c := strings.Compare(a.Name, b.Name); c != 0 {
+					return c
+				}
+				return strings.Compare(a.Endpoint, b.Endpoint)
+			})
+		}
+	}
+	return ret
+}
+
+func filterTargets(targets []monitor.TargetStatus, health string) []monitor.TargetStatus {
+	if health == "" {
+		return targets
+	}
+	ret := []monitor.TargetStatus{}
+	for _, t := range targets {
+		if string(t.Health) == health {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+// allTargets lists the targets of every shard, uri is the targets API of the other shards
+func (w *WebServer) allTargets(c *gin.Context, uri string) ([]monitor.TargetStatus, map[string]string) {
+	wait := w.fanOut(c, uri)
+	targets := filterTargets(w.collector.Targets(), c.Query("health"))
+	remote, errs := decodeShards[struct {
+		Targets []monitor.TargetStatus `json:"targets"`
+	}](wait())
+	for _, r := range remote {
+		targets = append(targets, r.Targets...)
+	}
+	return targets, errs
+}
+
+func (w *WebServer) registerTargetRoutes(router *gin.Engine) {
+	// ?health=<up|down|unknown> filters targets by health
+	router.GET("/api/v1/targets", func(c *gin.Context) {
+		targets, errs := w.allTargets(c, "")
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"targets": targets}, errs))
+	})
+
+	router.GET("/ui/targets", func(c *gin.Context) {
+		targets, errs := w.allTargets(c, "/api/v1/targets?"+c.Request.URL.RawQuery)
+		w.logShardErrors(errs)
+		if err := w.templates.ExecuteTemplate(c.Writer, "targets.html.tmpl", groupTargets(targets)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/exectrace"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+)
+
+type TraceCapturer interface {
+	CaptureTrace(ctx context.Context, name string, seconds int) (storage.Artifact, error)
+}
+
+const (
+	defaultTraceSeconds = 5
+	maxTraceSeconds     = 60
+	topGoroutines       = 20
+)
+
+// splitArtifactPath splits `<series key>/<id>` as used in trace URLs
+func splitArtifactPath(p string) (key, id string) {
+	p = strings.Trim(strings.TrimSpace(p), "/")
+	return path.Dir(p), path.Base(p)
+}
+
+func artifactErrStatus(err error) int {
+	if errors.Is(err, storage.ErrArtifactNotFound) || errors.Is(err, collector.ErrTargetNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func traceSeconds(c *gin.Context) (int, error) {
+	raw := c.Query("seconds")
+	if raw == "" {
+		return defaultTraceSeconds, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 || seconds > maxTraceSeconds {
+		return 0, fmt.Errorf("seconds must be between 1 and %d", maxTraceSeconds)
+	}
+	return seconds, nil
+}
+
+func (w *WebServer) captureTrace(c *gin.Context) (storage.Artifact, int, error) {
+	target := c.Query("target")
+	if target == "" {
+		return storage.Artifact{}, http.StatusBadRequest, fmt.Errorf("target is required")
+	}
+	seconds, err := traceSeconds(c)
+	if err != nil {
+		return storage.Artifact{}, http.StatusBadRequest, err
+	}
+	artifact, err := w.collector.CaptureTrace(c.Request.Context(), target, seconds)
+	if err != nil {
+		return storage.Artifact{}, artifactErrStatus(err), err
+	}
+	return artifact, http.StatusOK, nil
+}
+
+type traceView struct {
+	Artifact storage.Artifact
+	Summary  *exectrace.Summary
+	// Error is set when the trace can't be parsed, it can still be downloaded
+	Error string
+}
+
+func (w *WebServer) registerTraceRoutes(router *gin.Engine) {
+	router.GET("/api/v1/traces", func(c *gin.Context) {
+		traces, errs, err := w.allArtifacts(c, exectrace.ArtifactKind, "", "traces")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, withShardErrors(gin.H{"traces": traces}, errs))
+	})
+
+	// captures an execution trace on demand, ?target=<monitor name>&seconds=<duration>
+	router.POST("/api/v1/traces/capture", w.shardFallback, func(c *gin.Context) {
+		artifact, status, err := w.captureTrace(c)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, artifact)
+	})
+
+	// the raw trace, to be opened with `go tool trace`
+	router.GET("/api/v1/traces/download/*path", w.shardFallback, func(c *gin.Context) {
+		key, id := splitArtifactPath(c.Param("path"))
+		filepath, err := w.artifacts.GetArtifact(exectrace.ArtifactKind, key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		filename := strings.ReplaceAll(key, "/", "_") + "_" + id + ".trace"
+		c.FileAttachment(filepath, filename)
+	})
+
+	router.GET("/api/v1/traces/summary/*path", w.shardFallback, func(c *gin.Context) {
+		key, id := splitArtifactPath(c.Param("path"))
+		summary, err := w.traceSummary(key, id)
+		if err != nil {
+			c.JSON(artifactErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	})
+
+	router.GET("/ui/traces", func(c *gin.Context) {
+		traces, errs, err := w.allArtifacts(c, exectrace.ArtifactKind, "/api/v1/traces", "traces")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		w.logShardErrors(errs)
+		if err := w.templates.ExecuteTemplate(c.Writer, "traces.html.tmpl", traces); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	})
+
+	router.POST("/ui/traces/capture", w.shardFallback, func(c *gin.Context) {
+		c.Request.URL.RawQuery = url.Values{
+			"target":  {c.PostForm("target")},
+			"seconds": {c.PostForm("seconds")},
+		}.Encode()
+		artifact, status, err := w.captureTrace(c)
+		if err != nil {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.Redirect(http.StatusSeeOther, path.Join("/ui/traces/view", artifact.Key, artifact.ID))
+	})
+
+	router.GET("/ui/traces/view/*path", w.shardFallback, func(c *gin.Context) {
+		key, id := splitArtifactPath(c.Param("path"))
+		view := traceView{
+			Artifact: storage.Artifact{Kind: exectrace.ArtifactKind, Key: key, ID: id},
+		}
+		summary, err := w.traceSummary(key, id)
+		if errors.Is(err, storage.ErrArtifactNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			view.Error = err.Error()
+		}
+		view.Summary = summary
+		if err := w.templates.ExecuteTemplate(c.Writer, "trace.html.tmpl", view); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+	})
+}
+
+func (w *WebServer) traceSummary(key, id string) (*exectrace.Summary, error) {
+	filepath, err := w.artifacts.GetArtifact(exectrace.ArtifactKind, key, id)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return exectrace.Summarize(f, topGoroutines)
+}
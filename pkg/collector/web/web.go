@@ -6,30 +6,57 @@ import (
 	"log/slog"
 	"net/http"
 	"path"
+	"slices"
 	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rancher-sandbox/profiling/pkg/collector"
+	"github.com/rancher-sandbox/profiling/pkg/collector/cache"
+	"github.com/rancher-sandbox/profiling/pkg/collector/correlation"
+	"github.com/rancher-sandbox/profiling/pkg/collector/metrics"
 	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
 )
 
 type WebServer struct {
-	port    int
-	logger  *slog.Logger
-	store   storage.Store
-	reloadF func() error
+	port      int
+	logger    *slog.Logger
+	store     storage.Store
+	reloadF   func() (*collector.ReloadReport, error)
+	index     *correlation.Index
+	collector Collector
+	artifacts storage.ArtifactStore
 
 	fsDataDir string
+	// other collector replicas, see SetShards
+	shards *Shards
+	// pprof UIs, see SetDriverCache
+	drivers *cache.LRU[*http.ServeMux]
+	// keys of the cached diff UIs
+	diffKeys *diffKeys
 
 	// set in Start
 	static    http.Handler
 	templates *template.Template
 }
 
+// Collector lists the collector's targets and collects from them on demand
+type Collector interface {
+	TargetLister
+	TraceCapturer
+	Capturer
+	GoroutineCapturer
+}
+
+var _ Collector = (*collector.Collector)(nil)
+
 func NewWebServer(
 	logger *slog.Logger,
 	port int,
 	store storage.Store,
-	reloadF func() error,
+	reloadF func() (*collector.ReloadReport, error),
+	index *correlation.Index,
+	c Collector,
+	artifacts storage.ArtifactStore,
 	fsDataDir string,
 ) *WebServer {
 	return &WebServer{
@@ -37,12 +64,52 @@ func NewWebServer(
 		logger:    logger.With("component", "web-server"),
 		store:     store,
 		reloadF:   reloadF,
+		index:     index,
+		collector: c,
+		artifacts: artifacts,
 		fsDataDir: fsDataDir,
+		diffKeys:  newDiffKeys(diffKeyTTL),
 	}
 }
 
 const pprofPrefix = "/pprof/web/"
 
+type seriesList = map[string]map[string]map[string][]string
+
+// allSeries merges the series stored by every shard
+func (w *WebServer) allSeries(c *gin.Context, uri string) (seriesList, map[string]string, error) {
+	wait := w.fanOut(c, uri)
+	nsList, err := w.store.GroupKeys()
+	if err != nil {
+		wait()
+		return nil, nil, err
+	}
+	remote, errs := decodeShards[struct {
+		Series seriesList `json:"series"`
+	}](wait())
+	for _, r := range remote {
+		for ns, names := range r.Series {
+			if _, ok := nsList[ns]; !ok {
+				nsList[ns] = map[string]map[string][]string{}
+			}
+			for name, resources := range names {
+				if _, ok := nsList[ns][name]; !ok {
+					nsList[ns][name] = map[string][]string{}
+				}
+				for resource, keys := range resources {
+					for _, key := range keys {
+						if !slices.Contains(nsList[ns][name][resource], key) {
+							nsList[ns][name][resource] = append(nsList[ns][name][resource], key)
+						}
+					}
+					slices.Sort(nsList[ns][name][resource])
+				}
+			}
+		}
+	}
+	return nsList, errs, nil
+}
+
 func (w *WebServer) Start() error {
 	static, err := static()
 	if err != nil {
@@ -62,12 +129,23 @@ func (w *WebServer) Start() error {
 		w.static.ServeHTTP(c.Writer, c.Request)
 	})
 
+	// namespace -> name -> resource -> stored keys, of every shard
+	router.GET("/api/v1/series", func(c *gin.Context) {
+		nsList, errs, err := w.allSeries(c, "")
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, withShardErrors(gin.H{"series": nsList}, errs))
+	})
+
 	router.GET("/ui/dashboard", func(c *gin.Context) {
-		nsList, err := w.store.GroupKeys()
+		nsList, errs, err := w.allSeries(c, "/api/v1/series")
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
+		w.logShardErrors(errs)
 		if err := templates.ExecuteTemplate(c.Writer, "dashboard.html.tmpl", nsList); err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 		}
@@ -77,16 +155,19 @@ func (w *WebServer) Start() error {
 		c.Redirect(http.StatusTemporaryRedirect, "/ui/dashboard")
 	})
 
+	router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
 	//FIXME: move out to generic http api
 	router.POST("/reload", func(c *gin.Context) {
-		if err := w.reloadF(); err != nil {
+		report, err := w.reloadF()
+		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		c.JSON(200, gin.H{"message": "reloaded"})
+		c.JSON(200, gin.H{"message": "reloaded", "report": report})
 	})
 
-	router.GET(path.Join(pprofPrefix, ":profileType", "*key"), func(c *gin.Context) {
+	router.GET(path.Join(pprofPrefix, ":profileType", "*key"), w.shardFallback, func(c *gin.Context) {
 		logger := w.logger.With("path", c.Request.URL.Path)
 		logger.Debug("received request")
 		profileType := c.Param("profileType")
@@ -114,14 +195,18 @@ func (w *WebServer) Start() error {
 
 		filepaths, err := w.store.Get(profileType, actualKey)
 		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
+			c.JSON(profileErrStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if len(filepaths) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("%s: %s", errSeriesNotFound, path.Join(profileType, actualKey))})
 			return
 		}
 		pprofServer := &PprofWebWrapper{
 			filepath:    filepaths[len(filepaths)-1],
 			profileType: profileType,
 		}
-		mux, err := pprofServer.Driver()
+		mux, err := w.driver(path.Join(profileType, actualKey), pprofServer)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -135,6 +220,15 @@ func (w *WebServer) Start() error {
 		mux.ServeHTTP(c.Writer, c.Request)
 	})
 
+	w.registerCorrelationRoutes(router)
+	w.registerFoldedRoutes(router)
+	w.registerTargetRoutes(router)
+	w.registerTraceRoutes(router)
+	w.registerCaptureRoutes(router)
+	w.registerGoroutineRoutes(router)
+	w.registerQueryRoutes(router)
+	w.registerDiffRoutes(router)
+
 	// temporary function to expose raw profiles for debugging
 	router.GET("/raw/*path", func(c *gin.Context) {
 		c.Request.URL.Path = strings.TrimPrefix(c.Request.URL.Path, "/raw")
@@ -0,0 +1,68 @@
+package web_test
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/correlation"
+	"github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/storage"
+	"github.com/rancher-sandbox/profiling/pkg/collector/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startWebServer serves the store on a free port, setup is called before the server starts. It returns the
+// base URL of the server once it answers
+func startWebServer(t *testing.T, store storage.Store, setup func(w *web.WebServer)) string {
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	w := web.NewWebServer(slog.Default(), port, store, nil, correlation.NewIndex(nil, 0), nil, storage.NewNoopArtifactStore(), t.TempDir())
+	if setup != nil {
+		setup(w)
+	}
+	go w.Start()
+	baseURL := fmt.Sprintf("http://localhost:%d", port)
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(baseURL + "/metrics")
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+	return baseURL
+}
+
+func getStatus(t *testing.T, uri string) int {
+	resp, err := http.Get(uri)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode
+}
+
+func TestInvalidSeriesPaths(t *testing.T) {
+	store := storage.NewLabelBasedFileStore(t.TempDir(), []string{labels.NamespaceLabel, labels.NameLabel}, &storage.PprofMerger{})
+	baseURL := startWebServer(t, store, nil)
+
+	for _, uri := range []string{
+		"/pprof/web/cpu/default/..%2F..%2Fetc/passwd",
+		"/pprof/web/%2e%2e/default/app/app",
+		"/api/v1/folded/cpu/default/..%2F..%2Fetc",
+		"/api/v1/folded/%2e%2e/default/app/app",
+		"/api/v1/correlation/profile/cpu/default/..%2F..%2Fetc?label=a&value=b",
+	} {
+		assert.Equal(t, http.StatusBadRequest, getStatus(t, baseURL+uri), uri)
+	}
+	// valid series without data are still not found
+	assert.Equal(t, http.StatusNotFound, getStatus(t, baseURL+"/api/v1/folded/cpu/default/app/app"))
+}
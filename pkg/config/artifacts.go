@@ -0,0 +1,37 @@
+package config
+
+import "time"
+
+const (
+	DefaultTraceMaxAge       = 24 * time.Hour
+	DefaultTraceMaxPerSeries = 10
+)
+
+// ArtifactsConfig configures the retention of artifacts, data that is stored as is instead of being merged,
+// like execution traces, goroutine dumps and on-demand profiles
+type ArtifactsConfig struct {
+	Trace         *RetentionConfig `json:"trace,omitempty" yaml:"trace,omitempty"`
+	GoroutineDump *RetentionConfig `json:"goroutine_dump,omitempty" yaml:"goroutine_dump,omitempty"`
+	Capture       *RetentionConfig `json:"capture,omitempty" yaml:"capture,omitempty"`
+}
+
+type RetentionConfig struct {
+	// MaxAgeSeconds deletes artifacts older than this
+	MaxAgeSeconds int `json:"max_age_seconds,omitempty" yaml:"max_age_seconds,omitempty"`
+	// MaxPerSeries keeps at most this many of the most recent artifacts for each target
+	MaxPerSeries int `json:"max_per_series,omitempty" yaml:"max_per_series,omitempty"`
+}
+
+func (r *RetentionConfig) MaxAge() time.Duration {
+	if r == nil || r.MaxAgeSeconds <= 0 {
+		return DefaultTraceMaxAge
+	}
+	return time.Duration(r.MaxAgeSeconds) * time.Second
+}
+
+func (r *RetentionConfig) MaxCount() int {
+	if r == nil || r.MaxPerSeries <= 0 {
+		return DefaultTraceMaxPerSeries
+	}
+	return r.MaxPerSeries
+}
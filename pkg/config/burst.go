@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+type BurstSignal string
+
+const (
+	// SignalGoroutines is the number of goroutines, observed from goroutine profiles
+	SignalGoroutines BurstSignal = "goroutines"
+	// SignalHeapInuse is the heap in use in bytes, observed from heap profiles
+	SignalHeapInuse BurstSignal = "heap_inuse_bytes"
+	// SignalMetric is a Prometheus metric served by the target
+	SignalMetric BurstSignal = "metric"
+)
+
+const (
+	DefaultBurstDuration       = 5 * time.Minute
+	DefaultBurstInterval       = 30 * time.Second
+	DefaultBurstSeconds        = 10
+	DefaultBurstCooldown       = 10 * time.Minute
+	DefaultMetricSignalPath    = "/metrics"
+	DefaultMetricSignalRefresh = 30 * time.Second
+)
+
+var DefaultBurstProfiles = []string{"profile", "heap", "mutex"}
+
+// BurstRule switches the targets it selects to burst mode when a signal crosses a threshold or grows too fast
+type BurstRule struct {
+	Name string `json:"name" yaml:"name"`
+	// Selector restricts the rule to the targets that have all of these labels
+	Selector map[string]string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	Signal   BurstSignal       `json:"signal" yaml:"signal"`
+	// Metric is required by the metric signal
+	Metric *MetricSignalConfig `json:"metric,omitempty" yaml:"metric,omitempty"`
+	// Threshold triggers the rule when the signal reaches it
+	Threshold float64 `json:"threshold,omitempty" yaml:"threshold,omitempty"`
+	// GrowthPerMinute triggers the rule when the signal grew at least this much per minute since it was last observed
+	GrowthPerMinute float64 `json:"growth_per_minute,omitempty" yaml:"growth_per_minute,omitempty"`
+	// CooldownSeconds is the time after a burst during which the rule doesn't trigger again for the same target,
+	// defaults to DefaultBurstCooldown
+	CooldownSeconds int `json:"cooldown_seconds,omitempty" yaml:"cooldown_seconds,omitempty"`
+
+	Burst BurstConfig `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// MetricSignalConfig reads a signal from the metrics of the target, the values of the matching series are summed
+type MetricSignalConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Labels restrict the series of the metric
+	Labels map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	// Path of the metrics, relative to the monitor's endpoint. Defaults to DefaultMetricSignalPath
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// RefreshIntervalSeconds is the time between two reads of the metric, defaults to DefaultMetricSignalRefresh
+	RefreshIntervalSeconds int `json:"refresh_interval_seconds,omitempty" yaml:"refresh_interval_seconds,omitempty"`
+}
+
+// BurstConfig describes the captures taken while a target is in burst mode
+type BurstConfig struct {
+	// DurationSeconds bounds the burst mode, defaults to DefaultBurstDuration
+	DurationSeconds int `json:"duration_seconds,omitempty" yaml:"duration_seconds,omitempty"`
+	// IntervalSeconds is the time between two rounds of captures, defaults to DefaultBurstInterval
+	IntervalSeconds int `json:"interval_seconds,omitempty" yaml:"interval_seconds,omitempty"`
+	// Seconds is the duration of each capture, defaults to DefaultBurstSeconds
+	Seconds int `json:"seconds,omitempty" yaml:"seconds,omitempty"`
+	// Profiles captured in each round, defaults to DefaultBurstProfiles
+	Profiles []string `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+}
+
+// ProfileType returns the profile type the signal is observed from, if any
+func (s BurstSignal) ProfileType() string {
+	switch s {
+	case SignalGoroutines:
+		return "goroutine"
+	case SignalHeapInuse:
+		return "heap"
+	}
+	return ""
+}
+
+func (r *BurstRule) Cooldown() time.Duration {
+	if r.CooldownSeconds <= 0 {
+		return DefaultBurstCooldown
+	}
+	return time.Duration(r.CooldownSeconds) * time.Second
+}
+
+func (r *BurstRule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("burst rule name is required")
+	}
+	switch r.Signal {
+	case SignalGoroutines, SignalHeapInuse:
+	case SignalMetric:
+		if r.Metric == nil || r.Metric.Name == "" {
+			return fmt.Errorf("burst rule %s: metric name is required", r.Name)
+		}
+	default:
+		return fmt.Errorf("burst rule %s: unsupported signal %q", r.Name, r.Signal)
+	}
+	if r.Threshold <= 0 && r.GrowthPerMinute <= 0 {
+		return fmt.Errorf("burst rule %s: threshold or growth_per_minute is required", r.Name)
+	}
+	return nil
+}
+
+func (m *MetricSignalConfig) MetricsPath() string {
+	if m.Path == "" {
+		return DefaultMetricSignalPath
+	}
+	return m.Path
+}
+
+func (m *MetricSignalConfig) RefreshInterval() time.Duration {
+	if m.RefreshIntervalSeconds <= 0 {
+		return DefaultMetricSignalRefresh
+	}
+	return time.Duration(m.RefreshIntervalSeconds) * time.Second
+}
+
+func (b *BurstConfig) Duration() time.Duration {
+	if b.DurationSeconds <= 0 {
+		return DefaultBurstDuration
+	}
+	return time.Duration(b.DurationSeconds) * time.Second
+}
+
+func (b *BurstConfig) Interval() time.Duration {
+	if b.IntervalSeconds <= 0 {
+		return DefaultBurstInterval
+	}
+	return time.Duration(b.IntervalSeconds) * time.Second
+}
+
+func (b *BurstConfig) CaptureSeconds() int {
+	if b.Seconds <= 0 {
+		return DefaultBurstSeconds
+	}
+	return b.Seconds
+}
+
+func (b *BurstConfig) ProfileTypes() []string {
+	if len(b.Profiles) == 0 {
+		return DefaultBurstProfiles
+	}
+	return b.Profiles
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultScrapeTimeout is added to the profile duration to get the timeout of a single scrape
+const DefaultScrapeTimeout = 30 * time.Second
+
+// HTTPClientConfig configures how a monitor connects to its endpoint
+type HTTPClientConfig struct {
+	TLS *TLSClientConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// BearerToken and BearerTokenFile are mutually exclusive, the file is re-read for every request
+	BearerToken     string           `json:"bearer_token,omitempty" yaml:"bearer_token,omitempty"`
+	BearerTokenFile string           `json:"bearer_token_file,omitempty" yaml:"bearer_token_file,omitempty"`
+	BasicAuth       *BasicAuthConfig `json:"basic_auth,omitempty" yaml:"basic_auth,omitempty"`
+	ProxyURL        string           `json:"proxy_url,omitempty" yaml:"proxy_url,omitempty"`
+	// TimeoutSeconds bounds a single scrape, on top of the duration of the requested profile
+	TimeoutSeconds int `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"`
+	// KubernetesProxy scrapes the endpoint through the API server instead of connecting to it
+	KubernetesProxy *KubernetesProxyConfig `json:"kubernetes_proxy,omitempty" yaml:"kubernetes_proxy,omitempty"`
+}
+
+const (
+	ProxyResourcePods     = "pods"
+	ProxyResourceServices = "services"
+)
+
+// KubernetesProxyConfig sends scrapes to the `proxy` subresource of a pod or service, authenticated as the
+// collector's service account. The endpoint's scheme and path are kept, its host is only used to identify the target
+type KubernetesProxyConfig struct {
+	// Resource is pods or services, defaults to pods
+	Resource  string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Name      string `json:"name" yaml:"name"`
+	// Port is the name or number of the pod's or service's port
+	Port string `json:"port" yaml:"port"`
+	// Kubeconfig is only required outside of the cluster
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+}
+
+func (k *KubernetesProxyConfig) ProxyResource() string {
+	if k.Resource == "" {
+		return ProxyResourcePods
+	}
+	return k.Resource
+}
+
+// ProxyTarget is the name of the proxied pod or service in the path of the proxy subresource,
+// `[https:]<name>:<port>`. The scheme is only set for https since the API server defaults to http
+func (k *KubernetesProxyConfig) ProxyTarget(scheme string) string {
+	target := k.Name + ":" + k.Port
+	if scheme == "https" {
+		target = "https:" + target
+	}
+	return target
+}
+
+func (k *KubernetesProxyConfig) Validate() error {
+	switch k.ProxyResource() {
+	case ProxyResourcePods, ProxyResourceServices:
+	default:
+		return fmt.Errorf("unsupported proxy resource %s", k.Resource)
+	}
+	if k.Namespace == "" || k.Name == "" || k.Port == "" {
+		return fmt.Errorf("namespace, name and port are required to scrape through the API server")
+	}
+	return nil
+}
+
+type TLSClientConfig struct {
+	CAFile             string `json:"ca_file,omitempty" yaml:"ca_file,omitempty"`
+	CertFile           string `json:"cert_file,omitempty" yaml:"cert_file,omitempty"`
+	KeyFile            string `json:"key_file,omitempty" yaml:"key_file,omitempty"`
+	ServerName         string `json:"server_name,omitempty" yaml:"server_name,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty" yaml:"insecure_skip_verify,omitempty"`
+}
+
+type BasicAuthConfig struct {
+	Username string `json:"username" yaml:"username"`
+	// Password and PasswordFile are mutually exclusive, the file is re-read for every request
+	Password     string `json:"password,omitempty" yaml:"password,omitempty"`
+	PasswordFile string `json:"password_file,omitempty" yaml:"password_file,omitempty"`
+}
+
+func (h *HTTPClientConfig) DeepCopyInto(out *HTTPClientConfig) {
+	*out = *h
+	if h.TLS != nil {
+		tls := *h.TLS
+		out.TLS = &tls
+	}
+	if h.BasicAuth != nil {
+		basicAuth := *h.BasicAuth
+		out.BasicAuth = &basicAuth
+	}
+	if h.KubernetesProxy != nil {
+		proxy := *h.KubernetesProxy
+		out.KubernetesProxy = &proxy
+	}
+}
+
+func (h HTTPClientConfig) Timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return DefaultScrapeTimeout
+}
@@ -0,0 +1,8 @@
+package config
+
+type CorrelationConfig struct {
+	// IndexedLabels are the sample labels indexed for lookups, defaults to trace_id, span_id and span_name
+	IndexedLabels []string `json:"indexed_labels,omitempty" yaml:"indexed_labels,omitempty"`
+	// MaxIndexedValues bounds the number of distinct label values kept in the index
+	MaxIndexedValues int `json:"max_indexed_values,omitempty" yaml:"max_indexed_values,omitempty"`
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultDiscoveryRefreshInterval = 30 * time.Second
+
+const (
+	DNSTypeSRV  = "SRV"
+	DNSTypeA    = "A"
+	DNSTypeAAAA = "AAAA"
+)
+
+// DiscoveryConfig discovers targets outside of Kubernetes, every discovered target is scraped by a monitor
+// built from the Monitor template
+type DiscoveryConfig struct {
+	// Name identifies the discovery, it is the default namespace label of its targets
+	Name string `json:"name" yaml:"name"`
+	// RefreshIntervalSeconds is the time between two discoveries, defaults to DefaultDiscoveryRefreshInterval
+	RefreshIntervalSeconds int `json:"refresh_interval_seconds,omitempty" yaml:"refresh_interval_seconds,omitempty"`
+	// Scheme used to scrape the discovered targets, defaults to http
+	Scheme string `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+
+	Static []TargetGroup `json:"static_configs,omitempty" yaml:"static_configs,omitempty"`
+	// Files are globs of JSON or YAML files, each holding a list of target groups
+	Files      []string                   `json:"files,omitempty" yaml:"files,omitempty"`
+	DNS        *DNSDiscoveryConfig        `json:"dns,omitempty" yaml:"dns,omitempty"`
+	Kubernetes *KubernetesDiscoveryConfig `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
+
+	// Monitor is the template of the discovered targets' monitors, its name and endpoint are set for each target
+	Monitor MonitorConfig `json:"monitor" yaml:"monitor"`
+}
+
+// TargetGroup is a list of host:port targets sharing the same labels
+type TargetGroup struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+type DNSDiscoveryConfig struct {
+	Names []string `json:"names" yaml:"names"`
+	// Type is one of SRV, A or AAAA, defaults to SRV
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+	// Port of the targets, required for A and AAAA records
+	Port int `json:"port,omitempty" yaml:"port,omitempty"`
+}
+
+// KubernetesDiscoveryConfig watches pods that opt in to profiling through annotations
+type KubernetesDiscoveryConfig struct {
+	// Namespaces to watch, defaults to all namespaces
+	Namespaces []string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	// Selector is a label selector restricting the watched pods
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	// Kubeconfig is only required outside of the cluster
+	Kubeconfig string `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`
+}
+
+func (d *DiscoveryConfig) RefreshInterval() time.Duration {
+	if d.RefreshIntervalSeconds <= 0 {
+		return DefaultDiscoveryRefreshInterval
+	}
+	return time.Duration(d.RefreshIntervalSeconds) * time.Second
+}
+
+func (d *DiscoveryConfig) Validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("discovery name is required")
+	}
+	if d.DNS != nil {
+		switch d.DNS.RecordType() {
+		case DNSTypeSRV:
+		case DNSTypeA, DNSTypeAAAA:
+			if d.DNS.Port <= 0 {
+				return fmt.Errorf("discovery %s: port is required for %s records", d.Name, d.DNS.Type)
+			}
+		default:
+			return fmt.Errorf("discovery %s: unsupported DNS record type %s", d.Name, d.DNS.Type)
+		}
+	}
+	return nil
+}
+
+func (d *DNSDiscoveryConfig) RecordType() string {
+	if d.Type == "" {
+		return DNSTypeSRV
+	}
+	return d.Type
+}
@@ -0,0 +1,71 @@
+package config
+
+import "fmt"
+
+const (
+	// DefaultOTLPGRPCPort is the well-known OTLP/gRPC port
+	DefaultOTLPGRPCPort = 4317
+	// DefaultOTLPHTTPPort is the well-known OTLP/HTTP port
+	DefaultOTLPHTTPPort = 4318
+
+	// DefaultIngestMaxMessageSizeBytes mirrors the default receive limit of the otel collector
+	DefaultIngestMaxMessageSizeBytes = 4 * 1024 * 1024
+)
+
+type IngestConfig struct {
+	GRPC IngestListenerConfig `json:"grpc" yaml:"grpc"`
+	HTTP IngestListenerConfig `json:"http" yaml:"http"`
+}
+
+type IngestListenerConfig struct {
+	// Enabled defaults to true when unset
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Addr to listen on, for example `0.0.0.0:4317`.
+	// gRPC listeners also accept a network prefix, for example `tcp4://0.0.0.0:4317`
+	Addr string `json:"addr,omitempty" yaml:"addr,omitempty"`
+	// TLS enables TLS on the listener, and mTLS when a client CA is set
+	TLS *TLSServerConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Auth enables bearer token authentication on the listener
+	Auth *BearerAuthConfig `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// MaxMessageSizeBytes is the maximum size of a single (decompressed) export request
+	MaxMessageSizeBytes int `json:"max_message_size_bytes,omitempty" yaml:"max_message_size_bytes,omitempty"`
+}
+
+type TLSServerConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// ClientCAFile, when set, requires clients to present a certificate signed by this CA
+	ClientCAFile string `json:"client_ca_file,omitempty" yaml:"client_ca_file,omitempty"`
+}
+
+type BearerAuthConfig struct {
+	Token     string `json:"token,omitempty" yaml:"token,omitempty"`
+	TokenFile string `json:"token_file,omitempty" yaml:"token_file,omitempty"`
+}
+
+func (l IngestListenerConfig) IsEnabled() bool {
+	return l.Enabled == nil || *l.Enabled
+}
+
+func (l IngestListenerConfig) MaxMessageSize() int {
+	if l.MaxMessageSizeBytes <= 0 {
+		return DefaultIngestMaxMessageSizeBytes
+	}
+	return l.MaxMessageSizeBytes
+}
+
+// WithDefaults returns a copy of the ingest config with unset listen addresses
+// bound to the OTLP defaults on all interfaces
+func (i *IngestConfig) WithDefaults() IngestConfig {
+	var out IngestConfig
+	if i != nil {
+		out = *i
+	}
+	if out.GRPC.Addr == "" {
+		out.GRPC.Addr = fmt.Sprintf("0.0.0.0:%d", DefaultOTLPGRPCPort)
+	}
+	if out.HTTP.Addr == "" {
+		out.HTTP.Addr = fmt.Sprintf("0.0.0.0:%d", DefaultOTLPHTTPPort)
+	}
+	return out
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// ProfileSpec describes a profile served by an endpoint, in addition to the built-in pprof profiles
+type ProfileSpec struct {
+	// Name is the profile type the profile is stored under
+	Name string `json:"name" yaml:"name"`
+	// Path of the profile, relative to the monitor's endpoint. Defaults to `/debug/pprof/<name>`
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Params are added to the query of every request
+	Params map[string]string `json:"params,omitempty" yaml:"params,omitempty"`
+	// Cumulative profiles report totals since the process started, like pprof's allocs, block and mutex profiles
+	// without `seconds`. They are stored as the difference between consecutive scrapes.
+	// Other profiles are treated as gauges and stored as scraped.
+	Cumulative bool `json:"cumulative,omitempty" yaml:"cumulative,omitempty"`
+	// Exclusive profiles can't be collected concurrently from the same endpoint, like CPU profiles
+	Exclusive bool `json:"exclusive,omitempty" yaml:"exclusive,omitempty"`
+
+	SamplerConfig `json:",inline" yaml:",inline"`
+}
+
+func (p *ProfileSpec) ProfilePath() string {
+	if p.Path == "" {
+		return "/debug/pprof/" + p.Name
+	}
+	if !strings.HasPrefix(p.Path, "/") {
+		return "/" + p.Path
+	}
+	return p.Path
+}
+
+func (p *ProfileSpec) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if strings.ContainsAny(p.Name, `/\`) || strings.HasPrefix(p.Name, ".") {
+		return fmt.Errorf("invalid profile name %q", p.Name)
+	}
+	return nil
+}
+
+func (p *ProfileSpec) DeepCopyInto(out *ProfileSpec) {
+	*out = *p
+	out.Params = maps.Clone(p.Params)
+}
@@ -0,0 +1,49 @@
+package config
+
+type RelabelAction string
+
+const (
+	RelabelReplace   RelabelAction = "replace"
+	RelabelKeep      RelabelAction = "keep"
+	RelabelDrop      RelabelAction = "drop"
+	RelabelLabelMap  RelabelAction = "labelmap"
+	RelabelLabelDrop RelabelAction = "labeldrop"
+	RelabelLabelKeep RelabelAction = "labelkeep"
+	RelabelHashMod   RelabelAction = "hashmod"
+)
+
+const (
+	DefaultRelabelSeparator   = ";"
+	DefaultRelabelRegex       = "(.*)"
+	DefaultRelabelReplacement = "$1"
+)
+
+// RelabelConfig rewrites the labels of a target before it is scraped, following Prometheus' relabel_config
+type RelabelConfig struct {
+	// SourceLabels are joined with Separator and matched against Regex
+	SourceLabels []string `json:"source_labels,omitempty" yaml:"source_labels,omitempty"`
+	// Separator defaults to DefaultRelabelSeparator
+	Separator string `json:"separator,omitempty" yaml:"separator,omitempty"`
+	// Regex is anchored on both ends, defaults to DefaultRelabelRegex
+	Regex string `json:"regex,omitempty" yaml:"regex,omitempty"`
+	// Modulus of the hash of the source labels, for hashmod
+	Modulus uint64 `json:"modulus,omitempty" yaml:"modulus,omitempty"`
+	// TargetLabel is the label written by replace and hashmod
+	TargetLabel string `json:"target_label,omitempty" yaml:"target_label,omitempty"`
+	// Replacement may reference regex capture groups, defaults to DefaultRelabelReplacement
+	Replacement *string `json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	// Action defaults to replace
+	Action RelabelAction `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+func (r *RelabelConfig) DeepCopyInto(out *RelabelConfig) {
+	*out = *r
+	if r.SourceLabels != nil {
+		out.SourceLabels = make([]string, len(r.SourceLabels))
+		copy(out.SourceLabels, r.SourceLabels)
+	}
+	if r.Replacement != nil {
+		replacement := *r.Replacement
+		out.Replacement = &replacement
+	}
+}
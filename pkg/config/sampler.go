@@ -1,7 +1,17 @@
 package config
 
+import (
+	"maps"
+	"time"
+)
+
 type CollectorConfig struct {
 	SelfTelemetry *SelfTelemetryConfig `json:"self_telemetry" yaml:"self_telemetry"`
+	Ingest        *IngestConfig        `json:"ingest,omitempty" yaml:"ingest,omitempty"`
+	Correlation   *CorrelationConfig   `json:"correlation,omitempty" yaml:"correlation,omitempty"`
+	Artifacts     *ArtifactsConfig     `json:"artifacts,omitempty" yaml:"artifacts,omitempty"`
+	Discovery     []*DiscoveryConfig   `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+	BurstRules    []*BurstRule         `json:"burst_rules,omitempty" yaml:"burst_rules,omitempty"`
 
 	Monitors []*MonitorConfig `json:"monitors" yaml:"monitors"`
 }
@@ -11,8 +21,26 @@ type SelfTelemetryConfig struct {
 	IntervalSeconds int `json:"interval_seconds" yaml:"interval_seconds"`
 }
 
+// DefaultScrapeInterval is used for profiles without a duration, when no interval is configured
+const DefaultScrapeInterval = time.Minute
+
 type SamplerConfig struct {
+	// Seconds is the duration of the profile, only used by profile types that support it
 	Seconds int `json:"seconds" yaml:"seconds"`
+	// IntervalSeconds is the time between two scrapes, independent of the profile duration.
+	// Defaults to Seconds when set, so that duration profiles are collected back to back,
+	// otherwise to DefaultScrapeInterval
+	IntervalSeconds int `json:"interval_seconds,omitempty" yaml:"interval_seconds,omitempty"`
+}
+
+func (s *SamplerConfig) Interval() time.Duration {
+	if s.IntervalSeconds > 0 {
+		return time.Duration(s.IntervalSeconds) * time.Second
+	}
+	if s.Seconds > 0 {
+		return time.Duration(s.Seconds) * time.Second
+	}
+	return DefaultScrapeInterval
 }
 
 type MonitorConfig struct {
@@ -21,6 +49,66 @@ type MonitorConfig struct {
 	Endpoint       string               `json:"endpoint" yaml:"endpoint"`
 	Labels         map[string]string    `json:"labels" yaml:"labels"`
 	GlobalSampling GlobalSamplingConfig `json:"sampling" yaml:"sampling"`
+	// Profiles are collected in addition to the profiles enabled in GlobalSampling
+	Profiles   []ProfileSpec    `json:"profiles,omitempty" yaml:"profiles,omitempty"`
+	Backoff    *BackoffConfig   `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	HTTPClient HTTPClientConfig `json:"http_client,omitempty" yaml:"http_client,omitempty"`
+	// Relabelings are applied to the monitor's labels before scraping, see the relabel package for the target metadata labels
+	Relabelings []RelabelConfig `json:"relabel_configs,omitempty" yaml:"relabel_configs,omitempty"`
+	// MaxResponseBytes rejects scraped profiles larger than this, defaults to DefaultMaxResponseBytes
+	MaxResponseBytes int64 `json:"max_response_bytes,omitempty" yaml:"max_response_bytes,omitempty"`
+}
+
+const DefaultMaxResponseBytes = 64 * 1024 * 1024
+
+func (m *MonitorConfig) MaxResponseSize() int64 {
+	if m.MaxResponseBytes <= 0 {
+		return DefaultMaxResponseBytes
+	}
+	return m.MaxResponseBytes
+}
+
+func (m *MonitorConfig) DeepCopyInto(out *MonitorConfig) {
+	*out = *m
+	out.Labels = maps.Clone(m.Labels)
+	m.GlobalSampling.DeepCopyInto(&out.GlobalSampling)
+	if m.Profiles != nil {
+		out.Profiles = make([]ProfileSpec, len(m.Profiles))
+		for i := range m.Profiles {
+			m.Profiles[i].DeepCopyInto(&out.Profiles[i])
+		}
+	}
+	if m.Backoff != nil {
+		backoff := *m.Backoff
+		out.Backoff = &backoff
+	}
+	m.HTTPClient.DeepCopyInto(&out.HTTPClient)
+	if m.Relabelings != nil {
+		out.Relabelings = make([]RelabelConfig, len(m.Relabelings))
+		for i := range m.Relabelings {
+			m.Relabelings[i].DeepCopyInto(&out.Relabelings[i])
+		}
+	}
+}
+
+func (m *MonitorConfig) DeepCopy() *MonitorConfig {
+	if m == nil {
+		return nil
+	}
+	out := &MonitorConfig{}
+	m.DeepCopyInto(out)
+	return out
+}
+
+const (
+	DefaultBackoffInitial = 5 * time.Second
+	DefaultBackoffMax     = 5 * time.Minute
+)
+
+// BackoffConfig configures the exponential backoff applied to a failing target
+type BackoffConfig struct {
+	InitialSeconds int `json:"initial_seconds,omitempty" yaml:"initial_seconds,omitempty"`
+	MaxSeconds     int `json:"max_seconds,omitempty" yaml:"max_seconds,omitempty"`
 }
 
 type GlobalSamplingConfig struct {
@@ -32,6 +120,8 @@ type GlobalSamplingConfig struct {
 	Profile      *SamplerConfig `json:"profile" yaml:"profile"`
 	ThreadCreate *SamplerConfig `json:"threadcreate" yaml:"threadcreate"`
 	Trace        *SamplerConfig `json:"trace" yaml:"trace"`
+	// GoroutineDump collects `goroutine?debug=2` text dumps, which keep goroutine states and wait durations
+	GoroutineDump *SamplerConfig `json:"goroutine_dump,omitempty" yaml:"goroutine_dump,omitempty"`
 	// TODO : unused fields
 	Compression string
 }
@@ -71,4 +161,35 @@ func (g *GlobalSamplingConfig) DeepCopyInto(out *GlobalSamplingConfig) {
 		trace := *g.Trace
 		out.Trace = &trace
 	}
+	if g.GoroutineDump != nil {
+		goroutineDump := *g.GoroutineDump
+		out.GoroutineDump = &goroutineDump
+	}
+}
+
+// SetSampler enables the built-in profile type name, it returns false for other profile types
+func (g *GlobalSamplingConfig) SetSampler(name string, s *SamplerConfig) bool {
+	switch name {
+	case "allocs":
+		g.Allocs = s
+	case "block":
+		g.Block = s
+	case "goroutine":
+		g.Goroutine = s
+	case "heap":
+		g.Heap = s
+	case "mutex":
+		g.Mutex = s
+	case "profile":
+		g.Profile = s
+	case "threadcreate":
+		g.ThreadCreate = s
+	case "trace":
+		g.Trace = s
+	case "goroutine_dump":
+		g.GoroutineDump = s
+	default:
+		return false
+	}
+	return true
 }
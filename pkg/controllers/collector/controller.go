@@ -4,6 +4,7 @@ package collector
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
@@ -15,6 +16,9 @@ import (
 	"github.com/rancher/wrangler/v3/pkg/relatedresource"
 
 	"github.com/sirupsen/logrus"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 type CollectorHandler struct {
@@ -36,9 +40,17 @@ func (h *CollectorHandler) OnChange(key string, stack *v1alpha1.PprofCollectorSt
 	if err := applier.ApplyObjects(objs...); err != nil {
 		logrus.Errorf("Failed to apply objects: %v", err)
 	}
+	h.applyClusterObjects(stack)
 	return stack, nil
 }
 
+func (h *CollectorHandler) applyClusterObjects(stack *v1alpha1.PprofCollectorStack) {
+	applier := h.Apply.WithSetID(fmt.Sprintf("pprof-controller-collector-%s-cluster", h.OperatorOptions.OperatorName))
+	if err := applier.ApplyObjects(h.ClusterObjects(stack)...); err != nil {
+		logrus.Errorf("Failed to apply cluster objects: %v", err)
+	}
+}
+
 func (h *CollectorHandler) OnRemove(key string, stack *v1alpha1.PprofCollectorStack) (*v1alpha1.PprofCollectorStack, error) {
 	// apply objects
 	logrus.Warn("on remove", key)
@@ -50,9 +62,43 @@ func (h *CollectorHandler) OnRemove(key string, stack *v1alpha1.PprofCollectorSt
 	if err := applier.ApplyObjects(objs...); err != nil {
 		logrus.Errorf("Failed to apply objects: %v", err)
 	}
+	h.applyClusterObjects(nil)
 	return stack, nil
 }
 
+// reconcileStatefulSet replaces the collector's StatefulSet when switching between a single collector and
+// shards, or when resizing the volumes of the shards, which change its immutable fields. The replaced
+// StatefulSet is created again once its deletion is observed, the volumes of its pods are kept
+func reconcileStatefulSet(oldObj, newObj runtime.Object) (bool, error) {
+	oldSS, err := toStatefulSet(oldObj)
+	if err != nil {
+		return false, err
+	}
+	newSS, err := toStatefulSet(newObj)
+	if err != nil {
+		return false, err
+	}
+	if oldSS.Spec.ServiceName != newSS.Spec.ServiceName ||
+		!equality.Semantic.DeepEqual(oldSS.Spec.Selector, newSS.Spec.Selector) ||
+		!equality.Semantic.DeepEqual(oldSS.Spec.VolumeClaimTemplates, newSS.Spec.VolumeClaimTemplates) {
+		return false, apply.ErrReplace
+	}
+	return false, nil
+}
+
+// toStatefulSet converts the objects handed to reconcilers, which can be unstructured
+func toStatefulSet(obj runtime.Object) (*appsv1.StatefulSet, error) {
+	if ss, ok := obj.(*appsv1.StatefulSet); ok {
+		return ss, nil
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	ss := &appsv1.StatefulSet{}
+	return ss, json.Unmarshal(data, ss)
+}
+
 // deploys collector stack
 func Register(
 	ctx context.Context,
@@ -63,11 +109,15 @@ func Register(
 	applier apply.Apply,
 ) {
 
-	applier = applier.WithSetOwnerReference(true, false).WithCacheTypes(
+	applier = applier.WithSetOwnerReference(true, false).WithReconciler(
+		appsv1.SchemeGroupVersion.WithKind("StatefulSet"),
+		reconcileStatefulSet,
+	).WithCacheTypes(
 		apps.V1().StatefulSet(),
 		core.V1().ConfigMap(),
 		core.V1().Service(),
 		core.V1().PersistentVolumeClaim(),
+		core.V1().ServiceAccount(),
 	)
 	handler := &CollectorHandler{
 		OperatorOptions: operatorOpts,
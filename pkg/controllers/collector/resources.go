@@ -2,12 +2,15 @@ package collector
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
 	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
 	"github.com/samber/lo"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -23,6 +26,14 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse disk space quantity: %v", err)
 	}
+	artifactSpace := stack.Spec.Storage.ArtifactDiskSpace
+	if artifactSpace == "" {
+		artifactSpace = defaultArtifactDiskSpace
+	}
+	artifactSpaceQ, err := resource.ParseQuantity(artifactSpace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse artifact disk space quantity: %v", err)
+	}
 	collectorImage, err := stack.Spec.CollectorImage.ImageStr()
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse collector image: %v", err)
@@ -49,27 +60,21 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 					TargetPort: intstr.FromString("web"),
 					Port:       8989,
 				},
-			},
-		},
-	}
-	mode := corev1.PersistentVolumeFilesystem
-	pvc := &corev1.PersistentVolumeClaim{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      common.NamespacedCollectorName(h.OperatorOptions) + "-data",
-			Namespace: h.OperatorOptions.ControllerNamespace,
-		},
-		Spec: corev1.PersistentVolumeClaimSpec{
-			AccessModes: []corev1.PersistentVolumeAccessMode{
-				corev1.ReadWriteOnce,
-			},
-			Resources: corev1.VolumeResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: spaceQ,
+				{
+					Name:       "otlp-grpc",
+					TargetPort: intstr.FromString("otlp-grpc"),
+					Port:       config.DefaultOTLPGRPCPort,
+				},
+				{
+					Name:       "otlp-http",
+					TargetPort: intstr.FromString("otlp-http"),
+					Port:       config.DefaultOTLPHTTPPort,
 				},
 			},
-			VolumeMode: &mode,
 		},
 	}
+	pvc := h.volumeClaim(common.NamespacedCollectorName(h.OperatorOptions)+"-data", spaceQ)
+	artifactsPVC := h.volumeClaim(common.NamespacedCollectorName(h.OperatorOptions)+"-artifacts", artifactSpaceQ)
 
 	ss := &appsv1.StatefulSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -112,6 +117,15 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 								},
 							},
 						},
+						{
+							Name: "pprof-collector-assets",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: common.NamespacedAssetsName(h.OperatorOptions),
+									Optional:   lo.ToPtr(true),
+								},
+							},
+						},
 						{
 							Name: "pprof-collector-data",
 							VolumeSource: corev1.VolumeSource{
@@ -120,6 +134,14 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 								},
 							},
 						},
+						{
+							Name: "pprof-collector-artifacts",
+							VolumeSource: corev1.VolumeSource{
+								PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+									ClaimName: common.NamespacedCollectorName(h.OperatorOptions) + "-artifacts",
+								},
+							},
+						},
 					},
 					Containers: []corev1.Container{
 						{
@@ -135,6 +157,14 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 									ContainerPort: 8989,
 									HostPort:      8989,
 								},
+								{
+									Name:          "otlp-grpc",
+									ContainerPort: config.DefaultOTLPGRPCPort,
+								},
+								{
+									Name:          "otlp-http",
+									ContainerPort: config.DefaultOTLPHTTPPort,
+								},
 							},
 							Args: []string{
 								"--config",
@@ -143,6 +173,10 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 								"info",
 								"--data-dir",
 								"/var/collector/data",
+								// artifacts must not be stored under the profile data dir, which is the root
+								// of the data volume, they get their own volume
+								"--artifact-dir",
+								"/var/collector/artifacts",
 								"--web-port",
 								"8989",
 							},
@@ -157,6 +191,16 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 									ReadOnly:  false,
 									MountPath: "/var/collector/data",
 								},
+								{
+									Name:      "pprof-collector-artifacts",
+									ReadOnly:  false,
+									MountPath: "/var/collector/artifacts",
+								},
+								{
+									Name:      "pprof-collector-assets",
+									ReadOnly:  true,
+									MountPath: common.AssetsMountPath,
+								},
 							},
 						},
 						{
@@ -181,5 +225,165 @@ func (h *CollectorHandler) Objects(stack *v1alpha1.PprofCollectorStack) ([]runti
 			},
 		},
 	}
-	return []runtime.Object{service, pvc, ss}, nil
+	// the collector runs as its own service account, granted access to pods for pod discovery and to the
+	// proxy subresources of the targets scraped through the API server
+	sa := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      common.NamespacedCollectorName(h.OperatorOptions),
+			Namespace: h.OperatorOptions.ControllerNamespace,
+		},
+	}
+	ss.Spec.Template.Spec.ServiceAccountName = common.NamespacedCollectorName(h.OperatorOptions)
+	if stack.Spec.Shards <= 1 {
+		return []runtime.Object{service, pvc, artifactsPVC, ss, sa}, nil
+	}
+	headless := h.shard(stack, ss, pvc, artifactsPVC)
+	// the volumes of the single collector are kept when sharding, for their data to be served again when
+	// switching back to a single collector
+	return []runtime.Object{service, pvc, artifactsPVC, headless, ss, sa}, nil
+}
+
+// defaultArtifactDiskSpace is the size of the artifacts volume, when the stack doesn't request one
+const defaultArtifactDiskSpace = "1Gi"
+
+func (h *CollectorHandler) volumeClaim(name string, space resource.Quantity) *corev1.PersistentVolumeClaim {
+	mode := corev1.PersistentVolumeFilesystem
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: h.OperatorOptions.ControllerNamespace,
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{
+				corev1.ReadWriteOnce,
+			},
+			Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceStorage: space,
+				},
+			},
+			VolumeMode: &mode,
+		},
+	}
+}
+
+func (h *CollectorHandler) headlessServiceName() string {
+	return common.NamespacedCollectorName(h.OperatorOptions) + "-headless"
+}
+
+// shardPeers are the stable addresses of the web servers of every replica, through the headless service
+func (h *CollectorHandler) shardPeers(shards int32) []string {
+	ret := make([]string, 0, shards)
+	for i := range shards {
+		ret = append(ret, fmt.Sprintf(
+			"http://%s-%d.%s.%s.svc:8989",
+			common.NamespacedCollectorName(h.OperatorOptions),
+			i,
+			h.headlessServiceName(),
+			h.OperatorOptions.ControllerNamespace,
+		))
+	}
+	return ret
+}
+
+// shard scales the collector to one replica per shard, each replica reads its shard index from the ordinal of
+// its hostname and gets its own copy of the data and artifacts volumes. It returns the headless service giving the replicas stable addresses
+func (h *CollectorHandler) shard(
+	stack *v1alpha1.PprofCollectorStack,
+	ss *appsv1.StatefulSet,
+	pvc *corev1.PersistentVolumeClaim,
+	artifactsPVC *corev1.PersistentVolumeClaim,
+) *corev1.Service {
+	headless := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      h.headlessServiceName(),
+			Namespace: h.OperatorOptions.ControllerNamespace,
+		},
+		Spec: corev1.ServiceSpec{
+			ClusterIP: corev1.ClusterIPNone,
+			Selector:  ss.Spec.Selector.MatchLabels,
+			// peers must be reachable while they start, to answer the queries of the ready replicas
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "web",
+					TargetPort: intstr.FromString("web"),
+					Port:       8989,
+				},
+			},
+		},
+	}
+	ss.Spec.Replicas = lo.ToPtr(stack.Spec.Shards)
+	ss.Spec.ServiceName = h.headlessServiceName()
+
+	volumes := map[string]*corev1.PersistentVolumeClaim{
+		"pprof-collector-data":      pvc,
+		"pprof-collector-artifacts": artifactsPVC,
+	}
+	for _, name := range []string{"pprof-collector-data", "pprof-collector-artifacts"} {
+		template := volumes[name].DeepCopy()
+		template.ObjectMeta = metav1.ObjectMeta{Name: name}
+		ss.Spec.VolumeClaimTemplates = append(ss.Spec.VolumeClaimTemplates, *template)
+	}
+	ss.Spec.Template.Spec.Volumes = lo.Reject(ss.Spec.Template.Spec.Volumes, func(v corev1.Volume, _ int) bool {
+		_, ok := volumes[v.Name]
+		return ok
+	})
+
+	collector := &ss.Spec.Template.Spec.Containers[0]
+	for i := range collector.Ports {
+		// replicas can be scheduled on the same node
+		collector.Ports[i].HostPort = 0
+	}
+	collector.Args = append(collector.Args,
+		"--shard-index-from-hostname",
+		"--shard-count",
+		fmt.Sprint(stack.Spec.Shards),
+		"--shard-peers",
+		strings.Join(h.shardPeers(stack.Spec.Shards), ","),
+	)
+	return headless
+}
+
+// clusterRoleName is unique per operator namespace, since cluster roles aren't namespaced
+func (h *CollectorHandler) clusterRoleName() string {
+	return fmt.Sprintf("%s-%s", h.OperatorOptions.ControllerNamespace, common.NamespacedCollectorName(h.OperatorOptions))
+}
+
+// ClusterObjects grants the collector read access to pods, when pod discovery is enabled.
+// Cluster scoped objects can't be owned by the stack, they are tracked by their apply set instead
+func (h *CollectorHandler) ClusterObjects(stack *v1alpha1.PprofCollectorStack) []runtime.Object {
+	if stack == nil || stack.Spec.PodDiscovery == nil {
+		return []runtime.Object{}
+	}
+	role := &rbacv1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: h.clusterRoleName(),
+		},
+		Rules: []rbacv1.PolicyRule{
+			{
+				APIGroups: []string{""},
+				Resources: []string{"pods"},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		},
+	}
+	binding := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: h.clusterRoleName(),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     h.clusterRoleName(),
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      common.NamespacedCollectorName(h.OperatorOptions),
+				Namespace: h.OperatorOptions.ControllerNamespace,
+			},
+		},
+	}
+	return []runtime.Object{role, binding}
 }
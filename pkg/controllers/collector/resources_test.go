@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+	"github.com/rancher/wrangler/v3/pkg/apply"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func testStack(shards int32) *v1alpha1.PprofCollectorStack {
+	return &v1alpha1.PprofCollectorStack{
+		Spec: v1alpha1.CollectorSpec{
+			CollectorImage: v1alpha1.GenericImage{Image: "collector"},
+			ReloaderImage:  v1alpha1.GenericImage{Image: "configmap-reload"},
+			Storage:        v1alpha1.GenericStorage{DiskSpace: "1Gi"},
+			Shards:         shards,
+		},
+	}
+}
+
+func statefulSet(t *testing.T, objs []runtime.Object) *appsv1.StatefulSet {
+	for _, obj := range objs {
+		if ss, ok := obj.(*appsv1.StatefulSet); ok {
+			return ss
+		}
+	}
+	require.FailNow(t, "no statefulset")
+	return nil
+}
+
+func TestShardedObjects(t *testing.T) {
+	h := &CollectorHandler{OperatorOptions: common.OperatorOptions{OperatorName: "pprof", ControllerNamespace: "cattle-profiling"}}
+	single, err := h.Objects(testStack(0))
+	require.NoError(t, err)
+	sharded, err := h.Objects(testStack(3))
+	require.NoError(t, err)
+	resharded, err := h.Objects(testStack(4))
+	require.NoError(t, err)
+
+	// the volumes of the single collector stay in the apply set, so that they aren't pruned
+	claims := func(objs []runtime.Object) []string {
+		ret := []string{}
+		for _, obj := range objs {
+			if pvc, ok := obj.(*corev1.PersistentVolumeClaim); ok {
+				ret = append(ret, pvc.Name)
+			}
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"pprof-collector-data", "pprof-collector-artifacts"}, claims(single))
+	assert.Equal(t, claims(single), claims(sharded))
+
+	ss := statefulSet(t, sharded)
+	assert.Equal(t, int32(3), *ss.Spec.Replicas)
+	assert.Contains(t, ss.Spec.Template.Spec.Containers[0].Args, "--shard-index-from-hostname")
+	require.Len(t, ss.Spec.VolumeClaimTemplates, 2)
+	assert.Equal(t, "pprof-collector-artifacts", ss.Spec.VolumeClaimTemplates[1].Name)
+	assert.Equal(t, "1Gi", ss.Spec.VolumeClaimTemplates[1].Spec.Resources.Requests.Storage().String())
+
+	replace := func(old, new []runtime.Object) error {
+		_, err := reconcileStatefulSet(statefulSet(t, old), statefulSet(t, new))
+		return err
+	}
+	assert.ErrorIs(t, replace(single, sharded), apply.ErrReplace)
+	assert.ErrorIs(t, replace(sharded, single), apply.ErrReplace)
+	assert.NoError(t, replace(sharded, resharded))
+	assert.NoError(t, replace(single, single))
+}
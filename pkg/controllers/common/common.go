@@ -18,3 +18,10 @@ func NamespacedConfigName(opts OperatorOptions) string {
 func NamespacedCollectorName(opts OperatorOptions) string {
 	return fmt.Sprintf("%s-collector", opts.OperatorName)
 }
+
+// AssetsMountPath is where the collector mounts the secrets referenced by monitors
+const AssetsMountPath = "/etc/collector/assets"
+
+func NamespacedAssetsName(opts OperatorOptions) string {
+	return fmt.Sprintf("%s-assets", opts.OperatorName)
+}
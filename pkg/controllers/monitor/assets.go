@@ -0,0 +1,95 @@
+package monitor
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// assets holds the secret data referenced by monitors, keyed by file name in the collector's assets volume
+type assets map[string][]byte
+
+// add copies the selected secret key into the assets and returns the path it is mounted at in the collector
+func (h *PprofHandler) addAsset(a assets, namespace string, sel *corev1.SecretKeySelector) (string, error) {
+	secret, err := h.secretCache.Get(namespace, sel.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, sel.Name, err)
+	}
+	data, ok := secret.Data[sel.Key]
+	if !ok {
+		return "", fmt.Errorf("key %s not found in secret %s/%s", sel.Key, namespace, sel.Name)
+	}
+	name := fmt.Sprintf("%s_%s_%s", namespace, sel.Name, sel.Key)
+	a[name] = data
+	return path.Join(common.AssetsMountPath, name), nil
+}
+
+// httpClientConfig translates the endpoint's settings to the collector config, resolving secret references into assets
+func (h *PprofHandler) httpClientConfig(a assets, mon *v1alpha1.PprofMonitor) (config.HTTPClientConfig, error) {
+	endp := mon.Spec.Endpoint
+	ret := config.HTTPClientConfig{
+		ProxyURL:       endp.ProxyURL,
+		TimeoutSeconds: endp.TimeoutSeconds,
+	}
+	if endp.Transport != "" && endp.Transport != v1alpha1.TransportDirect &&
+		(endp.TLSConfig != nil || endp.BearerTokenSecret != nil || endp.BasicAuth != nil || endp.ProxyURL != "") {
+		return ret, fmt.Errorf("transport %s authenticates to the API server, it can't be combined with tlsConfig, bearerTokenSecret, basicAuth or proxyUrl", endp.Transport)
+	}
+	if endp.BearerTokenSecret != nil && endp.BasicAuth != nil {
+		return ret, fmt.Errorf("bearerTokenSecret and basicAuth are mutually exclusive")
+	}
+	if endp.BearerTokenSecret != nil {
+		tokenFile, err := h.addAsset(a, mon.Namespace, endp.BearerTokenSecret)
+		if err != nil {
+			return ret, err
+		}
+		ret.BearerTokenFile = tokenFile
+	}
+	if endp.BasicAuth != nil {
+		secret, err := h.secretCache.Get(mon.Namespace, endp.BasicAuth.Username.Name)
+		if err != nil {
+			return ret, fmt.Errorf("failed to get secret %s/%s: %w", mon.Namespace, endp.BasicAuth.Username.Name, err)
+		}
+		username, ok := secret.Data[endp.BasicAuth.Username.Key]
+		if !ok {
+			return ret, fmt.Errorf("key %s not found in secret %s/%s", endp.BasicAuth.Username.Key, mon.Namespace, secret.Name)
+		}
+		passwordFile, err := h.addAsset(a, mon.Namespace, &endp.BasicAuth.Password)
+		if err != nil {
+			return ret, err
+		}
+		ret.BasicAuth = &config.BasicAuthConfig{
+			Username:     string(username),
+			PasswordFile: passwordFile,
+		}
+	}
+	if endp.TLSConfig != nil {
+		tlsCfg := &config.TLSClientConfig{
+			ServerName:         endp.TLSConfig.ServerName,
+			InsecureSkipVerify: endp.TLSConfig.InsecureSkipVerify,
+		}
+		for _, ref := range []struct {
+			sel  *corev1.SecretKeySelector
+			dest *string
+		}{
+			{endp.TLSConfig.CA, &tlsCfg.CAFile},
+			{endp.TLSConfig.Cert, &tlsCfg.CertFile},
+			{endp.TLSConfig.KeySecret, &tlsCfg.KeyFile},
+		} {
+			if ref.sel == nil {
+				continue
+			}
+			file, err := h.addAsset(a, mon.Namespace, ref.sel)
+			if err != nil {
+				return ret, err
+			}
+			*ref.dest = file
+		}
+		ret.TLS = tlsCfg
+	}
+	return ret, nil
+}
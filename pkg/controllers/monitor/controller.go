@@ -3,10 +3,11 @@ package monitor
 import (
 	"context"
 	"fmt"
+	"maps"
 	"slices"
+	"strconv"
 	"strings"
 
-	collabels "github.com/rancher-sandbox/profiling/pkg/collector/labels"
 	"github.com/rancher-sandbox/profiling/pkg/config"
 	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
 	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
@@ -36,6 +37,7 @@ func Register(
 ) {
 	applier := apply.WithSetOwnerReference(true, false).WithCacheTypes(
 		core.V1().ConfigMap(),
+		core.V1().Secret(),
 	)
 
 	h := &PprofHandler{
@@ -48,7 +50,9 @@ func Register(
 		serviceCache:   core.V1().Service().Cache(),
 		namespaceCache: core.V1().Namespace().Cache(),
 		endpointCache:  core.V1().Endpoints().Cache(),
+		secretCache:    core.V1().Secret().Cache(),
 		monitorCache:   pprofFactory.Resources().V1alpha1().PprofMonitor().Cache(),
+		stackCache:     pprofFactory.Resources().V1alpha1().PprofCollectorStack().Cache(),
 		apply:          applier,
 	}
 
@@ -66,9 +70,19 @@ func Register(
 		"pprof-watch",
 		resolver,
 		h.pprofFactory.Resources().V1alpha1().PprofMonitor(),
+		h.pprofFactory.Resources().V1alpha1().PprofCollectorStack(),
 		core.V1().Service(),
 		core.V1().Endpoints(),
 		core.V1().ConfigMap(),
+		core.V1().Secret(),
+	)
+	// targets carry the labels and annotations of their pods when their monitor relabels them, other pod
+	// changes don't change the config
+	relatedresource.Watch(ctx,
+		"pprof-pod-watch",
+		h.resolvePod,
+		h.pprofFactory.Resources().V1alpha1().PprofMonitor(),
+		core.V1().Pod(),
 	)
 	// TODO : we want to watch config map changes to this namespace / owner
 
@@ -84,7 +98,9 @@ type PprofHandler struct {
 	serviceCache   v1core.ServiceCache
 	namespaceCache v1core.NamespaceCache
 	endpointCache  v1core.EndpointsCache
+	secretCache    v1core.SecretCache
 	monitorCache   pprofcontroller.PprofMonitorCache
+	stackCache     pprofcontroller.PprofCollectorStackCache
 	apply          apply.Apply
 }
 
@@ -166,14 +182,14 @@ func endpSelectorToList(
 type directAddrAndFriendlyName struct {
 	addr         string
 	friendlyName string
+	// meta are the target metadata labels, available to relabelings
+	meta map[string]string
+	// proxy is set when the target is scraped through the API server
+	proxy *config.KubernetesProxyConfig
 }
 
-func endpSubsetToAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoint) []directAddrAndFriendlyName {
-	addrWithoutSchemePath := []directAddrAndFriendlyName{}
-	// if target.Port != "" {
-
-	// match to service ports
-	svc := endpAndSvc.service
+// servicePorts returns the ports of the service selected by the endpoint
+func servicePorts(svc *corev1.Service, target v1alpha1.Endpoint) []corev1.ServicePort {
 	svcPorts := []corev1.ServicePort{}
 	for _, port := range svc.Spec.Ports {
 		if target.Port == port.Name {
@@ -195,11 +211,39 @@ func endpSubsetToAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoi
 			}
 		}
 	}
+	return svcPorts
+}
+
+// endpointURL adds the endpoint's scheme and path to a host:port address
+func endpointURL(hostPort string, target v1alpha1.Endpoint) string {
+	scheme := strings.TrimSpace(target.Scheme)
+	if scheme == "" {
+		scheme = "http"
+	}
+	newAddr := fmt.Sprintf("%s://%s", scheme, hostPort)
+	path := strings.TrimSpace(target.Path)
+	if path != "" {
+		path = path + "/debug/pprof"
+		newAddr = fmt.Sprintf("%s/%s", newAddr, path)
+	}
+	return newAddr
+}
+
+// endpSubsetToAddresses returns a target per address and port of the endpoint, pods resolves the addresses' pods
+// for their metadata
+func endpSubsetToAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoint, pods podLookup) []directAddrAndFriendlyName {
+	addrWithoutSchemePath := []directAddrAndFriendlyName{}
+	// if target.Port != "" {
+
+	// match to service ports
+	svc := endpAndSvc.service
+	svcPorts := servicePorts(svc, target)
 
 	// logrus.Infof("got svcPorts : %v", svcPorts)
 
 	// correlate to endpoints
 	subsets := endpAndSvc.endp.Subsets
+	svcMeta := serviceMeta(svc)
 
 	for _, subset := range subsets {
 		ports := subset.Ports
@@ -230,10 +274,21 @@ func endpSubsetToAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoi
 			for _, port := range actualPorts {
 				// TODO : this doesn't really differentiate different containers within pods
 
+				var proxy *config.KubernetesProxyConfig
+				if target.Transport == v1alpha1.TransportPodProxy {
+					proxy = &config.KubernetesProxyConfig{
+						Resource:  config.ProxyResourcePods,
+						Namespace: svc.Namespace,
+						Name:      ip.TargetRef.Name,
+						Port:      strconv.Itoa(port),
+					}
+				}
 				addrWithoutSchemePath = append(addrWithoutSchemePath, directAddrAndFriendlyName{
 					addr: fmt.Sprintf("%s:%d", ip.IP, port),
 					// Note : do not include any '/' in the friendly name it will confuse the hacky storage implementation
 					friendlyName: ip.TargetRef.Name,
+					meta:         addressMeta(svcMeta, ip, port, addressPod(pods, svc.Namespace, ip)),
+					proxy:        proxy,
 				})
 			}
 		}
@@ -242,24 +297,76 @@ func endpSubsetToAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoi
 	// logrus.Info("got addrWithoutSchemePath : ", addrWithoutSchemePath)
 	ret := []directAddrAndFriendlyName{}
 	for _, addrAndName := range addrWithoutSchemePath {
-		newAddr := addrAndName.addr
-		scheme := strings.TrimSpace(target.Scheme)
-		if scheme == "" {
-			scheme = "http"
-		}
-		newAddr = fmt.Sprintf("%s://%s", scheme, newAddr)
-		path := strings.TrimSpace(target.Path)
-		if path != "" {
-			path = path + "/debug/pprof"
-			newAddr = fmt.Sprintf("%s/%s", newAddr, path)
-		}
-		addrAndName.addr = newAddr
+		addrAndName.addr = endpointURL(addrAndName.addr, target)
 		ret = append(ret, addrAndName)
 	}
 
 	return ret
 }
 
+// serviceProxyAddresses returns a single target per service port, scraped through the API server's services/proxy
+func serviceProxyAddresses(endpAndSvc serviceAndEndpoint, target v1alpha1.Endpoint) []directAddrAndFriendlyName {
+	svc := endpAndSvc.service
+	svcMeta := serviceMeta(svc)
+	ret := []directAddrAndFriendlyName{}
+	for _, svcPort := range servicePorts(svc, target) {
+		port := svcPort.Name
+		if port == "" {
+			port = strconv.Itoa(int(svcPort.Port))
+		}
+		meta := maps.Clone(svcMeta)
+		meta[metaEndpointPort] = strconv.Itoa(int(svcPort.Port))
+		ret = append(ret, directAddrAndFriendlyName{
+			// only identifies the target, the collector doesn't connect to it
+			addr:         endpointURL(fmt.Sprintf("%s.%s.svc:%d", svc.Name, svc.Namespace, svcPort.Port), target),
+			friendlyName: svc.Name,
+			meta:         meta,
+			proxy: &config.KubernetesProxyConfig{
+				Resource:  config.ProxyResourceServices,
+				Namespace: svc.Namespace,
+				Name:      svc.Name,
+				Port:      port,
+			},
+		})
+	}
+	return ret
+}
+
+// pod returns a pod from the cache, nil when it isn't found
+func (h *PprofHandler) pod(namespace, name string) *corev1.Pod {
+	pod, err := h.podCache.Get(namespace, name)
+	if err != nil {
+		return nil
+	}
+	return pod
+}
+
+// resolvePod returns the monitors relabeling targets that the pod backs
+func (h *PprofHandler) resolvePod(namespace, name string, _ runtime.Object) ([]relatedresource.Key, error) {
+	ns, err := h.namespaceCache.Get(namespace)
+	if err != nil {
+		return nil, nil
+	}
+	monitors, err := h.monitorCache.List("", labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	ret := []relatedresource.Key{}
+	for _, mon := range monitors {
+		if len(mon.Spec.Relabelings) == 0 || len(nsSelectorToList([]*corev1.Namespace{ns}, mon.Spec.NamespaceSelector)) == 0 {
+			continue
+		}
+		endps, err := endpSelectorToList([]*corev1.Namespace{ns}, h.serviceCache, h.endpointCache, mon.Spec.Selector)
+		if err != nil {
+			return nil, err
+		}
+		if backedByPod(endps, namespace, name) {
+			ret = append(ret, relatedresource.Key{Namespace: mon.Namespace, Name: mon.Name})
+		}
+	}
+	return ret, nil
+}
+
 type MonitorAndAddresses struct {
 	monitor      *v1alpha1.PprofMonitor
 	addresses    []directAddrAndFriendlyName
@@ -298,8 +405,16 @@ func (h *PprofHandler) OnPprofMonitorChange(_ string, monitor *v1alpha1.PprofMon
 
 		logger.With("monitor", mon.Name, "endpoints", len(endpAndServiceList)).Debug("got endpoints to process")
 
+		// pods are only looked up for their metadata, which only relabelings use
+		var pods podLookup
+		if len(mon.Spec.Relabelings) > 0 {
+			pods = h.pod
+		}
 		for _, endp := range endpAndServiceList {
-			addresses := endpSubsetToAddresses(endp, mon.Spec.Endpoint)
+			addresses := endpSubsetToAddresses(endp, mon.Spec.Endpoint, pods)
+			if mon.Spec.Endpoint.Transport == v1alpha1.TransportServiceProxy {
+				addresses = serviceProxyAddresses(endp, mon.Spec.Endpoint)
+			}
 			slices.SortStableFunc(addresses, func(a, b directAddrAndFriendlyName) int {
 				if a.friendlyName < b.friendlyName {
 					return -1
@@ -315,8 +430,8 @@ func (h *PprofHandler) OnPprofMonitorChange(_ string, monitor *v1alpha1.PprofMon
 				}
 				return 0
 			})
-			// TODO : at some point in this pipeline we need to de-duplicate addresses : Monitors can point to the same address, pprof typically prevents multiple concurrent
-			// open requests.
+			// Monitors can point to the same address : the collector scrapes each address once per distinct settings,
+			// stores the profiles for every monitor and never runs exclusive requests like CPU profiles concurrently.
 			constructed = append(constructed, MonitorAndAddresses{
 				monitor:      mon,
 				addresses:    addresses,
@@ -350,26 +465,38 @@ func (h *PprofHandler) OnPprofMonitorChange(_ string, monitor *v1alpha1.PprofMon
 		Monitors:      []*config.MonitorConfig{},
 	}
 
+	monitorAssets := assets{}
 	for _, mon := range constructed {
+		clientCfg, err := h.httpClientConfig(monitorAssets, mon.monitor)
+		if err != nil {
+			logger.With("monitor", mon.monitor.Name, "namespace", mon.monitor.Namespace, "err", err).Error("skipping monitor with invalid endpoint configuration")
+			continue
+		}
 		for _, addr := range mon.addresses {
+			clientCfg.KubernetesProxy = addr.proxy
 			cfg.Monitors = append(cfg.Monitors, &config.MonitorConfig{
-				Name:     addr.friendlyName,
-				Endpoint: addr.addr,
-				Labels: map[string]string{
-					collabels.NamespaceLabel: mon.k8snamespace,
-					collabels.NameLabel:      mon.k8sname,
-				},
+				Name:           addr.friendlyName,
+				Endpoint:       addr.addr,
+				Labels:         targetLabels(mon, addr),
 				GlobalSampling: mon.monitor.Spec.Config,
+				Profiles:       mon.monitor.Spec.Profiles,
+				HTTPClient:     clientCfg,
+				Relabelings:    mon.monitor.Spec.Relabelings,
 			})
 		}
 	}
+	stacks, err := h.stackCache.List(h.ControllerNamespace, labels.Everything())
+	if err != nil {
+		return monitor, err
+	}
+	cfg.Discovery = podDiscovery(stacks)
 	// FIXME: configurable
 	cfg.SelfTelemetry = &config.SelfTelemetryConfig{
 		PprofPort:       6060,
 		IntervalSeconds: 120,
 	}
 
-	objs, err := h.Objects(cfg)
+	objs, err := h.Objects(cfg, monitorAssets)
 	logrus.Debug("got objects : ", objs)
 	if err != nil {
 		logrus.Errorf("failed to generate objects : %s", err)
@@ -379,6 +506,12 @@ func (h *PprofHandler) OnPprofMonitorChange(_ string, monitor *v1alpha1.PprofMon
 		logrus.Errorf("failed to apply objects : %s", err)
 		return monitor, err
 	}
+	// roles are pruned once no target of their namespace goes through the API server
+	rbacApply := h.apply.WithSetID(h.OperatorName + "-proxy-rbac")
+	if err := rbacApply.ApplyObjects(proxyRBAC(h.OperatorOptions, cfg.Monitors)...); err != nil {
+		logrus.Errorf("failed to apply proxy RBAC : %s", err)
+		return monitor, err
+	}
 
 	return monitor, nil
 }
@@ -1,3 +1,69 @@
 package monitor
 
-// TODO
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func testServiceAndEndpoint() serviceAndEndpoint {
+	return serviceAndEndpoint{
+		service: &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+			Spec: corev1.ServiceSpec{
+				Ports: []corev1.ServicePort{
+					{Name: "pprof", Port: 80, TargetPort: intstr.FromInt(6060)},
+				},
+			},
+		},
+		endp: &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "payments"},
+			Subsets: []corev1.EndpointSubset{
+				{
+					Addresses: []corev1.EndpointAddress{
+						{IP: "10.0.0.1", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "api-0"}},
+						{IP: "10.0.0.2", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "api-1"}},
+					},
+					Ports: []corev1.EndpointPort{{Name: "pprof", Port: 6060}},
+				},
+			},
+		},
+	}
+}
+
+func TestProxyAddresses(t *testing.T) {
+	endp := testServiceAndEndpoint()
+
+	direct := endpSubsetToAddresses(endp, v1alpha1.Endpoint{Port: "pprof"}, nil)
+	require.Len(t, direct, 2)
+	assert.Equal(t, "http://10.0.0.1:6060", direct[0].addr)
+	assert.Nil(t, direct[0].proxy)
+
+	pods := endpSubsetToAddresses(endp, v1alpha1.Endpoint{Port: "pprof", Transport: v1alpha1.TransportPodProxy}, nil)
+	require.Len(t, pods, 2)
+	assert.Equal(t, "http://10.0.0.2:6060", pods[1].addr)
+	assert.Equal(t, &config.KubernetesProxyConfig{
+		Resource:  config.ProxyResourcePods,
+		Namespace: "payments",
+		Name:      "api-1",
+		Port:      "6060",
+	}, pods[1].proxy)
+
+	services := serviceProxyAddresses(endp, v1alpha1.Endpoint{Port: "pprof", Scheme: "https", Transport: v1alpha1.TransportServiceProxy})
+	require.Len(t, services, 1)
+	assert.Equal(t, "https://api.payments.svc:80", services[0].addr)
+	assert.Equal(t, "api", services[0].friendlyName)
+	assert.Equal(t, "80", services[0].meta[metaEndpointPort])
+	assert.Equal(t, &config.KubernetesProxyConfig{
+		Resource:  config.ProxyResourceServices,
+		Namespace: "payments",
+		Name:      "api",
+		Port:      "pprof",
+	}, services[0].proxy)
+}
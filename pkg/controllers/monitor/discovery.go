@@ -0,0 +1,28 @@
+package monitor
+
+import (
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+)
+
+// PodDiscoveryName is the name of the collector's pod discovery
+const PodDiscoveryName = "kubernetes-pods"
+
+// podDiscovery enables the collector's pod discovery when one of the stacks asks for it
+func podDiscovery(stacks []*v1alpha1.PprofCollectorStack) []*config.DiscoveryConfig {
+	for _, stack := range stacks {
+		if stack.Spec.PodDiscovery == nil {
+			continue
+		}
+		return []*config.DiscoveryConfig{
+			{
+				Name: PodDiscoveryName,
+				Kubernetes: &config.KubernetesDiscoveryConfig{
+					Namespaces: stack.Spec.PodDiscovery.Namespaces,
+					Selector:   stack.Spec.PodDiscovery.Selector,
+				},
+			},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPodDiscovery(t *testing.T) {
+	assert.Nil(t, podDiscovery([]*v1alpha1.PprofCollectorStack{{}}))
+
+	cfgs := podDiscovery([]*v1alpha1.PprofCollectorStack{
+		{},
+		{Spec: v1alpha1.CollectorSpec{PodDiscovery: &v1alpha1.PodDiscovery{
+			Namespaces: []string{"payments"},
+			Selector:   "team=checkout",
+		}}},
+	})
+	require.Len(t, cfgs, 1)
+	assert.Equal(t, PodDiscoveryName, cfgs[0].Name)
+	require.NotNil(t, cfgs[0].Kubernetes)
+	assert.Equal(t, []string{"payments"}, cfgs[0].Kubernetes.Namespaces)
+	assert.Equal(t, "team=checkout", cfgs[0].Kubernetes.Selector)
+	assert.NoError(t, cfgs[0].Validate())
+}
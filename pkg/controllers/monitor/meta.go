@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"maps"
+	"regexp"
+	"strconv"
+
+	collabels "github.com/rancher-sandbox/profiling/pkg/collector/labels"
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Target metadata labels, available to relabelings
+const (
+	metaNamespace         = relabel.MetaPrefix + "kubernetes_namespace"
+	metaServiceName       = relabel.MetaPrefix + "kubernetes_service_name"
+	metaServiceLabel      = relabel.MetaPrefix + "kubernetes_service_label_"
+	metaServiceAnnotation = relabel.MetaPrefix + "kubernetes_service_annotation_"
+	metaEndpointPort      = relabel.MetaPrefix + "kubernetes_endpoint_port"
+	metaEndpointNodeName  = relabel.MetaPrefix + "kubernetes_endpoint_node_name"
+	metaTargetKind        = relabel.MetaPrefix + "kubernetes_endpoint_address_target_kind"
+	metaTargetName        = relabel.MetaPrefix + "kubernetes_endpoint_address_target_name"
+	metaPodName           = relabel.MetaPrefix + "kubernetes_pod_name"
+	metaPodNodeName       = relabel.MetaPrefix + "kubernetes_pod_node_name"
+	metaPodLabel          = relabel.MetaPrefix + "kubernetes_pod_label_"
+	metaPodAnnotation     = relabel.MetaPrefix + "kubernetes_pod_annotation_"
+	metaMonitorName       = relabel.MetaPrefix + "pprofmonitor_name"
+	metaMonitorNamespace  = relabel.MetaPrefix + "pprofmonitor_namespace"
+)
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func sanitizeLabelName(name string) string {
+	return invalidLabelChars.ReplaceAllString(name, "_")
+}
+
+func serviceMeta(svc *corev1.Service) map[string]string {
+	ret := map[string]string{
+		metaNamespace:   svc.Namespace,
+		metaServiceName: svc.Name,
+	}
+	for k, v := range svc.Labels {
+		ret[metaServiceLabel+sanitizeLabelName(k)] = v
+	}
+	for k, v := range svc.Annotations {
+		ret[metaServiceAnnotation+sanitizeLabelName(k)] = v
+	}
+	return ret
+}
+
+// podLookup returns a pod from the cache, or nil when it isn't known
+type podLookup func(namespace, name string) *corev1.Pod
+
+// addressMeta adds the metadata of an endpoint address to the service's. pod is the address's target, when it
+// is a known pod
+func addressMeta(svcMeta map[string]string, addr corev1.EndpointAddress, port int, pod *corev1.Pod) map[string]string {
+	ret := make(map[string]string, len(svcMeta)+5)
+	for k, v := range svcMeta {
+		ret[k] = v
+	}
+	ret[metaEndpointPort] = strconv.Itoa(port)
+	if addr.NodeName != nil {
+		ret[metaEndpointNodeName] = *addr.NodeName
+	}
+	if addr.TargetRef != nil {
+		ret[metaTargetKind] = addr.TargetRef.Kind
+		ret[metaTargetName] = addr.TargetRef.Name
+		if addr.TargetRef.Kind == "Pod" {
+			ret[metaPodName] = addr.TargetRef.Name
+		}
+	}
+	if pod != nil {
+		ret[metaPodName] = pod.Name
+		if pod.Spec.NodeName != "" {
+			ret[metaPodNodeName] = pod.Spec.NodeName
+		}
+		for k, v := range pod.Labels {
+			ret[metaPodLabel+sanitizeLabelName(k)] = v
+		}
+		for k, v := range pod.Annotations {
+			ret[metaPodAnnotation+sanitizeLabelName(k)] = v
+		}
+	}
+	return ret
+}
+
+// targetLabels are the labels of a target. The metadata labels are only kept for monitors with relabelings, the
+// collector drops them after relabeling and they would otherwise bloat the rendered config
+func targetLabels(mon MonitorAndAddresses, addr directAddrAndFriendlyName) map[string]string {
+	ret := map[string]string{}
+	if len(mon.monitor.Spec.Relabelings) > 0 {
+		maps.Copy(ret, addr.meta)
+		ret[metaMonitorName] = mon.monitor.Name
+		ret[metaMonitorNamespace] = mon.monitor.Namespace
+	}
+	ret[collabels.NamespaceLabel] = mon.k8snamespace
+	ret[collabels.NameLabel] = mon.k8sname
+	return ret
+}
+
+// backedByPod returns true when one of the endpoints' addresses points to the pod
+func backedByPod(endps []serviceAndEndpoint, namespace, name string) bool {
+	for _, endp := range endps {
+		for _, subset := range endp.endp.Subsets {
+			for _, addr := range subset.Addresses {
+				if addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" || addr.TargetRef.Name != name {
+					continue
+				}
+				podNamespace := endp.endp.Namespace
+				if addr.TargetRef.Namespace != "" {
+					podNamespace = addr.TargetRef.Namespace
+				}
+				if podNamespace == namespace {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// addressPod resolves the pod an endpoint address points to
+func addressPod(pods podLookup, namespace string, addr corev1.EndpointAddress) *corev1.Pod {
+	if pods == nil || addr.TargetRef == nil || addr.TargetRef.Kind != "Pod" {
+		return nil
+	}
+	if addr.TargetRef.Namespace != "" {
+		namespace = addr.TargetRef.Namespace
+	}
+	return pods(namespace, addr.TargetRef.Name)
+}
@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/collector/relabel"
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/operator/apis/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTargetMeta(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "api",
+			Namespace:   "payments",
+			Labels:      map[string]string{"app.kubernetes.io/team": "checkout"},
+			Annotations: map[string]string{"example.com/env": "prod"},
+		},
+	}
+	node := "node-1"
+	meta := addressMeta(serviceMeta(svc), corev1.EndpointAddress{
+		IP:       "10.0.0.1",
+		NodeName: &node,
+		TargetRef: &corev1.ObjectReference{
+			Kind: "Pod",
+			Name: "api-7d9f",
+		},
+	}, 6060, nil)
+	assert.Equal(t, map[string]string{
+		"__meta_kubernetes_namespace":                            "payments",
+		"__meta_kubernetes_service_name":                         "api",
+		"__meta_kubernetes_service_label_app_kubernetes_io_team": "checkout",
+		"__meta_kubernetes_service_annotation_example_com_env":   "prod",
+		"__meta_kubernetes_endpoint_port":                        "6060",
+		"__meta_kubernetes_endpoint_node_name":                   "node-1",
+		"__meta_kubernetes_endpoint_address_target_kind":         "Pod",
+		"__meta_kubernetes_endpoint_address_target_name":         "api-7d9f",
+		"__meta_kubernetes_pod_name":                             "api-7d9f",
+	}, meta)
+}
+
+func TestPodMetaRelabel(t *testing.T) {
+	endp := testServiceAndEndpoint()
+	pods := func(namespace, name string) *corev1.Pod {
+		if namespace != "payments" || name != "api-0" {
+			return nil
+		}
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "api-0",
+				Namespace:   "payments",
+				Labels:      map[string]string{"app.kubernetes.io/team": "checkout"},
+				Annotations: map[string]string{"example.com/env": "prod"},
+			},
+			Spec: corev1.PodSpec{NodeName: "node-1"},
+		}
+	}
+	addresses := endpSubsetToAddresses(endp, v1alpha1.Endpoint{Port: "pprof"}, pods)
+	require.Len(t, addresses, 2)
+	meta := addresses[0].meta
+	assert.Equal(t, "checkout", meta["__meta_kubernetes_pod_label_app_kubernetes_io_team"])
+	assert.Equal(t, "prod", meta["__meta_kubernetes_pod_annotation_example_com_env"])
+	assert.Equal(t, "node-1", meta["__meta_kubernetes_pod_node_name"])
+	assert.Equal(t, "api-0", meta["__meta_kubernetes_pod_name"])
+	// pods missing from the cache only have the endpoint's metadata
+	assert.NotContains(t, addresses[1].meta, "__meta_kubernetes_pod_label_app_kubernetes_io_team")
+	assert.Equal(t, "api-1", addresses[1].meta["__meta_kubernetes_pod_name"])
+
+	relabeled, keep, err := relabel.Monitor(&config.MonitorConfig{
+		Name:     addresses[0].friendlyName,
+		Endpoint: addresses[0].addr,
+		Labels:   meta,
+		Relabelings: []config.RelabelConfig{
+			{
+				SourceLabels: []string{"__meta_kubernetes_pod_label_app_kubernetes_io_team"},
+				TargetLabel:  "team",
+			},
+			{
+				SourceLabels: []string{"__meta_kubernetes_pod_annotation_example_com_env"},
+				TargetLabel:  "env",
+			},
+		},
+	})
+	require.NoError(t, err)
+	require.True(t, keep)
+	assert.Equal(t, "checkout", relabeled.Labels["team"])
+	assert.Equal(t, "prod", relabeled.Labels["env"])
+}
+
+func TestTargetLabels(t *testing.T) {
+	endp := testServiceAndEndpoint()
+	addr := endpSubsetToAddresses(endp, v1alpha1.Endpoint{Port: "pprof"}, nil)[0]
+	mon := MonitorAndAddresses{
+		monitor:      &v1alpha1.PprofMonitor{ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "monitoring"}},
+		k8sname:      "api",
+		k8snamespace: "payments",
+	}
+	// targets that aren't relabeled don't carry metadata
+	assert.Equal(t, map[string]string{"__k8s_namespace": "payments", "__k8s_name": "api"}, targetLabels(mon, addr))
+
+	mon.monitor.Spec.Relabelings = []config.RelabelConfig{{SourceLabels: []string{"__meta_kubernetes_pod_name"}, TargetLabel: "pod"}}
+	lbls := targetLabels(mon, addr)
+	assert.Equal(t, "api-0", lbls["__meta_kubernetes_pod_name"])
+	assert.Equal(t, "api", lbls["__meta_pprofmonitor_name"])
+	assert.Equal(t, "payments", lbls["__k8s_namespace"])
+}
+
+func TestBackedByPod(t *testing.T) {
+	endps := []serviceAndEndpoint{testServiceAndEndpoint()}
+	assert.True(t, backedByPod(endps, "payments", "api-1"))
+	assert.False(t, backedByPod(endps, "payments", "api-2"))
+	assert.False(t, backedByPod(endps, "other", "api-1"))
+}
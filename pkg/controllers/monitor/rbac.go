@@ -0,0 +1,82 @@
+package monitor
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// proxyRoleName is unique per operator namespace, since the roles live in the targets' namespaces
+func proxyRoleName(opts common.OperatorOptions) string {
+	return fmt.Sprintf("%s-%s-proxy", opts.ControllerNamespace, common.NamespacedCollectorName(opts))
+}
+
+// proxyRBAC grants the collector's service account access to the proxy subresources of the targets scraped
+// through the API server, with a role in each of the targets' namespaces. Roles are restricted to the proxied
+// pods and services and their ports, under both schemes since relabelings can change them
+func proxyRBAC(opts common.OperatorOptions, monitors []*config.MonitorConfig) []runtime.Object {
+	// namespace -> resource -> proxy targets
+	targets := map[string]map[string][]string{}
+	for _, mon := range monitors {
+		proxy := mon.HTTPClient.KubernetesProxy
+		if proxy == nil {
+			continue
+		}
+		if _, ok := targets[proxy.Namespace]; !ok {
+			targets[proxy.Namespace] = map[string][]string{}
+		}
+		resource := proxy.ProxyResource() + "/proxy"
+		for _, scheme := range []string{"http", "https"} {
+			if target := proxy.ProxyTarget(scheme); !slices.Contains(targets[proxy.Namespace][resource], target) {
+				targets[proxy.Namespace][resource] = append(targets[proxy.Namespace][resource], target)
+			}
+		}
+	}
+
+	objs := []runtime.Object{}
+	for _, ns := range slices.Sorted(maps.Keys(targets)) {
+		rules := []rbacv1.PolicyRule{}
+		for _, resource := range slices.Sorted(maps.Keys(targets[ns])) {
+			rules = append(rules, rbacv1.PolicyRule{
+				APIGroups:     []string{""},
+				Resources:     []string{resource},
+				ResourceNames: slices.Sorted(slices.Values(targets[ns][resource])),
+				Verbs:         []string{"get"},
+			})
+		}
+		objs = append(objs,
+			&rbacv1.Role{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      proxyRoleName(opts),
+					Namespace: ns,
+				},
+				Rules: rules,
+			},
+			&rbacv1.RoleBinding{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      proxyRoleName(opts),
+					Namespace: ns,
+				},
+				RoleRef: rbacv1.RoleRef{
+					APIGroup: rbacv1.GroupName,
+					Kind:     "Role",
+					Name:     proxyRoleName(opts),
+				},
+				Subjects: []rbacv1.Subject{
+					{
+						Kind:      rbacv1.ServiceAccountKind,
+						Name:      common.NamespacedCollectorName(opts),
+						Namespace: opts.ControllerNamespace,
+					},
+				},
+			},
+		)
+	}
+	return objs
+}
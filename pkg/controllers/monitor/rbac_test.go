@@ -0,0 +1,49 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/rancher-sandbox/profiling/pkg/config"
+	"github.com/rancher-sandbox/profiling/pkg/controllers/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestProxyRBAC(t *testing.T) {
+	opts := common.OperatorOptions{OperatorName: "pprof", ControllerNamespace: "cattle-profiling"}
+	assert.Empty(t, proxyRBAC(opts, []*config.MonitorConfig{{Name: "direct"}}))
+
+	objs := proxyRBAC(opts, []*config.MonitorConfig{
+		{Name: "direct"},
+		{HTTPClient: config.HTTPClientConfig{KubernetesProxy: &config.KubernetesProxyConfig{Namespace: "payments", Name: "api-0", Port: "6060"}}},
+		{HTTPClient: config.HTTPClientConfig{KubernetesProxy: &config.KubernetesProxyConfig{Namespace: "payments", Name: "api-1", Port: "6060"}}},
+		{HTTPClient: config.HTTPClientConfig{KubernetesProxy: &config.KubernetesProxyConfig{Resource: config.ProxyResourceServices, Namespace: "payments", Name: "api", Port: "pprof"}}},
+		{HTTPClient: config.HTTPClientConfig{KubernetesProxy: &config.KubernetesProxyConfig{Namespace: "billing", Name: "worker-0", Port: "6060"}}},
+	})
+	require.Len(t, objs, 4)
+
+	role := objs[0].(*rbacv1.Role)
+	assert.Equal(t, "billing", role.Namespace)
+	assert.Equal(t, "cattle-profiling-pprof-collector-proxy", role.Name)
+	assert.Equal(t, []string{"pods/proxy"}, role.Rules[0].Resources)
+	assert.Equal(t, []string{"https:worker-0:6060", "worker-0:6060"}, role.Rules[0].ResourceNames)
+
+	// the role only grants access to the proxied pods and services
+	role = objs[2].(*rbacv1.Role)
+	assert.Equal(t, "payments", role.Namespace)
+	require.Len(t, role.Rules, 2)
+	assert.Equal(t, []string{"pods/proxy"}, role.Rules[0].Resources)
+	assert.Equal(t, []string{"api-0:6060", "api-1:6060", "https:api-0:6060", "https:api-1:6060"}, role.Rules[0].ResourceNames)
+	assert.Equal(t, []string{"services/proxy"}, role.Rules[1].Resources)
+	assert.Equal(t, []string{"api:pprof", "https:api:pprof"}, role.Rules[1].ResourceNames)
+	assert.Equal(t, []string{"get"}, role.Rules[1].Verbs)
+
+	binding := objs[3].(*rbacv1.RoleBinding)
+	assert.Equal(t, role.Name, binding.RoleRef.Name)
+	assert.Equal(t, rbacv1.Subject{
+		Kind:      rbacv1.ServiceAccountKind,
+		Name:      "pprof-collector",
+		Namespace: "cattle-profiling",
+	}, binding.Subjects[0])
+}
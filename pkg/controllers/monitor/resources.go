@@ -10,7 +10,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 )
 
-func (h *PprofHandler) Objects(config config.CollectorConfig) ([]runtime.Object, error) {
+func (h *PprofHandler) Objects(config config.CollectorConfig, assets assets) ([]runtime.Object, error) {
 	//TODO: config validation
 
 	data, err := yaml.Marshal(config)
@@ -30,7 +30,16 @@ func (h *PprofHandler) Objects(config config.CollectorConfig) ([]runtime.Object,
 
 	// logrus.Warn("configMap: ", configMap)
 
+	assetsSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      common.NamespacedAssetsName(h.OperatorOptions),
+			Namespace: h.ControllerNamespace,
+		},
+		Data: assets,
+	}
+
 	return []runtime.Object{
 		configMap,
+		assetsSecret,
 	}, nil
 }
@@ -61,6 +61,8 @@ func (g *GenericImage) ImageStr() (string, error) {
 type GenericStorage struct {
 	// resource.MustParse("1Gi")
 	DiskSpace string `json:"diskSpace"`
+	// ArtifactDiskSpace is the size of the volume of artifacts, like traces and captures, defaults to 1Gi
+	ArtifactDiskSpace string `json:"artifactDiskSpace,omitempty"`
 	// TODO : extend fields to handle pvcs / storage claims volumes
 }
 
@@ -79,6 +81,22 @@ type CollectorSpec struct {
 	CollectorImage GenericImage   `json:"collectorImage"`
 	ReloaderImage  GenericImage   `json:"reloaderImage"`
 	Storage        GenericStorage `json:"storage"`
+	// PodDiscovery lets the collector discover annotated pods by itself, it is granted read access to pods
+	PodDiscovery *PodDiscovery `json:"podDiscovery,omitempty"`
+	// Shards spreads the targets across this many collector replicas, by the hash of their endpoint.
+	// Queries to any replica are fanned out to the others. Each replica gets its own copy of the
+	// requested volumes. Switching between a single collector and shards recreates the collector's
+	// StatefulSet, the volumes of the single collector are kept.
+	// If empty, uses a single collector.
+	// +kubebuilder:validation:Minimum=0
+	Shards int32 `json:"shards,omitempty"`
+}
+
+type PodDiscovery struct {
+	// Namespaces to discover pods from, defaults to all namespaces
+	Namespaces []string `json:"namespaces,omitempty"`
+	// Label selector restricting the discovered pods
+	Selector string `json:"selector,omitempty"`
 }
 
 type CollectorStatus struct {
@@ -106,6 +124,11 @@ type PprofSpec struct {
 	// TODO : document config
 	// TODO : pass in as pointer, and handle nil pointer with default config in controller
 	Config config.GlobalSamplingConfig `json:"config,omitempty"`
+	// Profiles served by the endpoints in addition to the built-in pprof profiles
+	Profiles []config.ProfileSpec `json:"profiles,omitempty"`
+	// Relabelings are applied to the labels of each target before scraping.
+	// Targets carry `__meta_kubernetes_*` labels describing their service and endpoint.
+	Relabelings []config.RelabelConfig `json:"relabelings,omitempty"`
 }
 
 type NamespaceSelector struct {
@@ -130,6 +153,52 @@ type Endpoint struct {
 	// If empty, Prometheus uses the default value `http`.
 	// +kubebuilder:validation:Enum=http;https
 	Scheme string `json:"scheme,omitempty"`
+
+	// TLS configuration to use when scraping the endpoint, with `https` scheme
+	TLSConfig *TLSConfig `json:"tlsConfig,omitempty"`
+	// Secret containing the bearer token used to scrape the endpoint, in the namespace of the PprofMonitor.
+	// Mutually exclusive with basicAuth.
+	BearerTokenSecret *corev1.SecretKeySelector `json:"bearerTokenSecret,omitempty"`
+	// Basic authentication credentials used to scrape the endpoint, mutually exclusive with bearerTokenSecret.
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+	// HTTP proxy used to scrape the endpoint
+	ProxyURL string `json:"proxyUrl,omitempty"`
+	// Timeout of a single scrape, in addition to the duration of the requested profile
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Transport selects how the collector reaches the endpoints : `direct` connects to the pods,
+	// `podProxy` and `serviceProxy` go through the API server's pods/proxy or services/proxy subresource,
+	// authenticated as the collector's service account, for pods the collector can't reach.
+	// `serviceProxy` scrapes each service port once, through whichever pod the API server picks.
+	// The proxy transports can't be combined with tlsConfig, bearerTokenSecret, basicAuth or proxyUrl.
+	// If empty, uses the default value `direct`.
+	// +kubebuilder:validation:Enum=direct;podProxy;serviceProxy
+	Transport string `json:"transport,omitempty"`
+}
+
+const (
+	TransportDirect       = "direct"
+	TransportPodProxy     = "podProxy"
+	TransportServiceProxy = "serviceProxy"
+)
+
+type TLSConfig struct {
+	// Secret containing the CA used to verify the endpoint's certificate, in the namespace of the PprofMonitor.
+	CA *corev1.SecretKeySelector `json:"ca,omitempty"`
+	// Secret containing the client certificate to present to the endpoint, in the namespace of the PprofMonitor.
+	Cert *corev1.SecretKeySelector `json:"cert,omitempty"`
+	// Secret containing the private key of the client certificate, in the namespace of the PprofMonitor.
+	KeySecret *corev1.SecretKeySelector `json:"keySecret,omitempty"`
+	// Server name used to verify the endpoint's certificate
+	ServerName string `json:"serverName,omitempty"`
+	// Disables verification of the endpoint's certificate
+	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
+}
+
+type BasicAuth struct {
+	// Secret key containing the username, in the namespace of the PprofMonitor.
+	Username corev1.SecretKeySelector `json:"username"`
+	// Secret key containing the password, in the namespace of the PprofMonitor.
+	Password corev1.SecretKeySelector `json:"password"`
 }
 
 type PprofStatus struct {